@@ -1,12 +1,15 @@
 package api
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/OpenBazaar/openbazaar-go/core"
 	"github.com/OpenBazaar/openbazaar-go/repo"
+	ipfscore "github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/corehttp"
 	"github.com/op/go-logging"
 )
@@ -49,14 +52,75 @@ func NewGateway(n *core.OpenBazaarNode, authCookie http.Cookie, l net.Listener,
 		}
 	}
 
+	// The IPFS gateway handler only matches allowed IPs as exact strings and
+	// can't split IPv6 remote addresses, so the allow-list, with its CIDR
+	// ranges, is applied here to every handler on the mux
+	allowedIPs, allowedNets := parseAllowedIPs(config.AllowedIPs)
 	return &Gateway{
 		listener:   l,
-		handler:    topMux,
+		handler:    ipFilter(topMux, allowedIPs, allowedNets),
 		config:     config,
 		shutdownCh: make(chan struct{}),
 	}, nil
 }
 
+// ipFilter forbids requests to h from IPs the JSON-API config doesn't allow
+func ipFilter(h http.Handler, ips map[string]bool, nets []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ipAllowed(ips, nets, r.RemoteAddr) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "403 - Forbidden")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether the request carries the auth cookie or, when a
+// username and password hash are configured, matching basic auth credentials
+func authorized(r *http.Request, authCookie http.Cookie, username, passwordHash string) bool {
+	if username == "" || passwordHash == "" {
+		cookie, err := r.Cookie(repo.AuthCookieName)
+		return err == nil && authCookie.Value == cookie.Value
+	}
+	u, password, ok := r.BasicAuth()
+	return ok && u == username && repo.CheckAPIPassword(passwordHash, password)
+}
+
+// GatewayOption serves the IPFS gateway like corehttp.GatewayOption, but
+// checks the JSON-API credentials itself as the vendored handler can only
+// compare unsalted password hashes. It also resolves blockchainIDs in /ipns/
+// paths with n.ResolveHandle so that the fallback resolvers are tried.
+func GatewayOption(n *core.OpenBazaarNode, authCookie http.Cookie, config repo.APIConfig, writable bool, paths ...string) corehttp.ServeOption {
+	return func(nd *ipfscore.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		gatewayMux, err := corehttp.GatewayOption(n.Resolver, false, nil, authCookie, "", "", writable, paths...)(nd, l, http.NewServeMux())
+		if err != nil {
+			return nil, err
+		}
+		gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.Authenticated && !authorized(r, authCookie, config.Username, config.Password) {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, "403 - Forbidden")
+				return
+			}
+			if p := strings.SplitN(r.URL.Path, "/", 4); len(p) > 2 && p[1] == "ipns" && strings.HasPrefix(p[2], "@") {
+				peerID, err := n.ResolveHandle(p[2])
+				if err != nil {
+					http.Error(w, "Path Resolve error: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				p[2] = peerID
+				r.URL.Path = strings.Join(p, "/")
+			}
+			gatewayMux.ServeHTTP(w, r)
+		})
+		for _, p := range paths {
+			mux.Handle(p+"/", gateway)
+		}
+		return mux, nil
+	}
+}
+
 // Close shutsdown the Gateway listener
 func (g *Gateway) Close() error {
 	log.Infof("server at %s terminating...", g.listener.Addr())
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	mh "gx/ipfs/QmVGtdTZdTFaLsaj2RwdVG8jcjNNcp1DE914DKZ2kHmXHw/go-multihash"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -16,8 +17,6 @@ import (
 	"strings"
 	"time"
 
-	"encoding/hex"
-
 	"crypto/sha256"
 	ps "gx/ipfs/QmXZSd1qR5BxZkPyuwfT5jpqQFScZccoZvDneXsKzCNHWX/go-libp2p-peerstore"
 	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
@@ -50,6 +49,7 @@ type JsonAPIConfig struct {
 	Cors          *string
 	Authenticated bool
 	AllowedIPs    map[string]bool
+	AllowedNets   []*net.IPNet
 	Cookie        http.Cookie
 	Username      string
 	Password      string
@@ -61,10 +61,7 @@ type jsonAPIHandler struct {
 }
 
 func newJsonAPIHandler(node *core.OpenBazaarNode, authCookie http.Cookie, config repo.APIConfig) (*jsonAPIHandler, error) {
-	allowedIPs := make(map[string]bool)
-	for _, ip := range config.AllowedIPs {
-		allowedIPs[ip] = true
-	}
+	allowedIPs, allowedNets := parseAllowedIPs(config.AllowedIPs)
 	i := &jsonAPIHandler{
 		config: JsonAPIConfig{
 			Enabled:       config.Enabled,
@@ -72,6 +69,7 @@ func newJsonAPIHandler(node *core.OpenBazaarNode, authCookie http.Cookie, config
 			Headers:       config.HTTPHeaders,
 			Authenticated: config.Authenticated,
 			AllowedIPs:    allowedIPs,
+			AllowedNets:   allowedNets,
 			Cookie:        authCookie,
 			Username:      config.Username,
 			Password:      config.Password,
@@ -81,6 +79,49 @@ func newJsonAPIHandler(node *core.OpenBazaarNode, authCookie http.Cookie, config
 	return i, nil
 }
 
+// parseAllowedIPs splits the JSON-API allowed IPs into single IPs and CIDR
+// ranges
+func parseAllowedIPs(entries []string) (map[string]bool, []*net.IPNet) {
+	ips := make(map[string]bool)
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		} else if ip := net.ParseIP(entry); ip != nil {
+			// IPv6 addresses have more than one spelling
+			ips[ip.String()] = true
+		} else {
+			ips[entry] = true
+		}
+	}
+	return ips, nets
+}
+
+// ipAllowed reports whether the request from remoteAddr may reach the API.
+// Any IP may when no IPs or ranges are allowed.
+func ipAllowed(ips map[string]bool, nets []*net.IPNet, remoteAddr string) bool {
+	if len(ips) == 0 && len(nets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip != nil {
+		host = ip.String()
+	}
+	if ips[host] {
+		return true
+	}
+	for _, n := range nets {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func (i *jsonAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	u, err := url.Parse(r.URL.Path)
 	if err != nil {
@@ -92,13 +133,10 @@ func (i *jsonAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "403 - Forbidden")
 		return
 	}
-	if len(i.config.AllowedIPs) > 0 {
-		remoteAddr := strings.Split(r.RemoteAddr, ":")
-		if !i.config.AllowedIPs[remoteAddr[0]] {
-			w.WriteHeader(http.StatusForbidden)
-			fmt.Fprint(w, "403 - Forbidden")
-			return
-		}
+	if !ipAllowed(i.config.AllowedIPs, i.config.AllowedNets, r.RemoteAddr) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "403 - Forbidden")
+		return
 	}
 
 	if i.config.Cors != nil {
@@ -111,29 +149,10 @@ func (i *jsonAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header()[k] = v.([]string)
 	}
 
-	if i.config.Authenticated {
-		if i.config.Username == "" || i.config.Password == "" {
-			cookie, err := r.Cookie("OpenBazaar_Auth_Cookie")
-			if err != nil {
-				w.WriteHeader(http.StatusForbidden)
-				fmt.Fprint(w, "403 - Forbidden")
-				return
-			}
-			if i.config.Cookie.Value != cookie.Value {
-				w.WriteHeader(http.StatusForbidden)
-				fmt.Fprint(w, "403 - Forbidden")
-				return
-			}
-		} else {
-			username, password, ok := r.BasicAuth()
-			h := sha256.Sum256([]byte(password))
-			password = hex.EncodeToString(h[:])
-			if !ok || username != i.config.Username || strings.ToLower(password) != strings.ToLower(i.config.Password) {
-				w.WriteHeader(http.StatusForbidden)
-				fmt.Fprint(w, "403 - Forbidden")
-				return
-			}
-		}
+	if i.config.Authenticated && !authorized(r, i.config.Cookie, i.config.Username, i.config.Password) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "403 - Forbidden")
+		return
 	}
 
 	// Stop here if its Preflighted OPTIONS request
@@ -1126,7 +1145,7 @@ func (i *jsonAPIHandler) GETFollowers(w http.ResponseWriter, r *http.Request) {
 		SanitizedResponse(w, string(ret))
 	} else {
 		if strings.HasPrefix(peerId, "@") {
-			peerId, err = i.node.Resolver.Resolve(peerId)
+			peerId, err = i.node.ResolveHandle(peerId)
 			if err != nil {
 				ErrorResponse(w, http.StatusNotFound, err.Error())
 				return
@@ -1186,7 +1205,7 @@ func (i *jsonAPIHandler) GETFollowing(w http.ResponseWriter, r *http.Request) {
 		SanitizedResponse(w, string(ret))
 	} else {
 		if strings.HasPrefix(peerId, "@") {
-			peerId, err = i.node.Resolver.Resolve(peerId)
+			peerId, err = i.node.ResolveHandle(peerId)
 			if err != nil {
 				ErrorResponse(w, http.StatusNotFound, err.Error())
 				return
@@ -1334,7 +1353,7 @@ func (i *jsonAPIHandler) GETListings(w http.ResponseWriter, r *http.Request) {
 		SanitizedResponse(w, string(listingsBytes))
 	} else {
 		if strings.HasPrefix(peerId, "@") {
-			peerId, err = i.node.Resolver.Resolve(peerId)
+			peerId, err = i.node.ResolveHandle(peerId)
 			if err != nil {
 				ErrorResponse(w, http.StatusNotFound, err.Error())
 				return
@@ -1417,7 +1436,7 @@ func (i *jsonAPIHandler) GETListing(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
 		} else {
 			if strings.HasPrefix(peerId, "@") {
-				peerId, err = i.node.Resolver.Resolve(peerId)
+				peerId, err = i.node.ResolveHandle(peerId)
 				if err != nil {
 					ErrorResponse(w, http.StatusNotFound, err.Error())
 					return
@@ -1469,7 +1488,7 @@ func (i *jsonAPIHandler) GETProfile(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		if strings.HasPrefix(peerId, "@") {
-			peerId, err = i.node.Resolver.Resolve(peerId)
+			peerId, err = i.node.ResolveHandle(peerId)
 			if err != nil {
 				ErrorResponse(w, http.StatusNotFound, err.Error())
 				return
@@ -1700,7 +1719,7 @@ func (i *jsonAPIHandler) GETModerators(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.Background()
 	if !async {
-		removeDuplicates := func(xs []string) {
+		removeDuplicates := func(xs []string) []string {
 			found := make(map[string]bool)
 			j := 0
 			for i, x := range xs {
@@ -1710,14 +1729,14 @@ func (i *jsonAPIHandler) GETModerators(w http.ResponseWriter, r *http.Request) {
 					j++
 				}
 			}
-			xs = (xs)[:j]
+			return (xs)[:j]
 		}
 		peerInfoList, err := ipfs.FindPointers(i.node.IpfsNode.Routing.(*routing.IpfsDHT), ctx, core.ModeratorPointerID, 64)
 		if err != nil {
 			ErrorResponse(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		var mods []string
+		mods := append([]string{}, i.node.TrustedModerators...)
 		for _, p := range peerInfoList {
 			id, err := core.ExtractIDFromPointer(p)
 			if err != nil {
@@ -1726,7 +1745,7 @@ func (i *jsonAPIHandler) GETModerators(w http.ResponseWriter, r *http.Request) {
 			mods = append(mods, id)
 		}
 		var resp string
-		removeDuplicates(mods)
+		mods = removeDuplicates(mods)
 		if strings.ToLower(include) == "profile" {
 			var withProfiles []string
 			var wg sync.WaitGroup
@@ -1803,6 +1822,41 @@ func (i *jsonAPIHandler) GETModerators(w http.ResponseWriter, r *http.Request) {
 			peerChan := ipfs.FindPointersAsync(i.node.IpfsNode.Routing.(*routing.IpfsDHT), ctx, core.ModeratorPointerID, 64)
 
 			found := make(map[string]bool)
+			send := func(pid string) {
+				if strings.ToLower(include) == "profile" {
+					profile, err := i.node.FetchProfile(pid, false)
+					if err != nil {
+						return
+					}
+					resp := pb.PeerAndProfileWithID{id, pid, &profile}
+					m := jsonpb.Marshaler{
+						EnumsAsInts:  false,
+						EmitDefaults: true,
+						Indent:       "    ",
+						OrigName:     false,
+					}
+					respJson, err := m.MarshalToString(&resp)
+					if err != nil {
+						return
+					}
+					b, err := SanitizeProtobuf(respJson, new(pb.PeerAndProfileWithID))
+					if err != nil {
+						return
+					}
+					i.node.Broadcast <- b
+				} else {
+					resp := wsResp{id, pid}
+					respJson, err := json.MarshalIndent(resp, "", "    ")
+					if err != nil {
+						return
+					}
+					i.node.Broadcast <- []byte(respJson)
+				}
+			}
+			for _, pid := range i.node.TrustedModerators {
+				found[pid] = true
+				go send(pid)
+			}
 			for p := range peerChan {
 				go func(pi ps.PeerInfo) {
 					pid, err := core.ExtractIDFromPointer(pi)
@@ -1811,35 +1865,7 @@ func (i *jsonAPIHandler) GETModerators(w http.ResponseWriter, r *http.Request) {
 					}
 					if !found[pid] {
 						found[pid] = true
-						if strings.ToLower(include) == "profile" {
-							profile, err := i.node.FetchProfile(pid, false)
-							if err != nil {
-								return
-							}
-							resp := pb.PeerAndProfileWithID{id, pid, &profile}
-							m := jsonpb.Marshaler{
-								EnumsAsInts:  false,
-								EmitDefaults: true,
-								Indent:       "    ",
-								OrigName:     false,
-							}
-							respJson, err := m.MarshalToString(&resp)
-							if err != nil {
-								return
-							}
-							b, err := SanitizeProtobuf(respJson, new(pb.PeerAndProfileWithID))
-							if err != nil {
-								return
-							}
-							i.node.Broadcast <- b
-						} else {
-							resp := wsResp{id, pid}
-							respJson, err := json.MarshalIndent(resp, "", "    ")
-							if err != nil {
-								return
-							}
-							i.node.Broadcast <- []byte(respJson)
-						}
+						send(pid)
 					}
 				}(p)
 			}
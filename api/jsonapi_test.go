@@ -220,3 +220,24 @@ func Test404(t *testing.T) {
 		{"DELETE", "/ob/a", "{}", 404, notFoundJSON},
 	})
 }
+
+func TestIPAllowed(t *testing.T) {
+	ips, nets := parseAllowedIPs([]string{"127.0.0.1", "0:0::1", "10.0.0.0/8", "fd00::/8"})
+	for remoteAddr, allowed := range map[string]bool{
+		"127.0.0.1:4002":   true,
+		"127.0.0.2:4002":   false,
+		"10.1.2.3:4002":    true,
+		"[::1]:4002":       true,
+		"[fd12::1]:4002":   true,
+		"[fe80::1]:4002":   false,
+		"[::ffff:a]:4002":  false,
+		"192.168.0.1:4002": false,
+	} {
+		if ipAllowed(ips, nets, remoteAddr) != allowed {
+			t.Errorf("Expected %s to be allowed: %t", remoteAddr, allowed)
+		}
+	}
+	if !ipAllowed(map[string]bool{}, nil, "[fe80::1]:4002") {
+		t.Error("Expected any IP to be allowed without an allow-list")
+	}
+}
@@ -1,15 +1,13 @@
 package api
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"github.com/OpenBazaar/openbazaar-go/core"
 	"github.com/OpenBazaar/openbazaar-go/repo"
 	"github.com/gorilla/websocket"
 	"github.com/ipfs/go-ipfs/commands"
+	"net"
 	"net/http"
-	"strings"
 )
 
 type connection struct {
@@ -62,6 +60,7 @@ type wsHandler struct {
 	enabled       bool
 	authenticated bool
 	allowedIPs    map[string]bool
+	allowedNets   []*net.IPNet
 	cookie        http.Cookie
 	username      string
 	password      string
@@ -70,10 +69,7 @@ type wsHandler struct {
 func newWSAPIHandler(node *core.OpenBazaarNode, ctx commands.Context, authCookie http.Cookie, config repo.APIConfig) (*wsHandler, error) {
 	hub := newHub()
 	go hub.run()
-	allowedIps := make(map[string]bool)
-	for _, ip := range config.AllowedIPs {
-		allowedIps[ip] = true
-	}
+	allowedIps, allowedNets := parseAllowedIPs(config.AllowedIPs)
 	handler = wsHandler{
 		h:             hub,
 		path:          ctx.ConfigRoot,
@@ -81,6 +77,7 @@ func newWSAPIHandler(node *core.OpenBazaarNode, ctx commands.Context, authCookie
 		enabled:       config.Enabled,
 		authenticated: config.Authenticated,
 		allowedIPs:    allowedIps,
+		allowedNets:   allowedNets,
 		cookie:        authCookie,
 		username:      config.Username,
 		password:      config.Password,
@@ -99,37 +96,15 @@ func (wsh wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "403 - Forbidden")
 		return
 	}
-	if len(wsh.allowedIPs) > 0 {
-		remoteAddr := strings.Split(r.RemoteAddr, ":")
-		if !wsh.allowedIPs[remoteAddr[0]] {
-			w.WriteHeader(http.StatusForbidden)
-			fmt.Fprint(w, "403 - Forbidden")
-			return
-		}
+	if !ipAllowed(wsh.allowedIPs, wsh.allowedNets, r.RemoteAddr) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "403 - Forbidden")
+		return
 	}
-	if wsh.authenticated {
-		if wsh.username == "" || wsh.password == "" {
-			cookie, err := r.Cookie("OpenBazaar_Auth_Cookie")
-			if err != nil {
-				w.WriteHeader(http.StatusForbidden)
-				fmt.Fprint(w, "403 - Forbidden")
-				return
-			}
-			if wsh.cookie.Value != cookie.Value {
-				w.WriteHeader(http.StatusForbidden)
-				fmt.Fprint(w, "403 - Forbidden")
-				return
-			}
-		} else {
-			username, password, ok := r.BasicAuth()
-			h := sha256.Sum256([]byte(password))
-			password = hex.EncodeToString(h[:])
-			if !ok || username != wsh.username || strings.ToLower(password) != strings.ToLower(wsh.password) {
-				w.WriteHeader(http.StatusForbidden)
-				fmt.Fprint(w, "403 - Forbidden")
-				return
-			}
-		}
+	if wsh.authenticated && !authorized(r, wsh.cookie, wsh.username, wsh.password) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "403 - Forbidden")
+		return
 	}
 	c := &connection{send: make(chan []byte, 256), ws: ws, h: wsh.h}
 	c.h.register <- c
@@ -78,6 +78,13 @@ type OpenBazaarNode struct {
 	// Used to resolve blockchainIDs to OpenBazaar IDs
 	Resolver *bstk.BlockstackClient
 
+	// Tried in order by ResolveHandle when Resolver fails
+	FallbackResolvers []*bstk.BlockstackClient
+
+	// Peer IDs of the moderators trusted since init, which are offered to
+	// buyers ahead of those found on the network
+	TrustedModerators []string
+
 	// A service that periodically fetches and caches the bitcoin exchange rates
 	ExchangeRates bitcoin.ExchangeRates
 
@@ -120,6 +127,22 @@ func (n *OpenBazaarNode) SeedNode() error {
 	return nil
 }
 
+// ResolveHandle resolves a blockchainID to an OpenBazaar ID with Resolver,
+// failing over to each of the FallbackResolvers in turn. If none resolves it
+// the error is Resolver's.
+func (n *OpenBazaarNode) ResolveHandle(handle string) (string, error) {
+	peerID, err := n.Resolver.Resolve(handle)
+	if err == nil {
+		return peerID, nil
+	}
+	for _, resolver := range n.FallbackResolvers {
+		if peerID, ferr := resolver.Resolve(handle); ferr == nil {
+			return peerID, nil
+		}
+	}
+	return "", err
+}
+
 func (n *OpenBazaarNode) publish(hash string) {
 	if inflightPublishRequests == 0 {
 		n.Broadcast <- notifications.StatusNotification{"publishing"}
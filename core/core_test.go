@@ -0,0 +1,42 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bstk "github.com/OpenBazaar/go-blockstackclient"
+)
+
+const resolvedPeerID = "QmUZRGLhcKXF1JyuaHgKm23LvqcoMYwtb9jmh8CkP4og3K"
+
+func TestResolveHandleFailover(t *testing.T) {
+	resolver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/users/alice" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"alice": {"profile": {"account": [{"service": "openbazaar", "identifier": %q}]}}}`, resolvedPeerID)
+	}))
+	defer resolver.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	n := &OpenBazaarNode{
+		Resolver:          bstk.NewBlockStackClient(down.URL, nil),
+		FallbackResolvers: []*bstk.BlockstackClient{bstk.NewBlockStackClient(resolver.URL, nil)},
+	}
+	peerID, err := n.ResolveHandle("@alice")
+	if err != nil || peerID != resolvedPeerID {
+		t.Errorf("Expected the fallback resolver to resolve the handle to %s, got %q, %v", resolvedPeerID, peerID, err)
+	}
+	if _, err := n.ResolveHandle("@bob"); err == nil {
+		t.Error("Expected an error for a handle no resolver knows")
+	}
+
+	n.FallbackResolvers = nil
+	if _, err := n.ResolveHandle("@alice"); err == nil {
+		t.Error("Expected an error without a resolver that is up")
+	}
+}
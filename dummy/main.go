@@ -337,9 +337,9 @@ func newWallet(repoPath string, db *db.SQLiteDatastore) (*spvwallet.SPVWallet, e
 		Mnemonic:  mn,
 		UserAgent: "OpenBazaar",
 		RepoPath:  repoPath,
-		LowFee:    uint64(walletCfg.LowFeeDefault),
-		MediumFee: uint64(walletCfg.MediumFeeDefault),
-		HighFee:   uint64(walletCfg.HighFeeDefault),
+		LowFee:    uint64(walletCfg.Fees[repo.CoinTypeBitcoin].Low),
+		MediumFee: uint64(walletCfg.Fees[repo.CoinTypeBitcoin].Medium),
+		HighFee:   uint64(walletCfg.Fees[repo.CoinTypeBitcoin].High),
 		MaxFee:    uint64(walletCfg.MaxFee),
 		Logger:    ml,
 	}
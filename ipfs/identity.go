@@ -5,6 +5,9 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"github.com/ipfs/go-ipfs/repo/config"
 	libp2p "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
 	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
@@ -31,9 +34,70 @@ func IdentityFromKey(privkey []byte) (config.Identity, error) {
 	return ident, nil
 }
 
+// PublicKeyEncodings holds the public half of an identity key in the forms
+// other tools expect it in. Base64 and Hex both encode the protobuf-marshalled
+// public key, which libp2p's UnmarshalPublicKey reads back.
+type PublicKeyEncodings struct {
+	PeerID string
+	Base64 string
+	Hex    string
+}
+
+// PublicKeyEncodingsFromKey returns the public key encodings of the marshalled
+// private key privkey
+func PublicKeyEncodingsFromKey(privkey []byte) (PublicKeyEncodings, error) {
+	var enc PublicKeyEncodings
+	sk, err := libp2p.UnmarshalPrivateKey(privkey)
+	if err != nil {
+		return enc, err
+	}
+	pkbytes, err := libp2p.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return enc, err
+	}
+	id, err := peer.IDFromPublicKey(sk.GetPublic())
+	if err != nil {
+		return enc, err
+	}
+	enc.PeerID = id.Pretty()
+	enc.Base64 = base64.StdEncoding.EncodeToString(pkbytes)
+	enc.Hex = hex.EncodeToString(pkbytes)
+	return enc, nil
+}
+
+// KeyTypeFromKey returns the type of the marshalled private key privkey:
+// Ed25519, RSA or Secp256k1
+func KeyTypeFromKey(privkey []byte) (string, error) {
+	sk, err := libp2p.UnmarshalPrivateKey(privkey)
+	if err != nil {
+		return "", err
+	}
+	switch sk.(type) {
+	case *libp2p.Ed25519PrivateKey:
+		return "Ed25519", nil
+	case *libp2p.RsaPrivateKey:
+		return "RSA", nil
+	case *libp2p.Secp256k1PrivateKey:
+		return "Secp256k1", nil
+	}
+	return "", errors.New("Unknown private key type")
+}
+
 func IdentityKeyFromSeed(seed []byte, bits int) ([]byte, error) {
+	return IdentityKeyFromSeedIndex(seed, bits, 0)
+}
+
+// IdentityKeyFromSeedIndex derives one of several identity keys from seed, so
+// a single mnemonic can back several nodes. Index 0 is the key derived by
+// IdentityKeyFromSeed. Other indices are appended to the seed big endian.
+func IdentityKeyFromSeedIndex(seed []byte, bits int, index uint32) ([]byte, error) {
 	hmac := hmac.New(sha256.New, []byte("OpenBazaar seed"))
 	hmac.Write(seed)
+	if index != 0 {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, index)
+		hmac.Write(b)
+	}
 	reader := bytes.NewReader(hmac.Sum(nil))
 	sk, _, err := libp2p.GenerateKeyPairWithReader(libp2p.Ed25519, bits, reader)
 	if err != nil {
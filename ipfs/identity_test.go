@@ -2,9 +2,11 @@ package ipfs
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/hex"
 	"github.com/tyler-smith/go-bip39"
 	"gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
 	"testing"
 )
 
@@ -31,6 +33,63 @@ func TestIdentityFromKey(t *testing.T) {
 	}
 }
 
+func TestPublicKeyEncodingsFromKey(t *testing.T) {
+	keyBytes, err := hex.DecodeString(keyHex)
+	if err != nil {
+		t.Error(err)
+	}
+	sk, err := crypto.UnmarshalPrivateKey(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := PublicKeyEncodingsFromKey(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := peer.IDB58Decode(enc.PeerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.MatchesPrivateKey(sk) {
+		t.Error("Peer ID does not match the private key")
+	}
+	b64, err := base64.StdEncoding.DecodeString(enc.Base64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hexBytes, err := hex.DecodeString(enc.Hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range map[string][]byte{"base64": b64, "hex": hexBytes} {
+		pk, err := crypto.UnmarshalPublicKey(b)
+		if err != nil {
+			t.Fatalf("Unmarshalling the %s key: %s", name, err)
+		}
+		if !pk.Equals(sk.GetPublic()) {
+			t.Errorf("The %s key does not decode to the identity's public key", name)
+		}
+	}
+}
+
+func TestKeyTypeFromKey(t *testing.T) {
+	keyBytes, err := hex.DecodeString(keyHex)
+	if err != nil {
+		t.Error(err)
+	}
+	keyType, err := KeyTypeFromKey(keyBytes)
+	if err != nil {
+		t.Error(err)
+	}
+	if keyType != "Ed25519" {
+		t.Error("Incorrect key type returned", keyType)
+	}
+	if _, err := KeyTypeFromKey([]byte("garbage")); err == nil {
+		t.Error("Expected an error for a malformed key")
+	}
+}
+
 func TestIdentityKeyFromSeed(t *testing.T) {
 	seed := bip39.NewSeed("mule track design catch stairs remain produce evidence cannon opera hamster burst", "Secret Passphrase")
 	key, err := IdentityKeyFromSeed(seed, 4096)
@@ -45,3 +104,32 @@ func TestIdentityKeyFromSeed(t *testing.T) {
 		t.Error("Failed to extract correct private key from seed")
 	}
 }
+
+func TestIdentityKeyFromSeedIndex(t *testing.T) {
+	seed := bip39.NewSeed("mule track design catch stairs remain produce evidence cannon opera hamster burst", "Secret Passphrase")
+	keyBytes, err := hex.DecodeString(keyHex)
+	if err != nil {
+		t.Error(err)
+	}
+	key, err := IdentityKeyFromSeedIndex(seed, 4096, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(key, keyBytes) {
+		t.Error("Index 0 did not derive the legacy private key")
+	}
+	first, err := IdentityKeyFromSeedIndex(seed, 4096, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	second, err := IdentityKeyFromSeedIndex(seed, 4096, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Equal(first, keyBytes) {
+		t.Error("Index 1 derived the same private key as index 0")
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("Index 1 did not derive the same private key twice")
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strconv"
 
@@ -24,8 +23,6 @@ import (
 	"net/url"
 	"strings"
 
-	"crypto/sha256"
-	"encoding/hex"
 	bstk "github.com/OpenBazaar/go-blockstackclient"
 	"github.com/OpenBazaar/openbazaar-go/api"
 	"github.com/OpenBazaar/openbazaar-go/bitcoin"
@@ -59,7 +56,6 @@ import (
 	dht "github.com/ipfs/go-ipfs/routing/dht/util"
 	"github.com/ipfs/go-ipfs/thirdparty/ds-help"
 	"github.com/jessevdk/go-flags"
-	"github.com/mitchellh/go-homedir"
 	"github.com/natefinch/lumberjack"
 	"github.com/op/go-logging"
 	"golang.org/x/crypto/ssh/terminal"
@@ -95,8 +91,10 @@ type Init struct {
 	Password           string `short:"p" long:"password" description:"the encryption password if the database is to be encrypted"`
 	DataDir            string `short:"d" long:"datadir" description:"specify the data directory to be used"`
 	Mnemonic           string `short:"m" long:"mnemonic" description:"specify a mnemonic seed to use to derive the keychain"`
+	MnemonicEnv        string `long:"mnemonicenv" description:"read the mnemonic seed from this environment variable instead of the command line"`
+	MnemonicFile       string `long:"mnemonicfile" description:"read the mnemonic seed from this file or file descriptor, such as /dev/fd/3"`
 	Testnet            bool   `short:"t" long:"testnet" description:"use the test network"`
-	Force              bool   `short:"f" long:"force" description:"force overwrite existing repo (dangerous!)"`
+	Force              bool   `short:"f" long:"force" description:"reinitialize an existing repo, backing up its keys first"`
 	WalletCreationDate string `short:"w" long:"walletcreationdate" description:"specify the date the seed was created. if omitted the wallet will sync from the oldest checkpoint."`
 }
 type Status struct {
@@ -163,6 +161,7 @@ func main() {
 			os.Exit(1)
 		}
 	}()
+	repo.BinaryVersion = core.VERSION
 	parser.AddCommand("init",
 		"initialize a new repo and exit",
 		"Initializes a new repo without starting the server",
@@ -272,8 +271,10 @@ func (x *SetAPICreds) Execute(args []string) error {
 		apiCfg.Username = strings.Replace(username, "\n", "", -1)
 	}
 	apiCfg.Authenticated = true
-	h := sha256.Sum256([]byte(pw))
-	apiCfg.Password = hex.EncodeToString(h[:])
+	apiCfg.Password, err = repo.HashAPIPassword(pw)
+	if err != nil {
+		return err
+	}
 	if len(apiCfg.AllowedIPs) == 0 {
 		apiCfg.AllowedIPs = []string{}
 	}
@@ -349,7 +350,24 @@ func (x *Init) Execute(args []string) error {
 	if x.Password != "" {
 		x.Password = strings.Replace(x.Password, "'", "''", -1)
 	}
+	var mnemonicSource repo.MnemonicSource
+	if x.MnemonicEnv != "" {
+		mnemonicSource = repo.EnvMnemonic(x.MnemonicEnv)
+	} else if x.MnemonicFile != "" {
+		mnemonicSource = repo.FileMnemonic(x.MnemonicFile)
+	}
+	if x.Mnemonic == "" && mnemonicSource != nil {
+		x.Mnemonic, err = mnemonicSource.ReadMnemonic()
+		if err != nil {
+			return err
+		}
+	}
 	creationDate := time.Now()
+	if x.Mnemonic != "" {
+		// A restored seed may be older than the node, so sync from the oldest
+		// checkpoint unless told otherwise
+		creationDate = time.Time{}
+	}
 	if x.WalletCreationDate != "" {
 		creationDate, err = time.Parse(time.RFC3339, x.WalletCreationDate)
 		if err != nil {
@@ -357,23 +375,21 @@ func (x *Init) Execute(args []string) error {
 		}
 	}
 
-	_, err = initializeRepo(repoPath, x.Password, x.Mnemonic, x.Testnet, creationDate)
-	if err == repo.ErrRepoExists && x.Force {
+	if x.Force && fsrepo.IsInitialized(repoPath) {
 		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Force overwriting the db will destroy your existing keys and history. Are you really, really sure you want to continue? (y/n): ")
+		fmt.Print("Force overwriting the db will replace your existing keys and history. They will be backed up first. Are you really, really sure you want to continue? (y/n): ")
 		resp, _ := reader.ReadString('\n')
-		if strings.ToLower(resp) == "y\n" || strings.ToLower(resp) == "yes\n" {
-			os.RemoveAll(repoPath)
-			_, err = initializeRepo(repoPath, x.Password, x.Mnemonic, x.Testnet, creationDate)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("OpenBazaar repo initialized at %s\n", repoPath)
-			return nil
-		} else {
+		if strings.ToLower(resp) != "y\n" && strings.ToLower(resp) != "yes\n" {
 			return nil
 		}
-	} else if err != nil {
+		backupDir, err := forceInitializeRepo(repoPath, x.Password, x.Mnemonic, x.Testnet, creationDate)
+		if err != nil {
+			return err
+		}
+		if backupDir != "" {
+			fmt.Printf("The previous keys were backed up to %s\n", backupDir)
+		}
+	} else if _, err = initializeRepo(repoPath, x.Password, x.Mnemonic, x.Testnet, creationDate); err != nil {
 		return err
 	}
 	fmt.Printf("OpenBazaar repo initialized at %s\n", repoPath)
@@ -414,12 +430,49 @@ func (x *Start) Execute(args []string) error {
 		return err
 	}
 
+	// Refuse to mix a testnet repo with mainnet wallets and vice versa. Repos
+	// created before the flag was recorded are trusted.
+	if repoTestnet, err := repo.IsTestnet(repoPath); err == nil && repoTestnet != isTestnet {
+		return fmt.Errorf("Repo at %s was initialized with testnet set to %t", repoPath, repoTestnet)
+	}
+
+	// Refuse to start on a repo made by a newer version
+	switch err := repo.CheckRepoVersion(repoPath); err {
+	case nil:
+	case repo.ErrRepoTooOld:
+		if err := repo.MigrateRepo(repoPath); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	// Repair directories damaged by external tools and create any missing
+	// from repos made by older versions
+	repairs, err := repo.RepairDirectories(repoPath)
+	for _, r := range repairs {
+		log.Warning("Repaired repo directory: " + r.String())
+	}
+	if err != nil {
+		return err
+	}
+	if err := repo.EnsureDirectories(repoPath); err != nil {
+		return err
+	}
+	if err := repo.UpgradeConfig(repoPath, isTestnet); err != nil {
+		return err
+	}
+
 	// Logging
+	rotation, err := repo.GetLogRotation(repoPath)
+	if err != nil {
+		rotation = &repo.DefaultLogRotation
+	}
 	w := &lumberjack.Logger{
 		Filename:   path.Join(repoPath, "logs", "ob.log"),
-		MaxSize:    10, // Megabytes
-		MaxBackups: 3,
-		MaxAge:     30, // Days
+		MaxSize:    rotation.MaxSize,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAge,
 	}
 	backendStdout := logging.NewLogBackend(os.Stdout, "", 0)
 	backendFile := logging.NewLogBackend(w, "", 0)
@@ -430,9 +483,9 @@ func (x *Start) Execute(args []string) error {
 	ipfslogging.LdJSONFormatter()
 	w2 := &lumberjack.Logger{
 		Filename:   path.Join(repoPath, "logs", "ipfs.log"),
-		MaxSize:    10, // Megabytes
-		MaxBackups: 3,
-		MaxAge:     30, // Days
+		MaxSize:    rotation.MaxSize,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAge,
 	}
 	ipfslogging.Output(w2)()
 
@@ -471,6 +524,9 @@ func (x *Start) Execute(args []string) error {
 		log.Error(err)
 		return err
 	}
+	if apiConfig.Password != "" && repo.IsLegacyAPIPasswordHash(apiConfig.Password) {
+		log.Warning("The JSON-API password is stored as an unsalted hash. Run setapicreds to store a salted one.")
+	}
 	torConfig, err := repo.GetTorConfig(configFile)
 	if err != nil {
 		log.Error(err)
@@ -491,12 +547,23 @@ func (x *Start) Execute(args []string) error {
 		log.Error(err)
 		return err
 	}
-	resolverUrl, err := repo.GetResolverUrl(configFile)
+	resolverUrls, err := repo.GetResolverUrls(configFile)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	trustedModerators, err := repo.GetTrustedModerators(configFile)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
+	// Finish the init of repos provisioned without a keyspace
+	if err := repo.CompletePendingKeyspace(repoPath, sqliteDB.Config()); err != nil {
+		log.Error(err)
+		return err
+	}
+
 	// IPFS node setup
 	r, err := fsrepo.Open(repoPath)
 	if err != nil {
@@ -657,6 +724,10 @@ func (x *Start) Execute(args []string) error {
 		log.Error(err)
 		return err
 	}
+	if err := repo.ConfigureRepublisher(nd); err != nil {
+		log.Error(err)
+		return err
+	}
 
 	ctx := commands.Context{}
 	ctx.Online = true
@@ -740,7 +811,12 @@ func (x *Start) Execute(args []string) error {
 	case "spvwallet":
 		var tp net.Addr
 		if walletCfg.TrustedPeer != "" {
-			tp, err = net.ResolveTCPAddr("tcp", walletCfg.TrustedPeer)
+			addr, err := repo.TrustedPeerAddress(walletCfg.TrustedPeer)
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			tp, err = net.ResolveTCPAddr("tcp", addr)
 			if err != nil {
 				log.Error(err)
 				return err
@@ -751,13 +827,18 @@ func (x *Start) Execute(args []string) error {
 			log.Error(err)
 			return err
 		}
+		fees, ok := walletCfg.Fees[repo.CoinTypeBitcoin]
+		if !ok {
+			log.Warningf("No %s fees in the wallet config, using the defaults", repo.CoinTypeBitcoin)
+			fees = repo.DefaultWalletConfig.Fees[repo.CoinTypeBitcoin]
+		}
 		spvwalletConfig := &spvwallet.Config{
 			Mnemonic:     mn,
 			Params:       &params,
 			MaxFee:       uint64(walletCfg.MaxFee),
-			LowFee:       uint64(walletCfg.LowFeeDefault),
-			MediumFee:    uint64(walletCfg.MediumFeeDefault),
-			HighFee:      uint64(walletCfg.HighFeeDefault),
+			LowFee:       uint64(fees.Low),
+			MediumFee:    uint64(fees.Medium),
+			HighFee:      uint64(fees.High),
 			FeeAPI:       *feeApi,
 			RepoPath:     repoPath,
 			CreationDate: creationDate,
@@ -819,7 +900,7 @@ func (x *Start) Execute(args []string) error {
 
 	// Create authentication cookie
 	var authCookie http.Cookie
-	authCookie.Name = "OpenBazaar_Auth_Cookie"
+	authCookie.Name = repo.AuthCookieName
 
 	if x.AuthCookie != "" {
 		authCookie.Value = x.AuthCookie
@@ -902,6 +983,12 @@ func (x *Start) Execute(args []string) error {
 	}
 	bm := obnet.NewBanManager(blockedNodes)
 
+	// The resolvers after the first are only tried when it fails
+	var fallbackResolvers []*bstk.BlockstackClient
+	for _, resolverUrl := range resolverUrls[1:] {
+		fallbackResolvers = append(fallbackResolvers, bstk.NewBlockStackClient(resolverUrl, torDialer))
+	}
+
 	// OpenBazaar node setup
 	core.Node = &core.OpenBazaarNode{
 		Context:           ctx,
@@ -911,7 +998,9 @@ func (x *Start) Execute(args []string) error {
 		Datastore:         sqliteDB,
 		Wallet:            wallet,
 		MessageStorage:    storage,
-		Resolver:          bstk.NewBlockStackClient(resolverUrl, torDialer),
+		Resolver:          bstk.NewBlockStackClient(resolverUrls[0], torDialer),
+		FallbackResolvers: fallbackResolvers,
+		TrustedModerators: trustedModerators,
 		ExchangeRates:     exchangeRates,
 		CrosspostGateways: gatewayUrls,
 		TorDialer:         torDialer,
@@ -979,6 +1068,58 @@ func initializeRepo(dataDir, password, mnemonic string, testnet bool, creationDa
 	return sqliteDB, nil
 }
 
+// forceInitializeRepo initializes the repo at dataDir like initializeRepo,
+// reinitializing it if it already exists, and returns the directory the
+// previous keys were backed up to
+func forceInitializeRepo(dataDir, password, mnemonic string, testnet bool, creationDate time.Time) (string, error) {
+	dbName := "mainnet.db"
+	if testnet {
+		dbName = "testnet.db"
+	}
+	dbPath := path.Join(dataDir, "datastore", dbName)
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		// The existing database has been copied to the backup directory by
+		// now. Keep it aside until the new one is initialized so a failed
+		// init can put it back.
+		oldPath := dbPath + ".old"
+		moved := false
+		if err := os.Rename(dbPath, oldPath); err == nil {
+			moved = true
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		sqliteDB, err := db.Create(dataDir, password, testnet)
+		if err == nil {
+			err = sqliteDB.Config().Init(mnemonic, identityKey, password, creationDate)
+			sqliteDB.Close()
+		}
+		if err != nil {
+			if moved {
+				os.Rename(oldPath, dbPath)
+			}
+			return err
+		}
+		if moved {
+			os.Remove(oldPath)
+		}
+		return nil
+	}
+	res, err := repo.DoInitOptsResult(context.Background(), repo.InitOptions{
+		RepoRoot:        dataDir,
+		NBitsForKeypair: 4096,
+		Testnet:         testnet,
+		Password:        password,
+		Mnemonic:        mnemonic,
+		CreationDate:    creationDate,
+		Force:           true,
+		DbInit:          dbInit,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.BackupDir, nil
+}
+
 // Prints the addresses of the host
 func printSwarmAddrs(node *ipfscore.IpfsNode) {
 	var addrs []string
@@ -1049,7 +1190,7 @@ func newHTTPGateway(node *core.OpenBazaarNode, authCookie http.Cookie, config re
 		corehttp.CommandsROOption(node.Context),
 		corehttp.VersionOption(),
 		corehttp.IPNSHostnameOption(),
-		corehttp.GatewayOption(node.Resolver, config.Authenticated, config.AllowedIPs, authCookie, config.Username, config.Password, cfg.Gateway.Writable, "/ipfs", "/ipns"),
+		api.GatewayOption(node, authCookie, config, cfg.Gateway.Writable, "/ipfs", "/ipns"),
 	}
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
@@ -1077,31 +1218,10 @@ func newHTTPGateway(node *core.OpenBazaarNode, authCookie http.Cookie, config re
 /* Returns the directory to store repo data in.
    It depends on the OS and whether or not we are on testnet. */
 func getRepoPath(isTestnet bool) (string, error) {
-	// Set default base path and directory name
-	path := "~"
-	directoryName := "OpenBazaar2.0"
-
-	// Override OS-specific names
-	switch runtime.GOOS {
-	case "linux":
-		directoryName = ".openbazaar2.0"
-	case "darwin":
-		path = "~/Library/Application Support"
-	}
-
-	// Append testnet flag if on testnet
 	if isTestnet {
-		directoryName += "-testnet"
+		return repo.DefaultTestnetRepoPath()
 	}
-
-	// Join the path and directory name, then expand the home path
-	fullPath, err := homedir.Expand(filepath.Join(path, directoryName))
-	if err != nil {
-		return "", err
-	}
-
-	// Return the shortest lexical representation of the path
-	return filepath.Clean(fullPath), nil
+	return repo.DefaultRepoPath()
 }
 
 func printSplashScreen() {
@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+var ErrInvalidAllowedIP = errors.New("Allowed IPs must be IP addresses or CIDR ranges")
+
+// SetAPIAllowedIPs replaces the IPs allowed to reach the JSON-API of the repo
+// at repoRoot. Entries are IP addresses or CIDR ranges such as 10.0.0.0/8, and
+// an empty list allows any IP. If any entry is invalid the config is left as
+// it was and the error lists every invalid entry. The config file is replaced
+// atomically, and a running node reads the list when it is restarted.
+func SetAPIAllowedIPs(repoRoot string, ips []string) error {
+	allowed := make([]string, 0, len(ips))
+	var invalid []string
+	for _, entry := range ips {
+		entry = strings.TrimSpace(entry)
+		if !validAllowedIP(entry) {
+			invalid = append(invalid, fmt.Sprintf("%q", entry))
+			continue
+		}
+		allowed = append(allowed, entry)
+	}
+	if len(invalid) > 0 {
+		return wrapErrorf(ErrInvalidAllowedIP, nil, "%s", strings.Join(invalid, ", "))
+	}
+	return extendConfig(fsrepo.Open, repoRoot, []configExtension{{"JSON-API.AllowedIPs", allowed}})
+}
+
+func validAllowedIP(entry string) bool {
+	if net.ParseIP(entry) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(entry)
+	return err == nil
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAllowedIPs(t *testing.T) []string {
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRootFolder, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := GetAPIConfig(cfgBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api.AllowedIPs
+}
+
+func TestSetAPIAllowedIPs(t *testing.T) {
+	if _, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit); err != nil {
+		t.Fatal(err)
+	}
+	defer TearDown()
+
+	if err := SetAPIAllowedIPs(repoRootFolder, []string{"127.0.0.1", " 192.168.1.20 ", "::1"}); err != nil {
+		t.Fatal("SetAPIAllowedIPs threw an unexpected error: ", err)
+	}
+	want := []string{"127.0.0.1", "192.168.1.20", "::1"}
+	if got := readAllowedIPs(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected allowed IPs %v, got %v", want, got)
+	}
+
+	err := SetAPIAllowedIPs(repoRootFolder, []string{"10.0.0.1", "not-an-ip", "10.0.0.0/33"})
+	if !isError(err, ErrInvalidAllowedIP) {
+		t.Fatal("Expected ErrInvalidAllowedIP, got ", err)
+	}
+	if !strings.Contains(err.Error(), `"not-an-ip"`) || !strings.Contains(err.Error(), `"10.0.0.0/33"`) {
+		t.Error("Expected the error to list every invalid entry, got ", err)
+	}
+	if got := readAllowedIPs(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected a rejected list to leave %v, got %v", want, got)
+	}
+}
+
+func TestSetAPIAllowedIPsCIDR(t *testing.T) {
+	if _, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit); err != nil {
+		t.Fatal(err)
+	}
+	defer TearDown()
+
+	want := []string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"}
+	if err := SetAPIAllowedIPs(repoRootFolder, want); err != nil {
+		t.Fatal("SetAPIAllowedIPs threw an unexpected error: ", err)
+	}
+	if got := readAllowedIPs(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected allowed IPs %v, got %v", want, got)
+	}
+
+	if err := SetAPIAllowedIPs(repoRootFolder, nil); err != nil {
+		t.Fatal("SetAPIAllowedIPs threw an unexpected error: ", err)
+	}
+	if got := readAllowedIPs(t); len(got) != 0 {
+		t.Error("Expected an empty list to allow any IP, got ", got)
+	}
+}
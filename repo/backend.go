@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+type openRepoFunc func(repoRoot string) (repo.Repo, error)
+
+type newNodeFunc func(ctx context.Context, r repo.Repo) (*core.IpfsNode, error)
+
+// RepoBackend lets embedders keep the IPFS repo somewhere other than an
+// fsrepo under repoRoot, the same way dbInit lets them bring their own
+// database. Any nil field falls back to fsrepo.
+type RepoBackend struct {
+	// Init writes the initial IPFS config to the backing store
+	Init func(repoRoot string, conf *config.Config) error
+
+	// Open returns the repo written by Init. The caller closes it.
+	Open func(repoRoot string) (repo.Repo, error)
+
+	// IsInitialized reports whether Init has already run for repoRoot
+	IsInitialized func(repoRoot string) bool
+
+	// NewNode builds the node the IPNS keyspace is initialized with from the
+	// newly initialized repo, so that a launch sequence can go on to run the
+	// node rather than init opening and closing a throwaway one. The node is
+	// returned in InitResult.Node. If nil, init uses an offline node of its
+	// own and closes it.
+	NewNode func(ctx context.Context, r repo.Repo) (*core.IpfsNode, error)
+}
+
+// withDefaults returns a copy of b with the fsrepo implementations filled in
+func (b *RepoBackend) withDefaults() *RepoBackend {
+	r := RepoBackend{}
+	if b != nil {
+		r = *b
+	}
+	if r.Init == nil {
+		r.Init = fsrepo.Init
+	}
+	if r.Open == nil {
+		r.Open = fsrepo.Open
+	}
+	if r.IsInitialized == nil {
+		r.IsInitialized = fsrepo.IsInitialized
+	}
+	return &r
+}
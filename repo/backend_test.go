@@ -0,0 +1,292 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	"github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	"github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/namesys"
+	"github.com/ipfs/go-ipfs/pin"
+	ipfsrepo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/config"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	ds "gx/ipfs/QmRWDav6mzWseLWeYfVd5fvUKiVe9xNH29YfMF438fG364/go-datastore"
+	dsq "gx/ipfs/QmRWDav6mzWseLWeYfVd5fvUKiVe9xNH29YfMF438fG364/go-datastore/query"
+	dsync "gx/ipfs/QmRWDav6mzWseLWeYfVd5fvUKiVe9xNH29YfMF438fG364/go-datastore/sync"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+)
+
+// memRepo is an IPFS repo kept entirely in memory
+type memRepo struct {
+	ipfsrepo.Mock
+	keys        map[string]interface{}
+	initialized bool
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{
+		Mock: ipfsrepo.Mock{D: dsync.MutexWrap(ds.NewMapDatastore())},
+		keys: make(map[string]interface{}),
+	}
+}
+
+func (m *memRepo) SetConfigKey(key string, value interface{}) error {
+	m.keys[key] = value
+	return nil
+}
+
+func (m *memRepo) GetConfigKey(key string) (interface{}, error) {
+	return m.keys[key], nil
+}
+
+func (m *memRepo) Close() error { return nil }
+
+func (m *memRepo) backend() *RepoBackend {
+	return &RepoBackend{
+		Init: func(repoRoot string, conf *config.Config) error {
+			m.C = *conf
+			m.initialized = true
+			return nil
+		},
+		Open:          func(repoRoot string) (ipfsrepo.Repo, error) { return m, nil },
+		IsInitialized: func(repoRoot string) bool { return m.initialized },
+	}
+}
+
+func TestDoInitWithBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newMemRepo()
+	res, err := DoInitWithBackend(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	}, m.backend())
+	if err != nil {
+		t.Fatal("DoInitWithBackend threw an unexpected error", err)
+	}
+	if res.PeerID == "" {
+		t.Error("Expected a peer ID")
+	}
+	if !m.initialized {
+		t.Error("Expected the backend to be initialized")
+	}
+	if _, ok := m.keys["Wallet"]; !ok {
+		t.Error("Expected the config extensions to be written to the backend")
+	}
+	for _, name := range []string{"config", "datastore", "blocks", "keystore", "repo.lock"} {
+		if _, err := os.Stat(path.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be written to disk", name)
+		}
+	}
+
+	_, err = DoInitWithBackend(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	}, m.backend())
+	if err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists, got ", err)
+	}
+}
+
+// hasKeyspace reports whether the IPNS record of peerID is in r's datastore
+func hasKeyspace(t *testing.T, r ipfsrepo.Repo, peerID string) bool {
+	id, err := peer.IDB58Decode(peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ipnsKey := namesys.IpnsKeysForID(id)
+	has, err := r.Datastore().Has(dshelp.NewKeyFromBinary([]byte(ipnsKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return has
+}
+
+func TestDoInitKeyspaceNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Standalone, init builds and closes its own node
+	m := newMemRepo()
+	res, err := DoInitWithBackend(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	}, m.backend())
+	if err != nil {
+		t.Fatal("DoInitWithBackend threw an unexpected error", err)
+	}
+	if res.Node != nil {
+		t.Error("Expected no node to be returned without NewNode")
+	}
+	if !hasKeyspace(t, m, res.PeerID) {
+		t.Error("Expected the keyspace to be initialized by the standalone node")
+	}
+
+	// Injected, the caller's node is used and left running
+	m = newMemRepo()
+	b := m.backend()
+	var built *core.IpfsNode
+	b.NewNode = func(ctx context.Context, r ipfsrepo.Repo) (*core.IpfsNode, error) {
+		if built != nil {
+			t.Error("Expected NewNode to be called once")
+		}
+		nd, err := core.NewNode(ctx, &core.BuildCfg{Repo: r})
+		if err != nil {
+			return nil, err
+		}
+		built = nd
+		return nd, nd.SetupOfflineRouting()
+	}
+	res, err = DoInitWithBackend(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	}, b)
+	if err != nil {
+		t.Fatal("DoInitWithBackend threw an unexpected error", err)
+	}
+	if res.Node == nil || res.Node != built {
+		t.Fatal("Expected the node built by NewNode to be returned")
+	}
+	defer res.Node.Close()
+	if res.Node.Context().Err() != nil {
+		t.Error("Expected the returned node to still be running")
+	}
+	if res.Node.Identity.Pretty() != res.PeerID {
+		t.Errorf("Expected the node to have the new identity %s, got %s", res.PeerID, res.Node.Identity.Pretty())
+	}
+	if !hasKeyspace(t, m, res.PeerID) {
+		t.Error("Expected the keyspace to be initialized by the injected node")
+	}
+}
+
+func TestDoInitLeavesOnlyKeyspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newMemRepo()
+	res, err := DoInitWithBackend(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	}, m.backend())
+	if err != nil {
+		t.Fatal("DoInitWithBackend threw an unexpected error", err)
+	}
+
+	id, err := peer.IDB58Decode(res.PeerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkKey, ipnsKey := namesys.IpnsKeysForID(id)
+	bs := blockstore.NewBlockstore(m.D)
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	pinner, err := pin.LoadPinner(m.D, dag, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[ds.Key]bool{
+		dshelp.NewKeyFromBinary([]byte(pkKey)):                                   true,
+		dshelp.NewKeyFromBinary([]byte(ipnsKey)):                                 true,
+		ds.NewKey("/local/pins"):                                                 true,
+		blockstore.BlockPrefix.Child(dshelp.CidToDsKey(ft.EmptyDirNode().Cid())): true,
+	}
+	for _, c := range pinner.InternalPins() {
+		expected[blockstore.BlockPrefix.Child(dshelp.CidToDsKey(c))] = true
+	}
+
+	q, err := m.D.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := q.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !expected[ds.NewKey(e.Key)] {
+			t.Errorf("Expected no datastore entry %s after init", e.Key)
+		}
+		delete(expected, ds.NewKey(e.Key))
+	}
+	for k := range expected {
+		t.Errorf("Expected datastore entry %s after init", k)
+	}
+}
+
+// tamperedRepo writes a malformed value for one config section
+type tamperedRepo struct {
+	*memRepo
+	section string
+}
+
+func (t *tamperedRepo) SetConfigKey(key string, value interface{}) error {
+	if key == t.section {
+		value = "malformed"
+	}
+	return t.memRepo.SetConfigKey(key, value)
+}
+
+func TestDoInitVerifiesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, section := range []string{"Wallet", "JSON-API", "Testnet"} {
+		m := newMemRepo()
+		tampered := &tamperedRepo{m, section}
+		b := m.backend()
+		b.Open = func(string) (ipfsrepo.Repo, error) { return tampered, nil }
+		_, err := DoInitWithBackend(context.Background(), InitOptions{
+			RepoRoot:        dir,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			DbInit:          MockDbInit,
+		}, b)
+		if !isError(err, ErrConfigWrite) || !strings.Contains(err.Error(), section+" section is malformed") {
+			t.Errorf("Expected the malformed %s section to be caught, got %v", section, err)
+		}
+	}
+}
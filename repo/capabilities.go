@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+)
+
+// capabilitiesFile is served with the rest of root over IPNS so peers and the
+// GUI can read what the node supports without probing it
+var capabilitiesFile = path.Join("root", "capabilities.json")
+
+// capabilitiesVersion is the version of the Capabilities format. Bump it when
+// a field changes meaning or is removed.
+const capabilitiesVersion = 1
+
+// capabilityConfigKeys are the config sections the capabilities are read from
+var capabilityConfigKeys = map[string]bool{"Wallet": true, "Testnet": true}
+
+// Capabilities is the manifest of what a node supports. Coins are the coin
+// types the wallet has fee tiers for.
+type Capabilities struct {
+	Version     int      `json:"version"`
+	RepoVersion int      `json:"repoVersion"`
+	WalletType  string   `json:"walletType"`
+	Coins       []string `json:"coins"`
+	Testnet     bool     `json:"testnet"`
+}
+
+// GetCapabilities returns the capabilities manifest of the repo at repoRoot
+func GetCapabilities(repoRoot string) (*Capabilities, error) {
+	b, err := ioutil.ReadFile(path.Join(repoRoot, capabilitiesFile))
+	if err != nil {
+		return nil, err
+	}
+	c := new(Capabilities)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// writeCapabilities writes the capabilities manifest from the config document
+// cfgBytes and the repo version recorded in repoRoot
+func writeCapabilities(repoRoot string, cfgBytes []byte) error {
+	var cfg struct {
+		Wallet  WalletConfig
+		Testnet bool
+	}
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return MalformedConfigError
+	}
+	repoVersion, err := GetRepoVersion(repoRoot)
+	if err != nil {
+		return err
+	}
+
+	c := Capabilities{
+		Version:     capabilitiesVersion,
+		RepoVersion: repoVersion,
+		WalletType:  cfg.Wallet.Type,
+		Testnet:     cfg.Testnet,
+	}
+	for coin := range cfg.Wallet.Fees {
+		c.Coins = append(c.Coins, coin)
+	}
+	if len(c.Coins) == 0 {
+		// Configs written before fees were kept per coin are Bitcoin's
+		c.Coins = []string{CoinTypeBitcoin}
+	}
+	sort.Strings(c.Coins)
+	b, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(repoRoot, capabilitiesFile), b, 0644)
+}
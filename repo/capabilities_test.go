@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDoInitCapabilities(t *testing.T) {
+	for _, test := range []struct {
+		walletType string
+		testnet    bool
+	}{
+		{"spvwallet", true},
+		{"bitcoind", false},
+	} {
+		overrides := &ConfigOverrides{Wallet: &WalletConfig{Type: test.walletType}}
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         test.testnet,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if err != nil {
+			t.Fatalf("DoInitOpts threw an unexpected error: %s", err.Error())
+		}
+		b, err := ioutil.ReadFile(path.Join(repoRootFolder, capabilitiesFile))
+		if err != nil {
+			t.Fatal("Expected a capabilities manifest: ", err)
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatalf("Expected the capabilities manifest to be valid JSON, got %s", b)
+		}
+		c, err := GetCapabilities(repoRootFolder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Capabilities{
+			Version:     capabilitiesVersion,
+			RepoVersion: RepoVersion,
+			WalletType:  test.walletType,
+			Coins:       []string{CoinTypeBitcoin},
+			Testnet:     test.testnet,
+		}
+		if !reflect.DeepEqual(*c, expected) {
+			t.Errorf("Expected capabilities %+v, got %+v", expected, *c)
+		}
+		TearDown()
+	}
+}
+
+func TestUpgradeConfigRegeneratesCapabilities(t *testing.T) {
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       &ConfigOverrides{Wallet: &WalletConfig{Type: "bitcoind"}},
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer TearDown()
+
+	// Drop the wallet as if the repo predated it
+	configPath := path.Join(repoRootFolder, "config")
+	cfgBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	delete(cfg, "Wallet")
+	if cfgBytes, err = json.Marshal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, cfgBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpgradeConfig(repoRootFolder, true); err != nil {
+		t.Fatal("UpgradeConfig threw an unexpected error", err)
+	}
+	c, err := GetCapabilities(repoRootFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.WalletType != DefaultWalletConfig.Type || !c.Testnet {
+		t.Errorf("Expected the capabilities to reflect the added wallet, got %+v", *c)
+	}
+
+	// Nothing relevant is added the second time so the manifest is left alone
+	if err := os.Remove(path.Join(repoRootFolder, capabilitiesFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpgradeConfig(repoRootFolder, true); err != nil {
+		t.Fatal("UpgradeConfig threw an unexpected error", err)
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, capabilitiesFile)); !os.IsNotExist(err) {
+		t.Error("Expected the manifest to be regenerated only when its settings change")
+	}
+}
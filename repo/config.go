@@ -1,10 +1,31 @@
 package repo
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/common"
 	"github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+	"golang.org/x/crypto/bcrypt"
+	ma "gx/ipfs/QmcyqRMCAXVtYPS4DiBrA7sezL9rRGfW8Ctx7cywL4TXJj/go-multiaddr"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+	manet "gx/ipfs/Qmf1Gq7N45Rpuw7ev47uWgH6dLPtdnvcMRNPkVBwqjLJg2/go-multiaddr-net"
 	"path"
 )
 
@@ -15,6 +36,11 @@ var DefaultBootstrapAddresses = []string{
 	"/ip4/46.101.198.170/tcp/4001/ipfs/QmePWxsFT9wY3QuukgVDB7XZpqdKhrqJTHTXU7ECLDWJqX", // Duo Search
 }
 
+var DefaultCrosspostGateways = []string{
+	"https://gateway.ob1.io/",
+	"https://gateway.duosear.ch/",
+}
+
 type APIConfig struct {
 	Authenticated bool
 	AllowedIPs    []string
@@ -34,16 +60,140 @@ type TorConfig struct {
 }
 
 type WalletConfig struct {
-	Type             string
-	Binary           string
-	MaxFee           int
-	FeeAPI           string
-	HighFeeDefault   int
-	MediumFeeDefault int
-	LowFeeDefault    int
-	TrustedPeer      string
-	RPCUser          string
-	RPCPassword      string
+	Type   string
+	Binary string
+
+	// MaxFee caps the fee the wallet pays, in satoshi per byte. It must be
+	// from MinWalletMaxFee to MaxWalletMaxFee. In ConfigOverrides.Wallet zero
+	// means unset and keeps the default.
+	MaxFee int
+
+	FeeAPI      string
+	Fees        map[string]FeeTiers
+	TrustedPeer string
+	RPCUser     string
+	RPCPassword string
+}
+
+// FeeTiers are the fallback fee levels of a coin, used when the fee API is
+// unavailable. They are expressed in the coin's own fee unit, satoshi per
+// byte for Bitcoin.
+type FeeTiers struct {
+	Low    int
+	Medium int
+	High   int
+}
+
+// CoinTypeBitcoin keys the Bitcoin fee tiers. Configs written before fees
+// were kept per coin only describe Bitcoin.
+const CoinTypeBitcoin = "BTC"
+
+// MarshalJSON also writes the Bitcoin fee tiers under the flat keys configs
+// had before fees were kept per coin, so older binaries still find them
+func (w WalletConfig) MarshalJSON() ([]byte, error) {
+	type walletConfig WalletConfig
+	v := struct {
+		walletConfig
+		LowFeeDefault    *int `json:",omitempty"`
+		MediumFeeDefault *int `json:",omitempty"`
+		HighFeeDefault   *int `json:",omitempty"`
+	}{walletConfig: walletConfig(w)}
+	if tiers, ok := w.Fees[CoinTypeBitcoin]; ok {
+		v.LowFeeDefault, v.MediumFeeDefault, v.HighFeeDefault = &tiers.Low, &tiers.Medium, &tiers.High
+	}
+	return json.Marshal(v)
+}
+
+// DefaultResolvers are the name resolvers written at init
+var DefaultResolvers = []string{"https://resolver.onename.com/"}
+
+// DefaultWalletConfig is the wallet configuration written at init
+var DefaultWalletConfig = WalletConfig{
+	Type:   "spvwallet",
+	MaxFee: 2000,
+	FeeAPI: "https://bitcoinfees.21.co/api/v1/fees/recommended",
+	Fees: map[string]FeeTiers{
+		CoinTypeBitcoin: {Low: 120, Medium: 140, High: 160},
+	},
+	TrustedPeer: "",
+}
+
+// DefaultAPIConfig is the JSON-API configuration written at init
+var DefaultAPIConfig = APIConfig{
+	Enabled:     true,
+	AllowedIPs:  []string{},
+	HTTPHeaders: nil,
+}
+
+// DefaultTorConfig is the Tor configuration written at init
+var DefaultTorConfig = TorConfig{}
+
+// AuthCookieName is the name of the cookie used to authenticate API requests
+const AuthCookieName = "OpenBazaar_Auth_Cookie"
+
+// SupportedWalletTypes are the wallet implementations the daemon can start
+var SupportedWalletTypes = []string{"spvwallet", "bitcoind"}
+
+// ConfigOverrides replaces the defaults written to the OpenBazaar sections of
+// the config during init. Nil fields keep the defaults.
+type ConfigOverrides struct {
+	// Only the non-zero fields of Wallet replace the defaults. Wallet.Type
+	// must be one of SupportedWalletTypes.
+	Wallet *WalletConfig
+
+	// MaxFee replaces Wallet.MaxFee when set. Unlike Wallet.MaxFee an
+	// explicit zero isn't taken as unset, so it fails with ErrInvalidMaxFee.
+	MaxFee *int
+
+	// Tor replaces the empty Tor-config so the node starts Tor ready
+	Tor *TorConfig
+
+	// API replaces the default JSON-API config, which is enabled and
+	// reachable from any IP
+	API *APIConfig
+
+	// When APIPassword is set the JSON-API requires authentication with
+	// APIUsername and APIPassword, and an auth cookie is generated
+	APIUsername string
+	APIPassword string
+
+	// CrosspostGateways replaces the default gateways when not empty. They
+	// must be https URLs unless AllowInsecureGateways is set, as plain http
+	// would leak listing data.
+	CrosspostGateways     []string
+	AllowInsecureGateways bool
+
+	// Resolvers replaces the default name resolvers when not empty. They are
+	// tried in order.
+	Resolvers []string
+
+	// TrustedModerators are the peer IDs of moderators the node trusts from
+	// the start, such as a curated list for new buyers
+	TrustedModerators []string
+
+	// ImportConfigFrom is the root of another repo whose non-secret settings,
+	// the importedConfigKeys, replace the defaults. The identity is still
+	// derived from the new node's mnemonic.
+	ImportConfigFrom string
+
+	// SwarmAddresses replace the swarm listen addresses when not empty. They
+	// must be /ip4 or /ip6 multiaddrs. SwarmPort instead moves the default
+	// TCP listen addresses, which listen on every IPv4 and IPv6 interface,
+	// to another port. Only one of them can be set.
+	SwarmAddresses []string
+	SwarmPort      int
+
+	// IPNSRecordLifetime sets how long the IPNS record the store is
+	// published with stays valid, such as for a store that is often offline
+	// for longer than the default week. It must be from
+	// MinIPNSRecordLifetime to MaxIPNSRecordLifetime and is written to
+	// Ipns.RecordLifetime.
+	IPNSRecordLifetime time.Duration
+
+	// IPFSConfig is called with the IPFS config from InitConfig before it is
+	// written, so bootstrap peers, swarm addresses and other IPFS settings
+	// can be adjusted without restarting the node. An error aborts the init.
+	IPFSConfig func(*config.Config) error
 }
 
 var MalformedConfigError error = errors.New("Config file is malformed")
@@ -214,29 +364,19 @@ func GetWalletConfig(cfgBytes []byte) (*WalletConfig, error) {
 	if !ok {
 		return nil, MalformedConfigError
 	}
-	low, ok := wallet["LowFeeDefault"]
-	if !ok {
-		return nil, MalformedConfigError
-	}
-	lowFloat, ok := low.(float64)
-	if !ok {
-		return nil, MalformedConfigError
-	}
-	medium, ok := wallet["MediumFeeDefault"]
-	if !ok {
-		return nil, MalformedConfigError
-	}
-	mediumFloat, ok := medium.(float64)
-	if !ok {
-		return nil, MalformedConfigError
-	}
-	high, ok := wallet["HighFeeDefault"]
-	if !ok {
-		return nil, MalformedConfigError
-	}
-	highFloat, ok := high.(float64)
-	if !ok {
-		return nil, MalformedConfigError
+	var fees map[string]FeeTiers
+	if feesIface, ok := wallet["Fees"]; ok {
+		fees, ok = parseFeeTiers(feesIface)
+		if !ok {
+			return nil, MalformedConfigError
+		}
+	} else {
+		// Migrate the flat Bitcoin fees of older configs
+		tiers, ok := parseFeeTier(wallet, "LowFeeDefault", "MediumFeeDefault", "HighFeeDefault")
+		if !ok {
+			return nil, MalformedConfigError
+		}
+		fees = map[string]FeeTiers{CoinTypeBitcoin: tiers}
 	}
 	maxFee, ok := wallet["MaxFee"]
 	if !ok {
@@ -279,20 +419,56 @@ func GetWalletConfig(cfgBytes []byte) (*WalletConfig, error) {
 		return nil, MalformedConfigError
 	}
 	wCfg := &WalletConfig{
-		Type:             walletTypeStr,
-		Binary:           binaryStr,
-		MaxFee:           int(maxFeeFloat),
-		FeeAPI:           feeAPIstr,
-		HighFeeDefault:   int(highFloat),
-		MediumFeeDefault: int(mediumFloat),
-		LowFeeDefault:    int(lowFloat),
-		TrustedPeer:      trustedPeerStr,
-		RPCUser:          rpcUserStr,
-		RPCPassword:      rpcPasswordStr,
+		Type:        walletTypeStr,
+		Binary:      binaryStr,
+		MaxFee:      int(maxFeeFloat),
+		FeeAPI:      feeAPIstr,
+		Fees:        fees,
+		TrustedPeer: trustedPeerStr,
+		RPCUser:     rpcUserStr,
+		RPCPassword: rpcPasswordStr,
 	}
 	return wCfg, nil
 }
 
+// parseFeeTiers parses the per coin fee tiers of the wallet config
+func parseFeeTiers(feesIface interface{}) (map[string]FeeTiers, bool) {
+	feesMap, ok := feesIface.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	fees := make(map[string]FeeTiers)
+	for coin, tiersIface := range feesMap {
+		tiersMap, ok := tiersIface.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		tiers, ok := parseFeeTier(tiersMap, "Low", "Medium", "High")
+		if !ok {
+			return nil, false
+		}
+		fees[coin] = tiers
+	}
+	return fees, true
+}
+
+// parseFeeTier reads the low, medium and high fees stored under the given keys
+func parseFeeTier(m map[string]interface{}, lowKey, mediumKey, highKey string) (FeeTiers, bool) {
+	var values [3]int
+	for i, key := range []string{lowKey, mediumKey, highKey} {
+		v, ok := m[key]
+		if !ok {
+			return FeeTiers{}, false
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return FeeTiers{}, false
+		}
+		values[i] = int(f)
+	}
+	return FeeTiers{Low: values[0], Medium: values[1], High: values[2]}, true
+}
+
 func GetTorConfig(cfgBytes []byte) (*TorConfig, error) {
 	var cfgIface interface{}
 	json.Unmarshal(cfgBytes, &cfgIface)
@@ -379,31 +555,707 @@ func GetCrosspostGateway(cfgBytes []byte) ([]string, error) {
 	return urls, nil
 }
 
+// GetResolverUrl returns the first of the configured resolvers
 func GetResolverUrl(cfgBytes []byte) (string, error) {
+	urls, err := GetResolverUrls(cfgBytes)
+	if err != nil {
+		return "", err
+	}
+	return urls[0], nil
+}
+
+// GetResolverUrls returns the configured resolvers in the order they should be
+// tried. Configs written before multiple resolvers were supported hold a
+// single URL.
+func GetResolverUrls(cfgBytes []byte) ([]string, error) {
 	var cfgIface interface{}
 	json.Unmarshal(cfgBytes, &cfgIface)
 
 	cfg, ok := cfgIface.(map[string]interface{})
 	if !ok {
-		return "", MalformedConfigError
+		return nil, MalformedConfigError
 	}
 
 	r, ok := cfg["Resolver"]
 	if !ok {
-		return "", MalformedConfigError
+		return nil, MalformedConfigError
 	}
-	resolverStr, ok := r.(string)
+	if resolverStr, ok := r.(string); ok {
+		return []string{resolverStr}, nil
+	}
+	resolvers, ok := r.([]interface{})
+	if !ok || len(resolvers) == 0 {
+		return nil, MalformedConfigError
+	}
+	var urls []string
+	for _, resolver := range resolvers {
+		resolverStr, ok := resolver.(string)
+		if !ok {
+			return nil, MalformedConfigError
+		}
+		urls = append(urls, resolverStr)
+	}
+	return urls, nil
+}
+
+// GetTrustedModerators returns the peer IDs of the moderators trusted at
+// init. Repos initialized before the list was kept have none.
+func GetTrustedModerators(cfgBytes []byte) ([]string, error) {
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return nil, MalformedConfigError
+	}
+	section, ok := cfg["Trusted-moderators"]
 	if !ok {
-		return "", MalformedConfigError
+		return nil, nil
+	}
+	var moderators []string
+	if err := json.Unmarshal(section, &moderators); err != nil {
+		return nil, MalformedConfigError
+	}
+	if err := validateModerators(moderators); err != nil {
+		return nil, err
+	}
+	return moderators, nil
+}
+
+// IsTestnet reports whether the repo at repoRoot was initialized for testnet.
+// Repos initialized before the flag was recorded return MalformedConfigError.
+func IsTestnet(repoRoot string) (bool, error) {
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		return false, err
+	}
+	var cfgIface interface{}
+	json.Unmarshal(cfgBytes, &cfgIface)
+
+	cfg, ok := cfgIface.(map[string]interface{})
+	if !ok {
+		return false, MalformedConfigError
+	}
+
+	t, ok := cfg["Testnet"]
+	if !ok {
+		return false, MalformedConfigError
+	}
+	testnet, ok := t.(bool)
+	if !ok {
+		return false, MalformedConfigError
+	}
+	return testnet, nil
+}
+
+var ErrUnknownNetwork = errors.New("Could not tell whether the repo is for testnet or mainnet")
+
+// detectTestnet reports whether the repo at repoRoot is for testnet like
+// IsTestnet. Repos initialized before the flag was recorded are told apart by
+// which of the testnet and mainnet databases exists.
+func detectTestnet(repoRoot string) (bool, error) {
+	testnet, err := IsTestnet(repoRoot)
+	if err != MalformedConfigError {
+		return testnet, err
+	}
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		return false, err
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return false, MalformedConfigError
+	}
+	if _, ok := cfg["Testnet"]; ok {
+		return false, MalformedConfigError
+	}
+	_, mainnetErr := os.Stat(path.Join(repoRoot, "datastore", "mainnet.db"))
+	_, testnetErr := os.Stat(path.Join(repoRoot, "datastore", "testnet.db"))
+	switch {
+	case testnetErr == nil && os.IsNotExist(mainnetErr):
+		return true, nil
+	case mainnetErr == nil && os.IsNotExist(testnetErr):
+		return false, nil
+	}
+	return false, ErrUnknownNetwork
+}
+
+// GetCreationDate returns the creation date recorded in the config of the repo
+// at repoRoot. A zero time is returned if the date was left empty.
+func GetCreationDate(repoRoot string) (time.Time, error) {
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var cfgIface interface{}
+	json.Unmarshal(cfgBytes, &cfgIface)
+
+	cfg, ok := cfgIface.(map[string]interface{})
+	if !ok {
+		return time.Time{}, MalformedConfigError
+	}
+
+	cd, ok := cfg["CreationDate"]
+	if !ok {
+		return time.Time{}, MalformedConfigError
+	}
+	creationDateStr, ok := cd.(string)
+	if !ok {
+		return time.Time{}, MalformedConfigError
+	}
+	if creationDateStr == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, creationDateStr)
+}
+
+// HashAPIPassword returns the salted bcrypt hash of the password that the
+// JSON-API checks the supplied credentials against with CheckAPIPassword
+func HashAPIPassword(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// CheckAPIPassword reports whether password matches hash. Configs written
+// before the hashes were salted hold the hex encoded SHA-256 of the password,
+// which still matches until the password is set again.
+func CheckAPIPassword(hash, password string) bool {
+	if !IsLegacyAPIPasswordHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	h := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(hex.EncodeToString(h[:]))) == 1
+}
+
+// IsLegacyAPIPasswordHash reports whether hash is an unsalted SHA-256 hash
+// rather than one from HashAPIPassword
+func IsLegacyAPIPasswordHash(hash string) bool {
+	b, err := hex.DecodeString(hash)
+	return err == nil && len(b) == sha256.Size
+}
+
+// normalizeGateways gives each gateway URL a single trailing slash and drops
+// duplicates while preserving order
+func normalizeGateways(gateways []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, gw := range gateways {
+		gw = strings.TrimRight(strings.TrimSpace(gw), "/") + "/"
+		if gw == "/" || seen[gw] {
+			continue
+		}
+		seen[gw] = true
+		normalized = append(normalized, gw)
+	}
+	return normalized
+}
+
+// validateGateways requires each gateway to be an https URL, or an http one
+// if allowInsecure is set, and lists every gateway that isn't
+func validateGateways(gateways []string, allowInsecure bool) error {
+	var invalid []string
+	for _, gw := range gateways {
+		u, err := url.Parse(gw)
+		if err != nil || u.Host == "" {
+			invalid = append(invalid, gw)
+			continue
+		}
+		if u.Scheme != "https" && !(allowInsecure && u.Scheme == "http") {
+			invalid = append(invalid, gw)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("Crosspost gateways must be https URLs, got %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+func validateWalletType(walletType string) error {
+	for _, t := range SupportedWalletTypes {
+		if strings.ToLower(walletType) == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unsupported wallet type %s, must be one of %s", walletType, strings.Join(SupportedWalletTypes, ", "))
+}
+
+var ErrInvalidTrustedPeer = errors.New("Wallet trusted peer must be a host:port or a TCP multiaddr")
+
+// TrustedPeerAddress returns the host:port of a wallet trusted peer given
+// either as a host:port or as an /ip4 or /ip6 TCP multiaddr
+func TrustedPeerAddress(trustedPeer string) (string, error) {
+	if strings.HasPrefix(trustedPeer, "/") {
+		addr, err := ma.NewMultiaddr(trustedPeer)
+		if err != nil {
+			return "", wrapErrorf(ErrInvalidTrustedPeer, err, "%q", trustedPeer)
+		}
+		netAddr, err := manet.ToNetAddr(addr)
+		if err != nil {
+			return "", wrapErrorf(ErrInvalidTrustedPeer, err, "%q", trustedPeer)
+		}
+		if netAddr.Network() != "tcp" {
+			return "", wrapErrorf(ErrInvalidTrustedPeer, nil, "%q is not a TCP address", trustedPeer)
+		}
+		return netAddr.String(), nil
+	}
+	host, port, err := net.SplitHostPort(trustedPeer)
+	if err != nil {
+		return "", wrapErrorf(ErrInvalidTrustedPeer, err, "%q", trustedPeer)
+	}
+	if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 {
+		return "", wrapErrorf(ErrInvalidTrustedPeer, nil, "%q needs a host and a port from 1 to 65535", trustedPeer)
+	}
+	return trustedPeer, nil
+}
+
+// validateTrustedPeer accepts an empty trusted peer, which leaves the wallet
+// to find peers on its own
+func validateTrustedPeer(trustedPeer string) error {
+	if trustedPeer == "" {
+		return nil
+	}
+	_, err := TrustedPeerAddress(trustedPeer)
+	return err
+}
+
+var ErrInvalidModerator = errors.New("Trusted moderators must be given as peer IDs")
+
+// validateModerators lists every moderator that isn't a valid peer ID
+func validateModerators(moderators []string) error {
+	var invalid []string
+	for _, m := range moderators {
+		if _, err := peer.IDB58Decode(m); err != nil {
+			invalid = append(invalid, strconv.Quote(m))
+		}
+	}
+	if len(invalid) > 0 {
+		return wrapErrorf(ErrInvalidModerator, nil, "got %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// Bounds of WalletConfig.MaxFee, in satoshi per byte. Below the minimum relay
+// fee transactions wouldn't confirm, and far above the fee tiers a bad fee
+// estimate could drain the wallet.
+const (
+	MinWalletMaxFee = 1
+	MaxWalletMaxFee = 10000
+)
+
+var ErrInvalidMaxFee = fmt.Errorf("Wallet MaxFee must be from %d to %d satoshi per byte", MinWalletMaxFee, MaxWalletMaxFee)
+
+func validateMaxFee(maxFee int) error {
+	if maxFee < MinWalletMaxFee || maxFee > MaxWalletMaxFee {
+		return wrapErrorf(ErrInvalidMaxFee, nil, "got %d", maxFee)
+	}
+	return nil
+}
+
+func mergeWalletConfig(w WalletConfig, override WalletConfig) WalletConfig {
+	if override.Type != "" {
+		w.Type = override.Type
+	}
+	if override.Binary != "" {
+		w.Binary = override.Binary
+	}
+	if override.MaxFee != 0 {
+		w.MaxFee = override.MaxFee
+	}
+	if override.FeeAPI != "" {
+		w.FeeAPI = override.FeeAPI
+	}
+	fees := make(map[string]FeeTiers)
+	for coin, tiers := range w.Fees {
+		fees[coin] = tiers
+	}
+	for coin, tiers := range override.Fees {
+		fees[coin] = tiers
+	}
+	w.Fees = fees
+	if override.TrustedPeer != "" {
+		w.TrustedPeer = override.TrustedPeer
+	}
+	if override.RPCUser != "" {
+		w.RPCUser = override.RPCUser
+	}
+	if override.RPCPassword != "" {
+		w.RPCPassword = override.RPCPassword
+	}
+	return w
+}
+
+// configSections are the sections init adds to the IPFS config, each with a
+// parser that fails the way the node would on a malformed section
+var configSections = []struct {
+	name  string
+	parse func([]byte) error
+}{
+	{"Wallet", func(b []byte) error { _, err := GetWalletConfig(b); return err }},
+	{"JSON-API", func(b []byte) error { _, err := GetAPIConfig(b); return err }},
+	{"Tor-config", func(b []byte) error { _, err := GetTorConfig(b); return err }},
+	{"Resolver", func(b []byte) error { _, err := GetResolverUrls(b); return err }},
+	{"Crosspost-gateways", func(b []byte) error { _, err := GetCrosspostGateway(b); return err }},
+	{"Dropbox-api-token", func(b []byte) error { _, err := GetDropboxApiToken(b); return err }},
+	{"Trusted-moderators", func(b []byte) error { _, err := GetTrustedModerators(b); return err }},
+	{"CreationDate", func(b []byte) error {
+		var cfg struct{ CreationDate string }
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return MalformedConfigError
+		}
+		_, err := time.Parse(time.RFC3339, cfg.CreationDate)
+		return err
+	}},
+	{"Testnet", func(b []byte) error {
+		var cfg struct{ Testnet *bool }
+		if err := json.Unmarshal(b, &cfg); err != nil || cfg.Testnet == nil {
+			return MalformedConfigError
+		}
+		return nil
+	}},
+}
+
+// verifyConfigSections re-opens the repo and checks that every section init
+// wrote is present and parses, so a bad write fails the init rather than the
+// next start of the node. It returns the sections as a JSON config document.
+func verifyConfigSections(open openRepoFunc, repoRoot string) ([]byte, error) {
+	r, err := open(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	sections := make(map[string]interface{})
+	for _, section := range configSections {
+		value, err := r.GetConfigKey(section.name)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("%s section is missing: %s", section.name, err)
+		}
+		sections[section.name] = value
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(sections)
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range configSections {
+		if err := section.parse(b); err != nil {
+			return nil, fmt.Errorf("%s section is malformed: %s", section.name, err)
+		}
+	}
+	return b, nil
+}
+
+// redactedConfigKeys hold credentials that ListConfigKeys must not reveal
+var redactedConfigKeys = []string{
+	"Dropbox-api-token",
+	"JSON-API.Password",
+	"JSON-API.SSLKey",
+	"Tor-config.Password",
+	"Wallet.RPCPassword",
+}
+
+// RedactedConfigValue replaces the non-empty secrets listed by ListConfigKeys
+const RedactedConfigValue = "<redacted>"
+
+// ListConfigKeys returns the OpenBazaar sections of the repo's config, the
+// same ones init writes, so settings panels don't need to hardcode them.
+// Sections missing from older repos are left out and credentials are
+// replaced with RedactedConfigValue.
+func ListConfigKeys(repoRoot string) (map[string]interface{}, error) {
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	sections := make(map[string]interface{})
+	for _, section := range configSections {
+		value, err := r.GetConfigKey(section.name)
+		if err != nil || value == nil {
+			continue
+		}
+		sections[section.name] = value
+	}
+	for _, key := range redactedConfigKeys {
+		redactConfigKey(sections, key)
+	}
+	return sections, nil
+}
+
+func redactConfigKey(cfg map[string]interface{}, key string) {
+	keys := strings.Split(key, ".")
+	m := cfg
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	last := keys[len(keys)-1]
+	if v, ok := m[last]; ok && v != nil && v != "" {
+		m[last] = RedactedConfigValue
+	}
+}
+
+// ConfigChange is a config key whose value at init differs from the default,
+// with nested keys separated by dots as in "Wallet.MaxFee". Credentials are
+// given as RedactedConfigValue.
+type ConfigChange struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+type configChangesByKey []ConfigChange
+
+func (c configChangesByKey) Len() int           { return len(c) }
+func (c configChangesByKey) Less(i, j int) bool { return c[i].Key < c[j].Key }
+func (c configChangesByKey) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// DiffConfigOverrides returns the config keys overrides change from the
+// defaults written at init, sorted by key, so operators can review them before
+// initializing. Config imported with ImportConfigFrom isn't included.
+func DiffConfigOverrides(overrides *ConfigOverrides) ([]ConfigChange, error) {
+	defaults, _, err := obConfigExtensions(false, time.Time{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	overridden, _, err := obConfigExtensions(false, time.Time{}, overrides)
+	if err != nil {
+		return nil, err
+	}
+	old, err := flattenConfigExtensions(defaults)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := flattenConfigExtensions(overridden)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ConfigChange
+	for key, value := range updated {
+		if prev, ok := old[key]; !ok || !reflect.DeepEqual(prev, value) {
+			changes = append(changes, ConfigChange{Key: key, Old: prev, New: value})
+		}
+	}
+	for key, prev := range old {
+		if _, ok := updated[key]; !ok {
+			changes = append(changes, ConfigChange{Key: key, Old: prev})
+		}
+	}
+	sort.Sort(configChangesByKey(changes))
+	return changes, nil
+}
+
+// flattenConfigExtensions returns the leaves of the sections as they are
+// written to the config, keyed by their dotted key. Lists are leaves.
+func flattenConfigExtensions(extensions []configExtension) (map[string]interface{}, error) {
+	sections := make(map[string]interface{})
+	for _, e := range extensions {
+		b, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err != nil {
+			return nil, err
+		}
+		sections[e.key] = value
+	}
+	for _, key := range redactedConfigKeys {
+		redactConfigKey(sections, key)
+	}
+	leaves := make(map[string]interface{})
+	flattenConfig(leaves, "", sections)
+	return leaves, nil
+}
+
+func flattenConfig(leaves map[string]interface{}, prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenConfig(leaves, key, nested)
+			continue
+		}
+		leaves[key] = v
 	}
+}
+
+// ExtendConfig sets key to value in the config of an initialized repo, so
+// plugins and alternate wallets can add their own sections without
+// reinitializing. Nested keys are separated by dots, as in "Wallet.MaxFee".
+func ExtendConfig(repoRoot string, key string, value interface{}) error {
+	return extendConfig(fsrepo.Open, repoRoot, []configExtension{{key, value}})
+}
+
+type configExtension struct {
+	key   string
+	value interface{}
+}
 
-	return resolverStr, nil
+// extendConfig applies the extensions in order with the repo opened once
+func extendConfig(open openRepoFunc, repoRoot string, extensions []configExtension) error {
+	_, err := applyConfigExtensions(open, repoRoot, extensions, true)
+	return err
 }
 
-func extendConfigFile(r repo.Repo, key string, value interface{}) error {
+// addMissingConfig applies only the extensions whose key isn't in the config
+// yet, so sections a user has customized are left alone, and returns the
+// keys it added
+func addMissingConfig(open openRepoFunc, repoRoot string, extensions []configExtension) ([]string, error) {
+	return applyConfigExtensions(open, repoRoot, extensions, false)
+}
+
+func applyConfigExtensions(open openRepoFunc, repoRoot string, extensions []configExtension, overwrite bool) ([]string, error) {
+	r, err := open(repoRoot)
+	if err != nil { // NB: repo is owned by the node
+		return nil, err
+	}
+	var applied []string
+	for _, e := range extensions {
+		if !overwrite {
+			if value, err := r.GetConfigKey(e.key); err == nil && value != nil {
+				continue
+			}
+		}
+		if err := extendConfigFile(r, repoRoot, e.key, e.value); err != nil {
+			r.Close()
+			return nil, err
+		}
+		applied = append(applied, e.key)
+	}
+	return applied, r.Close()
+}
+
+// importedConfigKeys are the settings ImportConfigFrom copies from another
+// repo. The identity, the API, Tor and wallet RPC credentials and the Dropbox
+// token are deliberately left out so the new node shares no secrets with the
+// old one.
+var importedConfigKeys = []string{
+	"Resolver",
+	"Crosspost-gateways",
+	"Wallet.MaxFee",
+	"Wallet.FeeAPI",
+	"Wallet.Fees",
+	"Wallet.LowFeeDefault",
+	"Wallet.MediumFeeDefault",
+	"Wallet.HighFeeDefault",
+	"JSON-API.AllowedIPs",
+}
+
+// readImportedConfig returns the importedConfigKeys set in the config of the
+// repo at srcRoot
+func readImportedConfig(srcRoot string) ([]configExtension, error) {
+	b, err := ioutil.ReadFile(path.Join(srcRoot, "config"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the config to import: %s", err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, MalformedConfigError
+	}
+	var extensions []configExtension
+	for _, key := range importedConfigKeys {
+		if value, ok := lookupConfigKey(cfg, key); ok {
+			extensions = append(extensions, configExtension{key, value})
+		}
+	}
+	return extensions, nil
+}
+
+// lookupConfigKey returns the value of a dot separated key, as used by
+// SetConfigKey
+func lookupConfigKey(cfg map[string]interface{}, key string) (interface{}, bool) {
+	var v interface{} = cfg
+	for _, k := range strings.Split(key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, v != nil
+}
+
+// extendConfigFile sets key in the config of r, opened at repoRoot, and
+// leaves every other key as it was, including ones OpenBazaar and go-ipfs
+// don't know about. An fsrepo's SetConfigKey rewrites the sections in the
+// IPFS config struct from the struct, which drops any fields within them the
+// struct doesn't have, such as ones a newer go-ipfs added, so when the config
+// is a file in repoRoot the value SetConfigKey stored is written back into the
+// document as it was read.
+func extendConfigFile(r repo.Repo, repoRoot string, key string, value interface{}) error {
+	filename := path.Join(repoRoot, "config")
+	var doc map[string]interface{}
+	if err := serialize.ReadConfigFile(filename, &doc); os.IsNotExist(err) {
+		return r.SetConfigKey(key, value)
+	} else if err != nil {
+		return err
+	}
 	if err := r.SetConfigKey(key, value); err != nil {
 		return err
 	}
+	stored, err := r.GetConfigKey(key)
+	if err != nil {
+		return err
+	}
+	if err := common.MapSetKV(doc, key, stored); err != nil {
+		return err
+	}
+	return serialize.WriteConfigFile(filename, doc)
+}
+
+// DefaultSwarmPort is the TCP port the node listens on for peers
+const DefaultSwarmPort = 4001
+
+var ErrInvalidSwarmAddress = errors.New("Swarm addresses must be /ip4 or /ip6 multiaddrs and the swarm port from 1 to 65535")
+
+// SwarmAddresses returns the swarm listen addresses on every IPv4 and IPv6
+// interface, with TCP on port and websockets on 9005. A stack the host
+// doesn't have is skipped when the node starts.
+func SwarmAddresses(port int) []string {
+	return []string{
+		fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
+		fmt.Sprintf("/ip6/::/tcp/%d", port),
+		"/ip4/0.0.0.0/tcp/9005/ws",
+		"/ip6/::/tcp/9005/ws",
+	}
+}
+
+// applySwarmAddresses sets the swarm listen addresses of conf from
+// overrides.SwarmAddresses or overrides.SwarmPort
+func applySwarmAddresses(conf *config.Config, overrides *ConfigOverrides) error {
+	if overrides == nil || len(overrides.SwarmAddresses) == 0 && overrides.SwarmPort == 0 {
+		return nil
+	}
+	if len(overrides.SwarmAddresses) > 0 && overrides.SwarmPort != 0 {
+		return wrapErrorf(ErrInvalidSwarmAddress, nil, "set either the addresses or the port")
+	}
+	if overrides.SwarmPort != 0 {
+		if overrides.SwarmPort < 1 || overrides.SwarmPort > 65535 {
+			return wrapErrorf(ErrInvalidSwarmAddress, nil, "port %d", overrides.SwarmPort)
+		}
+		conf.Addresses.Swarm = SwarmAddresses(overrides.SwarmPort)
+		return nil
+	}
+	for _, s := range overrides.SwarmAddresses {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return wrapErrorf(ErrInvalidSwarmAddress, err, "%q", s)
+		}
+		if code := addr.Protocols()[0].Code; code != ma.P_IP4 && code != ma.P_IP6 {
+			return wrapErrorf(ErrInvalidSwarmAddress, nil, "%q", s)
+		}
+	}
+	conf.Addresses.Swarm = append([]string{}, overrides.SwarmAddresses...)
 	return nil
 }
 
@@ -420,12 +1272,7 @@ func InitConfig(repoRoot string) (*config.Config, error) {
 		// Setup the node's default addresses.
 		// NOTE: two swarm listen addrs, one TCP, one UTP.
 		Addresses: config.Addresses{
-			Swarm: []string{
-				"/ip4/0.0.0.0/tcp/4001",
-				"/ip6/::/tcp/4001",
-				"/ip4/0.0.0.0/tcp/9005/ws",
-				"/ip6/::/tcp/9005/ws",
-			},
+			Swarm:   SwarmAddresses(DefaultSwarmPort),
 			API:     "",
 			Gateway: "/ip4/127.0.0.1/tcp/4002",
 		},
@@ -1,6 +1,9 @@
 package repo
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -8,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 const testConfigFolder = "testdata"
@@ -84,14 +88,16 @@ func TestGetWalletConfig(t *testing.T) {
 	if config.Binary != "/path/to/bitcoind" {
 		t.Error("Binary does not equal expected value")
 	}
-	if config.LowFeeDefault != 20 {
-		t.Error("Expected low to be 20, got ", config.LowFeeDefault)
+	// The test config uses the flat fee fields of older repos
+	fees := config.Fees[CoinTypeBitcoin]
+	if fees.Low != 20 {
+		t.Error("Expected low to be 20, got ", fees.Low)
 	}
-	if config.MediumFeeDefault != 40 {
-		t.Error("Expected medium to be 40, got ", config.MediumFeeDefault)
+	if fees.Medium != 40 {
+		t.Error("Expected medium to be 40, got ", fees.Medium)
 	}
-	if config.HighFeeDefault != 60 {
-		t.Error("Expected high to be 60, got ", config.HighFeeDefault)
+	if fees.High != 60 {
+		t.Error("Expected high to be 60, got ", fees.High)
 	}
 	if config.MaxFee != 2000 {
 		t.Error("Expected maxFee to be 2000, got ", config.MaxFee)
@@ -106,6 +112,69 @@ func TestGetWalletConfig(t *testing.T) {
 	}
 }
 
+func TestGetWalletConfigFees(t *testing.T) {
+	configFile := []byte(`{"Wallet": {
+		"Type": "spvwallet",
+		"Binary": "",
+		"MaxFee": 2000,
+		"FeeAPI": "",
+		"Fees": {
+			"BTC": {"Low": 20, "Medium": 40, "High": 60},
+			"TBTC": {"Low": 1, "Medium": 2, "High": 3}
+		},
+		"TrustedPeer": "",
+		"RPCUser": "",
+		"RPCPassword": ""
+	}}`)
+	config, err := GetWalletConfig(configFile)
+	if err != nil {
+		t.Error("GetWalletConfig threw an unexpected error", err)
+		return
+	}
+	expected := map[string]FeeTiers{
+		"BTC":  {Low: 20, Medium: 40, High: 60},
+		"TBTC": {Low: 1, Medium: 2, High: 3},
+	}
+	if !reflect.DeepEqual(config.Fees, expected) {
+		t.Errorf("Expected fees %v, got %v", expected, config.Fees)
+	}
+
+	malformed := bytes.Replace(configFile, []byte(`"Medium": 2`), []byte(`"Medium": "2"`), 1)
+	if _, err := GetWalletConfig(malformed); err == nil {
+		t.Error("GetWalletConfig didn't throw an error for malformed fees")
+	}
+}
+
+func TestDoInitWritesFlatFees(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := DoInit(dir, 4096, true, "", "", time.Now(), MockDbInit); err != nil {
+		t.Fatal(err)
+	}
+	configFile, err := ioutil.ReadFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Wallet map[string]interface{}
+	}
+	if err := json.Unmarshal(configFile, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Older binaries only read the flat Bitcoin fees
+	expected := DefaultWalletConfig.Fees[CoinTypeBitcoin]
+	tiers, ok := parseFeeTier(cfg.Wallet, "LowFeeDefault", "MediumFeeDefault", "HighFeeDefault")
+	if !ok || tiers != expected {
+		t.Errorf("Expected the flat fees %v, got %v", expected, tiers)
+	}
+	if _, ok := cfg.Wallet["Fees"]; !ok {
+		t.Error("Expected the per coin fees to be written")
+	}
+}
+
 func TestGetDropboxApiToken(t *testing.T) {
 	configFile, err := ioutil.ReadFile(testConfigPath)
 	if err != nil {
@@ -150,6 +219,161 @@ func TestGetResolverUrl(t *testing.T) {
 	}
 }
 
+func TestGetResolverUrls(t *testing.T) {
+	configFile := []byte(`{"Resolver": ["https://resolver.example.com/", "https://resolver.onename.com/"]}`)
+	urls, err := GetResolverUrls(configFile)
+	if err != nil {
+		t.Error("GetResolverUrls threw an unexpected error", err)
+	}
+	expected := []string{"https://resolver.example.com/", "https://resolver.onename.com/"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected %v, got %v", expected, urls)
+	}
+	url, err := GetResolverUrl(configFile)
+	if err != nil || url != expected[0] {
+		t.Error("Expected GetResolverUrl to return the first resolver, got ", url)
+	}
+
+	// Older configs hold a single URL
+	configFile = []byte(`{"Resolver": "https://resolver.onename.com/"}`)
+	urls, err = GetResolverUrls(configFile)
+	if err != nil || !reflect.DeepEqual(urls, DefaultResolvers) {
+		t.Error("Expected the single resolver as a list, got ", urls)
+	}
+
+	for _, malformed := range []string{`{"Resolver": []}`, `{"Resolver": [1]}`, `{"Resolver": 1}`} {
+		if _, err := GetResolverUrls([]byte(malformed)); err == nil {
+			t.Error("GetResolverUrls didn't throw an error for ", malformed)
+		}
+	}
+}
+
+func TestIsTestnet(t *testing.T) {
+	for _, testnet := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "ob-config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		err = DoInit(dir, 4096, testnet, "", "", time.Now(), MockDbInit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		isTestnet, err := IsTestnet(dir)
+		if err != nil {
+			t.Error("IsTestnet threw an unexpected error", err)
+		}
+		if isTestnet != testnet {
+			t.Errorf("Expected testnet to be %t, got %t", testnet, isTestnet)
+		}
+	}
+
+	// The testdata config predates the Testnet key
+	_, err := IsTestnet(testConfigFolder)
+	if err != MalformedConfigError {
+		t.Error("IsTestnet didn't throw MalformedConfigError for a missing key")
+	}
+}
+
+func TestDetectTestnet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := DoInit(dir, 4096, false, "", "", time.Now(), MockDbInit); err != nil {
+		t.Fatal(err)
+	}
+	removeTestnetKey(t, dir)
+
+	mainnetDB := filepath.Join(dir, "datastore", "mainnet.db")
+	testnetDB := filepath.Join(dir, "datastore", "testnet.db")
+	if _, err := detectTestnet(dir); err != ErrUnknownNetwork {
+		t.Error("Expected ErrUnknownNetwork without a database, got ", err)
+	}
+	if err := ioutil.WriteFile(testnetDB, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if testnet, err := detectTestnet(dir); err != nil || !testnet {
+		t.Errorf("Expected a repo with a testnet database to be for testnet, got %t, %v", testnet, err)
+	}
+	if err := os.Rename(testnetDB, mainnetDB); err != nil {
+		t.Fatal(err)
+	}
+	if testnet, err := detectTestnet(dir); err != nil || testnet {
+		t.Errorf("Expected a repo with a mainnet database to be for mainnet, got %t, %v", testnet, err)
+	}
+	if err := ioutil.WriteFile(testnetDB, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := detectTestnet(dir); err != ErrUnknownNetwork {
+		t.Error("Expected ErrUnknownNetwork with both databases, got ", err)
+	}
+}
+
+// removeTestnetKey rewrites the config of the repo at repoRoot as it was
+// before the Testnet key was recorded
+func removeTestnetKey(t *testing.T, repoRoot string) {
+	configPath := filepath.Join(repoRoot, "config")
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	delete(cfg, "Testnet")
+	if b, err = json.MarshalIndent(cfg, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetCreationDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	creationDate := time.Date(2017, 7, 26, 10, 30, 0, 0, time.UTC)
+	err = DoInit(dir, 4096, true, "", "", creationDate, MockDbInit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd, err := GetCreationDate(dir)
+	if err != nil {
+		t.Error("GetCreationDate threw an unexpected error", err)
+	}
+	if !cd.Equal(creationDate) {
+		t.Errorf("Expected creation date %s, got %s", creationDate, cd)
+	}
+
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extendConfigFile(r, dir, "CreationDate", "")
+	r.Close()
+	cd, err = GetCreationDate(dir)
+	if err != nil {
+		t.Error("GetCreationDate threw an unexpected error", err)
+	}
+	if !cd.IsZero() {
+		t.Error("Expected a zero creation date, got ", cd)
+	}
+
+	// The testdata config predates the CreationDate key
+	_, err = GetCreationDate(testConfigFolder)
+	if err != MalformedConfigError {
+		t.Error("GetCreationDate didn't throw MalformedConfigError for a missing key")
+	}
+}
+
 func TestExtendConfigFile(t *testing.T) {
 	r, err := fsrepo.Open(testConfigFolder)
 	if err != nil {
@@ -163,7 +387,7 @@ func TestExtendConfigFile(t *testing.T) {
 	config, _ := GetWalletConfig(configFile)
 	originalMaxFee := config.MaxFee
 	newMaxFee := config.MaxFee + 1
-	if err := extendConfigFile(r, "Wallet.MaxFee", newMaxFee); err != nil {
+	if err := extendConfigFile(r, testConfigFolder, "Wallet.MaxFee", newMaxFee); err != nil {
 		t.Error("extendConfigFile threw an unexpected error ", err)
 		return
 	}
@@ -177,13 +401,127 @@ func TestExtendConfigFile(t *testing.T) {
 		return
 	}
 	// Reset maxFee to original value
-	extendConfigFile(r, "Wallet.MaxFee", originalMaxFee)
+	extendConfigFile(r, testConfigFolder, "Wallet.MaxFee", originalMaxFee)
 
 	// Teardown
 	os.RemoveAll(filepath.Join(testConfigFolder, "datastore"))
 	os.RemoveAll(filepath.Join(testConfigFolder, "repo.lock"))
 }
 
+func TestExtendConfigFileKeepsUnknownKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-extend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys a future version might add, at the top level and within both an
+	// IPFS and an OpenBazaar section
+	configPath := filepath.Join(dir, "config")
+	var doc map[string]interface{}
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["Future-section"] = map[string]interface{}{"Enabled": true}
+	doc["Datastore"].(map[string]interface{})["FutureField"] = "datastore"
+	doc["Wallet"].(map[string]interface{})["FutureField"] = "wallet"
+	if b, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := extendConfigFile(r, dir, "Wallet.MaxFee", 5000); err != nil {
+		t.Error("extendConfigFile threw an unexpected error ", err)
+	}
+	r.Close()
+
+	b, err = ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = nil
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc["Future-section"], map[string]interface{}{"Enabled": true}) {
+		t.Error("Expected the unknown top-level key to survive, got ", doc["Future-section"])
+	}
+	if doc["Datastore"].(map[string]interface{})["FutureField"] != "datastore" {
+		t.Error("Expected the unknown key in the Datastore section to survive")
+	}
+	wallet := doc["Wallet"].(map[string]interface{})
+	if wallet["FutureField"] != "wallet" {
+		t.Error("Expected the unknown key in the Wallet section to survive")
+	}
+	if wallet["MaxFee"] != float64(5000) {
+		t.Error("Expected the wallet max fee to be set, got ", wallet["MaxFee"])
+	}
+}
+
+func TestExtendConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-extend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ExtendConfig(dir, "Plugin-config", "value"); err == nil {
+		t.Error("ExtendConfig didn't throw an error for an uninitialized repo")
+	}
+
+	err = DoInit(dir, 4096, true, "", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := map[string]interface{}{"Enabled": true, "Name": "example"}
+	if err := ExtendConfig(dir, "Plugin-config", plugin); err != nil {
+		t.Error("ExtendConfig threw an unexpected error", err)
+	}
+	if err := ExtendConfig(dir, "Wallet.MaxFee", 3000); err != nil {
+		t.Error("ExtendConfig threw an unexpected error", err)
+	}
+
+	configFile, err := ioutil.ReadFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(configFile, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg["Plugin-config"], plugin) {
+		t.Error("Expected the custom key to be written, got ", cfg["Plugin-config"])
+	}
+	walletConfig, err := GetWalletConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walletConfig.MaxFee != 3000 {
+		t.Error("Expected the nested key to be written, got ", walletConfig.MaxFee)
+	}
+}
+
 func TestInitConfig(t *testing.T) {
 	config, err := InitConfig(testConfigFolder)
 	if config == nil {
@@ -196,3 +534,188 @@ func TestInitConfig(t *testing.T) {
 		t.Error("config.Addresses.Gateway is not set")
 	}
 }
+
+func TestUpgradeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = DoInit(dir, 4096, true, "", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customResolvers := []string{"https://resolver.example.com/"}
+	if err := ExtendConfig(dir, "Resolver", customResolvers); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop a section as if the repo predated it
+	configPath := filepath.Join(dir, "config")
+	cfgBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	delete(cfg, "Crosspost-gateways")
+	cfgBytes, err = json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, cfgBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := UpgradeConfig(dir, true); err != nil {
+			t.Fatal("UpgradeConfig threw an unexpected error", err)
+		}
+		cfgBytes, err = ioutil.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolvers, err := GetResolverUrls(cfgBytes)
+		if err != nil || !reflect.DeepEqual(resolvers, customResolvers) {
+			t.Errorf("Expected the customized resolvers to be kept, got %v", resolvers)
+		}
+		gateways, err := GetCrosspostGateway(cfgBytes)
+		if err != nil || !reflect.DeepEqual(gateways, DefaultCrosspostGateways) {
+			t.Errorf("Expected the missing gateways to be added, got %v", gateways)
+		}
+	}
+}
+
+func TestListConfigKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-listconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overrides := &ConfigOverrides{APIUsername: "admin", APIPassword: "hunter2"}
+	if err := DoInitOpts(InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtendConfig(dir, "Dropbox-api-token", "sl.secret-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ListConfigKeys(dir)
+	if err != nil {
+		t.Fatal("ListConfigKeys threw an unexpected error", err)
+	}
+	for _, name := range []string{"Wallet", "Resolver", "Crosspost-gateways", "Dropbox-api-token", "JSON-API", "Tor-config"} {
+		if _, ok := keys[name]; !ok {
+			t.Errorf("Expected the %s section to be listed", name)
+		}
+	}
+	if keys["Dropbox-api-token"] != RedactedConfigValue {
+		t.Error("Expected the Dropbox token to be redacted, got ", keys["Dropbox-api-token"])
+	}
+	api, ok := keys["JSON-API"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected the JSON-API section to be an object")
+	}
+	if api["Password"] != RedactedConfigValue || api["Username"] != "admin" {
+		t.Errorf("Expected only the API password to be redacted, got %v and %v", api["Password"], api["Username"])
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("sl.secret-token")) {
+		t.Error("Expected the Dropbox token not to be listed")
+	}
+
+	if _, err := ListConfigKeys(filepath.Join(dir, "missing")); err == nil {
+		t.Error("ListConfigKeys didn't throw an error for a missing repo")
+	}
+}
+
+func TestDiffConfigOverrides(t *testing.T) {
+	changes, err := DiffConfigOverrides(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Error("Expected no changes without overrides, got ", changes)
+	}
+
+	overrides := &ConfigOverrides{
+		Wallet: &WalletConfig{FeeAPI: "https://fees.example.com/"},
+		API:    &APIConfig{Enabled: false},
+	}
+	expected := []ConfigChange{
+		{Key: "JSON-API.Enabled", Old: true, New: false},
+		{Key: "Wallet.FeeAPI", Old: DefaultWalletConfig.FeeAPI, New: "https://fees.example.com/"},
+	}
+	changes, err = DiffConfigOverrides(overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatal("DoInitOptsResult threw an unexpected error", err)
+	}
+	defer TearDown()
+	if !reflect.DeepEqual(res.ConfigChanges, expected) {
+		t.Errorf("Expected the init result to report changes %v, got %v", expected, res.ConfigChanges)
+	}
+}
+
+func TestDiffConfigOverridesRedacts(t *testing.T) {
+	changes, err := DiffConfigOverrides(&ConfigOverrides{Wallet: &WalletConfig{RPCPassword: "letmein"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Key != "Wallet.RPCPassword" || changes[0].New != RedactedConfigValue {
+		t.Error("Expected the RPC password change to be redacted, got ", changes)
+	}
+}
+
+func TestCheckAPIPassword(t *testing.T) {
+	hash, err := HashAPIPassword("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, err := HashAPIPassword("test"); err != nil || other == hash {
+		t.Error("Expected each hash to be salted differently")
+	}
+	// sha256("test"), as configs from before the hashes were salted hold it
+	legacy := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	for _, h := range []string{hash, legacy, "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"} {
+		if !CheckAPIPassword(h, "test") {
+			t.Errorf("Expected the password to match %s", h)
+		}
+		if CheckAPIPassword(h, "wrong") {
+			t.Errorf("Expected another password not to match %s", h)
+		}
+	}
+	if IsLegacyAPIPasswordHash(hash) || !IsLegacyAPIPasswordHash(legacy) {
+		t.Error("Expected only the SHA-256 hash to be legacy")
+	}
+	if CheckAPIPassword("", "") {
+		t.Error("Expected an empty hash not to match")
+	}
+}
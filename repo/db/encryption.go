@@ -9,10 +9,9 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/OpenBazaar/openbazaar-go/repo"
 	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
-	"github.com/mitchellh/go-homedir"
 	"golang.org/x/crypto/ssh/terminal"
-	"runtime"
 )
 
 // FIXME: the encrypt and decrypt functions here should probably be added to the DB interface
@@ -218,29 +217,8 @@ func Decrypt() error {
 }
 
 func getRepoPath(isTestnet bool) (string, error) {
-	// Set default base path and directory name
-	path := "~"
-	directoryName := "OpenBazaar2.0"
-
-	// Override OS-specific names
-	switch runtime.GOOS {
-	case "linux":
-		directoryName = ".openbazaar2.0"
-	case "darwin":
-		path = "~/Library/Application Support"
-	}
-
-	// Append testnet flag if on testnet
 	if isTestnet {
-		directoryName += "-testnet"
+		return repo.DefaultTestnetRepoPath()
 	}
-
-	// Join the path and directory name, then expand the home path
-	fullPath, err := homedir.Expand(filepath.Join(path, directoryName))
-	if err != nil {
-		return "", err
-	}
-
-	// Return the shortest lexical representation of the path
-	return filepath.Clean(fullPath), nil
+	return repo.DefaultRepoPath()
 }
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+var ErrRepoLocked = errors.New("Repo is in use by a running node. Stop the node before destroying the repo.")
+
+// DestroyRepo permanently removes a repo. Files holding key material are
+// overwritten with zeros before the repo is deleted so the keys don't
+// survive in the freed blocks of the filesystem. It refuses to run while a
+// node holds the repo lock.
+func DestroyRepo(repoRoot string) error {
+	locked, err := fsrepo.LockedByOtherProcess(repoRoot)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrRepoLocked
+	}
+	for _, p := range keyMaterialPaths(repoRoot) {
+		if err := wipeFile(p); err != nil {
+			return err
+		}
+	}
+	// A keystore kept outside of the repo root is only linked from it, so
+	// removing the repo root would leave the keystore behind
+	keystore := filepath.Join(repoRoot, "keystore")
+	if fi, err := os.Lstat(keystore); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(keystore)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(repoRoot)
+}
+
+// databaseFileSuffixes are appended to the name of a database for the
+// journal and WAL files sqlite keeps next to it, which can hold recently
+// written rows
+var databaseFileSuffixes = []string{"", "-journal", "-wal", "-shm"}
+
+// keyMaterialPaths returns the files in the repo that may hold private keys,
+// the mnemonic or API credentials
+func keyMaterialPaths(repoRoot string) []string {
+	paths := []string{
+		filepath.Join(repoRoot, "config"),
+		filepath.Join(repoRoot, ".cookie"),
+	}
+	for _, name := range backedUpDatabases {
+		for _, suffix := range databaseFileSuffixes {
+			paths = append(paths, filepath.Join(repoRoot, "datastore", name+suffix))
+		}
+	}
+	for _, dir := range []string{"keystore", "backups"} {
+		paths = append(paths, filesUnder(filepath.Join(repoRoot, dir))...)
+	}
+	return paths
+}
+
+// filesUnder returns the regular files anywhere below dir. dir itself is
+// followed if it is a symlink, such as to a keystore outside the repo root.
+func filesUnder(dir string) []string {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files
+}
+
+// wipeFile overwrites a regular file with zeros and syncs it to disk. Missing
+// files and directories are skipped.
+func wipeFile(name string) error {
+	fi, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zeros := make([]byte, 4096)
+	for remaining := fi.Size(); remaining > 0; remaining -= int64(len(zeros)) {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+)
+
+func TestDestroyRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-destroy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repoRoot := path.Join(dir, "repo")
+	err = DoInit(repoRoot, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Fatalf("DoInit threw an unexpected error: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(path.Join(repoRoot, "datastore", "testnet.db"), []byte("identity"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DestroyRepo(repoRoot); err != nil {
+		t.Error("DestroyRepo threw an unexpected error", err)
+	}
+	if _, err := os.Stat(repoRoot); !os.IsNotExist(err) {
+		t.Error("DestroyRepo did not remove the repo")
+	}
+}
+
+func TestDestroyRepoKeyMaterial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-destroy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repoRoot := path.Join(dir, "repo")
+	keystorePath := path.Join(dir, "encrypted", "keystore")
+	err = DoInitOpts(InitOptions{RepoRoot: repoRoot, Mnemonic: mnemonicFixture, KeystorePath: keystorePath, DbInit: MockDbInit})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	backupDir := path.Join(repoRoot, "backups", "20170101T000000Z")
+	secrets := []string{
+		path.Join(keystorePath, "store"),
+		path.Join(repoRoot, "datastore", "testnet.db-wal"),
+		path.Join(backupDir, "keystore", "store"),
+		path.Join(backupDir, "datastore", "000001.log"),
+	}
+	for _, p := range secrets {
+		if err := os.MkdirAll(path.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("secret"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wiped := make(map[string]bool)
+	for _, p := range keyMaterialPaths(repoRoot) {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			p = resolved
+		}
+		wiped[p] = true
+	}
+	for _, p := range secrets {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			p = resolved
+		}
+		if !wiped[p] {
+			t.Errorf("Expected %s to be wiped", p)
+		}
+	}
+
+	if err := DestroyRepo(repoRoot); err != nil {
+		t.Error("DestroyRepo threw an unexpected error", err)
+	}
+	if _, err := os.Stat(keystorePath); !os.IsNotExist(err) {
+		t.Error("DestroyRepo did not remove the keystore outside of the repo root")
+	}
+}
+
+func TestDestroyRepoLocked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-destroy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Fatalf("DoInit threw an unexpected error: %s", err.Error())
+	}
+	l, err := lockfile.Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := DestroyRepo(dir); err == nil {
+		t.Error("DestroyRepo didn't throw an error for a locked repo")
+	}
+	if _, err := os.Stat(path.Join(dir, "config")); err != nil {
+		t.Error("DestroyRepo removed the config of a locked repo")
+	}
+}
+
+func TestWipeFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "ob-wipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	secret := bytes.Repeat([]byte("secret"), 1000)
+	f.Write(secret)
+	f.Close()
+
+	if err := wipeFile(f.Name()); err != nil {
+		t.Error("wipeFile threw an unexpected error", err)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, make([]byte, len(secret))) {
+		t.Error("wipeFile did not overwrite the file with zeros")
+	}
+	if err := wipeFile(f.Name() + "-missing"); err != nil {
+		t.Error("wipeFile threw an error for a missing file", err)
+	}
+}
@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var ErrInsufficientDiskSpace = errors.New("Not enough free disk space to initialize the repo")
+
+// errDiskSpaceUnknown is returned by freeDiskSpace where free space can't be
+// queried, in which case the check is skipped
+var errDiskSpaceUnknown = errors.New("Free disk space is unknown")
+
+// DefaultMinFreeDiskSpace leaves room for the datastore, the wallet headers
+// and the first blocks of the blockstore
+const DefaultMinFreeDiskSpace uint64 = 256 << 20
+
+// MinFreeDiskSpace is the free space init requires on the repo root's
+// filesystem. Zero disables the check.
+var MinFreeDiskSpace = DefaultMinFreeDiskSpace
+
+// freeDiskSpace is replaced in tests
+var freeDiskSpace = statFreeDiskSpace
+
+// checkFreeDiskSpace fails before anything is written if the filesystem the
+// repo root will live on has less than MinFreeDiskSpace bytes available
+func checkFreeDiskSpace(repoRoot string) error {
+	if MinFreeDiskSpace == 0 {
+		return nil
+	}
+	// The repo root may not exist yet
+	dir := filepath.Clean(repoRoot)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+	free, err := freeDiskSpace(dir)
+	if err == errDiskSpaceUnknown {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if free < MinFreeDiskSpace {
+		return wrapErrorf(ErrInsufficientDiskSpace, nil, "%s has %d bytes available, %d are required", dir, free, MinFreeDiskSpace)
+	}
+	return nil
+}
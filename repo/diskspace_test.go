@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDoInitDiskSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-diskspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(f func(string) (uint64, error)) { freeDiskSpace = f }(freeDiskSpace)
+
+	var queried string
+	freeDiskSpace = func(dir string) (uint64, error) {
+		queried = dir
+		return MinFreeDiskSpace - 1, nil
+	}
+	root := path.Join(dir, "a", "b")
+	err = DoInit(root, 4096, true, "password", "", time.Now(), MockDbInit)
+	if !isError(err, ErrInsufficientDiskSpace) {
+		t.Error("Expected ErrInsufficientDiskSpace, got ", err)
+	}
+	if queried != dir {
+		t.Errorf("Expected the free space of %s to be queried, got %s", dir, queried)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Error("DoInit wrote to disk despite the lack of free space")
+	}
+
+	freeDiskSpace = func(string) (uint64, error) { return MinFreeDiskSpace, nil }
+	err = DoInit(root, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Error("DoInit threw an unexpected error", err)
+	}
+}
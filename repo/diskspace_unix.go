@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package repo
+
+import "syscall"
+
+func statFreeDiskSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
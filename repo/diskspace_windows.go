@@ -0,0 +1,8 @@
+//go:build windows
+// +build windows
+
+package repo
+
+func statFreeDiskSpace(dir string) (uint64, error) {
+	return 0, errDiskSpaceUnknown
+}
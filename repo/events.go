@@ -0,0 +1,58 @@
+package repo
+
+import "strings"
+
+// InitEventStage identifies a step of init in an InitEvent
+type InitEventStage int
+
+const (
+	EventDirectories InitEventStage = iota
+	EventMnemonic
+	EventKeyGeneration
+	EventRepo
+	EventKeyspace
+
+	// EventDone is always the last event, with the error init returned
+	EventDone
+)
+
+var eventStages = []struct {
+	prefix string
+	stage  InitEventStage
+}{
+	{InitStageDirectories, EventDirectories},
+	{InitStageMnemonic, EventMnemonic},
+	{InitStageKeyGeneration, EventKeyGeneration},
+	{InitStageRepo, EventRepo},
+	{InitStageKeyspace, EventKeyspace},
+}
+
+// InitEvent reports the progress of an init to a GUI or other client that
+// wants more than the messages printed to stdout
+type InitEvent struct {
+	Stage   InitEventStage
+	Message string
+	Err     error
+}
+
+// sendInitEvent never blocks, so a client that stops reading can't stall the
+// init. Events that don't fit in the channel's buffer are dropped.
+func sendInitEvent(events chan<- InitEvent, event InitEvent) {
+	select {
+	case events <- event:
+	default:
+		log.Debugf("Dropped init event %q", event.Message)
+	}
+}
+
+// eventProgress turns the stages passed to a progress callback into events
+func eventProgress(events chan<- InitEvent) func(string) {
+	return func(message string) {
+		for _, s := range eventStages {
+			if strings.HasPrefix(message, s.prefix) {
+				sendInitEvent(events, InitEvent{Stage: s.stage, Message: message})
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDoInitOptsEvents(t *testing.T) {
+	events := make(chan InitEvent, 10)
+	err := DoInitOpts(InitOptions{
+		RepoRoot:     repoRootFolder,
+		Testnet:      true,
+		Password:     "password",
+		Mnemonic:     mnemonicFixture,
+		CreationDate: time.Now(),
+		DbInit:       MockDbInit,
+		Events:       events,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stages []InitEventStage
+	for event := range events {
+		stages = append(stages, event.Stage)
+		if event.Stage == EventDone && event.Err != nil {
+			t.Error("Expected no error in the done event, got ", event.Err)
+		}
+	}
+	expected := []InitEventStage{EventDirectories, EventMnemonic, EventKeyGeneration, EventRepo, EventKeyspace, EventDone}
+	if !reflect.DeepEqual(stages, expected) {
+		t.Errorf("Expected stages %v, got %v", expected, stages)
+	}
+
+	// A failed init still ends with a done event and doesn't block on an
+	// unbuffered channel nobody reads
+	events = make(chan InitEvent, 10)
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, DbInit: MockDbInit, Events: events})
+	if err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists, got ", err)
+	}
+	var last InitEvent
+	for event := range events {
+		last = event
+	}
+	if last.Stage != EventDone || last.Err != ErrRepoExists {
+		t.Errorf("Expected a done event with ErrRepoExists, got %+v", last)
+	}
+	if err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, DbInit: MockDbInit, Events: make(chan InitEvent)}); err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists, got ", err)
+	}
+	TearDown()
+}
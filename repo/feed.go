@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"time"
+
+	libp2p "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+)
+
+var ErrInvalidWelcomePost = errors.New("Welcome post needs a title or content")
+var ErrInvalidFeedSignature = errors.New("Feed item signature doesn't match its content")
+
+// welcomePostSlug names the welcome post in root/feed
+const welcomePostSlug = "welcome"
+
+// WelcomePost is the caller's content for the post a new store's feed starts
+// with
+type WelcomePost struct {
+	Title   string
+	Content string
+}
+
+// FeedItem is a post in the node's feed, stored as root/feed/<slug>.json.
+// Signature is the identity key's signature over the item serialized without
+// it, so peers can check the node wrote it.
+type FeedItem struct {
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	PeerID    string    `json:"peerID"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+// feedIndexEntry is an item's entry in root/feed.json
+type feedIndexEntry struct {
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// signedBytes returns what the item's signature covers
+func (item FeedItem) signedBytes() ([]byte, error) {
+	item.Signature = nil
+	return json.Marshal(item)
+}
+
+// VerifyFeedItem checks that item was signed by the identity with publicKey
+func VerifyFeedItem(item FeedItem, publicKey libp2p.PubKey) error {
+	b, err := item.signedBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := publicKey.Verify(b, item.Signature)
+	if err != nil || !ok {
+		return ErrInvalidFeedSignature
+	}
+	return nil
+}
+
+// writeWelcomePost writes post as the first item of the feed, signed with the
+// identity key, and adds it to the feed index
+func writeWelcomePost(repoRoot string, post *WelcomePost, identityKey []byte, peerID string, now time.Time) error {
+	sk, err := libp2p.UnmarshalPrivateKey(identityKey)
+	if err != nil {
+		return err
+	}
+	item := FeedItem{
+		Slug:      welcomePostSlug,
+		Title:     post.Title,
+		Content:   post.Content,
+		Timestamp: now.UTC().Truncate(time.Second),
+		PeerID:    peerID,
+	}
+	b, err := item.signedBytes()
+	if err != nil {
+		return err
+	}
+	if item.Signature, err = sk.Sign(b); err != nil {
+		return err
+	}
+	b, err = json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(repoRoot, "root", "feed", item.Slug+".json"), b, 0644); err != nil {
+		return err
+	}
+
+	indexPath := path.Join(repoRoot, "root", "feed.json")
+	var index []json.RawMessage
+	if b, err := ioutil.ReadFile(indexPath); err == nil && len(b) > 0 {
+		if err := json.Unmarshal(b, &index); err != nil {
+			return err
+		}
+	}
+	entry, err := json.Marshal(feedIndexEntry{item.Slug, item.Title, item.Timestamp})
+	if err != nil {
+		return err
+	}
+	b, err = json.MarshalIndent(append(index, entry), "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(indexPath, b, 0644)
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	libp2p "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+)
+
+func TestDoInitOptsWelcomePost(t *testing.T) {
+	defer TearDown()
+	opts := InitOptions{
+		RepoRoot:    repoRootFolder,
+		Testnet:     true,
+		Mnemonic:    mnemonicFixture,
+		DbInit:      MockDbInit,
+		WelcomePost: &WelcomePost{Title: "Welcome", Content: "Our store is open."},
+	}
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(repoRootFolder, "root", "feed", welcomePostSlug+".json"))
+	if err != nil {
+		t.Fatal("Expected a welcome post in the feed: ", err)
+	}
+	var item FeedItem
+	if err := json.Unmarshal(b, &item); err != nil {
+		t.Fatal("Expected the welcome post to parse as a feed item: ", err)
+	}
+	if item.Title != "Welcome" || item.Content != "Our store is open." || item.Timestamp.IsZero() {
+		t.Error("Expected the supplied content with a timestamp, got ", item)
+	}
+
+	identityKey, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, Ed25519KeypairBits, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := libp2p.UnmarshalPrivateKey(identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFeedItem(item, sk.GetPublic()); err != nil {
+		t.Error("Expected the welcome post to be signed with the identity key: ", err)
+	}
+	item.Content = "Tampered"
+	if err := VerifyFeedItem(item, sk.GetPublic()); !isError(err, ErrInvalidFeedSignature) {
+		t.Error("Expected ErrInvalidFeedSignature for a changed post, got ", err)
+	}
+
+	b, err = ioutil.ReadFile(path.Join(repoRootFolder, "root", "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index []feedIndexEntry
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || index[0].Slug != welcomePostSlug {
+		t.Error("Expected the welcome post in the feed index, got ", index)
+	}
+}
+
+func TestDoInitOptsWithoutWelcomePost(t *testing.T) {
+	defer TearDown()
+	opts := InitOptions{
+		RepoRoot: repoRootFolder,
+		Testnet:  true,
+		Mnemonic: mnemonicFixture,
+		DbInit:   MockDbInit,
+	}
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "root", "feed", welcomePostSlug+".json")); !os.IsNotExist(err) {
+		t.Error("Expected no welcome post without the option, got ", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(repoRootFolder, "root", "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "[]" {
+		t.Errorf("Expected an empty feed index, got %s", b)
+	}
+	TearDown()
+
+	opts.WelcomePost = &WelcomePost{}
+	if err := DoInitOpts(opts); err != ErrInvalidWelcomePost {
+		t.Error("Expected ErrInvalidWelcomePost for an empty post, got ", err)
+	}
+}
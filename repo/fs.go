@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// initFS is the filesystem the OpenBazaar directories are created in and the
+// repo root is checked to be writeable on, so tests can run those steps in
+// memory and inject failures
+type initFS interface {
+	Stat(name string) (os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Remove(name string) error
+
+	// TempFile creates an empty file in dir with a random name starting
+	// with prefix and returns its path
+	TempFile(dir, prefix string) (string, error)
+}
+
+// osFS is the real filesystem
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+func (osFS) TempFile(dir, prefix string) (string, error) {
+	f, err := ioutil.TempFile(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// memFS is an in-memory initFS. failures maps an operation and path, such as
+// "mkdir /repo/root/feed", to the error it fails with.
+type memFS struct {
+	files    map[string]*memFile
+	failures map[string]error
+	temps    int
+}
+
+type memFile struct {
+	name  string
+	mode  os.FileMode
+	data  []byte
+	isDir bool
+}
+
+func (f *memFile) Name() string       { return path.Base(f.name) }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() os.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return time.Time{} }
+func (f *memFile) IsDir() bool        { return f.isDir }
+func (f *memFile) Sys() interface{}   { return nil }
+
+func newMemFS() *memFS {
+	return &memFS{
+		files:    map[string]*memFile{"/": {name: "/", mode: os.ModeDir | 0755, isDir: true}},
+		failures: make(map[string]error),
+	}
+}
+
+func (fs *memFS) fail(op, name string) error {
+	if err, ok := fs.failures[op+" "+name]; ok {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	if err := fs.fail("stat", name); err != nil {
+		return nil, err
+	}
+	f, ok := fs.files[path.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+	}
+	return f, nil
+}
+
+func (fs *memFS) MkdirAll(name string, perm os.FileMode) error {
+	name = path.Clean(name)
+	if f, ok := fs.files[name]; ok {
+		if !f.isDir {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if err := fs.MkdirAll(path.Dir(name), perm); err != nil {
+		return err
+	}
+	if err := fs.fail("mkdir", name); err != nil {
+		return err
+	}
+	fs.files[name] = &memFile{name: name, mode: os.ModeDir | perm, isDir: true}
+	return nil
+}
+
+func (fs *memFS) Chmod(name string, mode os.FileMode) error {
+	if err := fs.fail("chmod", name); err != nil {
+		return err
+	}
+	f, ok := fs.files[path.Clean(name)]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: syscall.ENOENT}
+	}
+	f.mode = f.mode&os.ModeType | mode
+	return nil
+}
+
+func (fs *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	name = path.Clean(name)
+	if err := fs.fail("write", name); err != nil {
+		return err
+	}
+	if parent, ok := fs.files[path.Dir(name)]; !ok || !parent.isDir {
+		return &os.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+	}
+	fs.files[name] = &memFile{name: name, mode: perm, data: append([]byte{}, data...)}
+	return nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	if err := fs.fail("remove", name); err != nil {
+		return err
+	}
+	if _, ok := fs.files[path.Clean(name)]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOENT}
+	}
+	delete(fs.files, path.Clean(name))
+	return nil
+}
+
+func (fs *memFS) TempFile(dir, prefix string) (string, error) {
+	if err := fs.fail("create", dir); err != nil {
+		return "", err
+	}
+	fs.temps++
+	name := path.Join(dir, fmt.Sprintf("%s%d", prefix, fs.temps))
+	return name, fs.WriteFile(name, nil, 0600)
+}
+
+func TestMaybeCreateOBDirectoriesMemFS(t *testing.T) {
+	fs := newMemFS()
+	if err := maybeCreateOBDirectories(fs, "/repo", 0750); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range obDirectories {
+		fi, err := fs.Stat(path.Join("/repo", dir))
+		if err != nil || !fi.IsDir() {
+			t.Errorf("Expected %s to be created, got %v", dir, err)
+			continue
+		}
+		if fi.Mode().Perm() != 0750 {
+			t.Errorf("Expected %s to have mode 0750, got %s", dir, fi.Mode())
+		}
+	}
+	for _, name := range obIndexFiles {
+		f, ok := fs.files[path.Join("/repo", name)]
+		if !ok || string(f.data) != "[]" {
+			t.Errorf("Expected an empty index %s", name)
+		}
+	}
+}
+
+func TestMaybeCreateOBDirectoriesPermissionDenied(t *testing.T) {
+	fs := newMemFS()
+	fs.failures["mkdir /repo/root/feed"] = syscall.EACCES
+	err := maybeCreateOBDirectories(fs, "/repo", DefaultDirectoryMode)
+	if !os.IsPermission(err) {
+		t.Fatal("Expected a permission error, got ", err)
+	}
+	if _, err := fs.Stat("/repo/root/channel"); err == nil {
+		t.Error("Expected the directories after the failed one not to be created")
+	}
+}
+
+func TestMaybeCreateOBDirectoriesNoSpace(t *testing.T) {
+	fs := newMemFS()
+	fs.failures["write /repo/root/feed.json"] = syscall.ENOSPC
+	err := maybeCreateOBDirectories(fs, "/repo", DefaultDirectoryMode)
+	if !isError(err, syscall.ENOSPC) {
+		t.Fatal("Expected ENOSPC, got ", err)
+	}
+}
+
+func TestCheckWriteableMemFS(t *testing.T) {
+	fs := newMemFS()
+	if err := checkWriteable(fs, "/srv/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("/srv/repo"); err != nil || !fi.IsDir() {
+		t.Error("Expected the missing repo root to be created, got ", err)
+	}
+	for name := range fs.files {
+		if strings.Contains(name, writeCheckPrefix) {
+			t.Error("Expected the probe file to be removed, found ", name)
+		}
+	}
+
+	fs = newMemFS()
+	fs.failures["mkdir /srv"] = syscall.EACCES
+	err := checkWriteable(fs, "/srv/repo")
+	if !isError(err, ErrNotWriteable) || !strings.Contains(err.Error(), "incorrect permissions") {
+		t.Error("Expected ErrNotWriteable for a root that can't be created, got ", err)
+	}
+
+	fs = newMemFS()
+	fs.MkdirAll("/srv/repo", 0755)
+	fs.failures["create /srv/repo"] = syscall.EACCES
+	err = checkWriteable(fs, "/srv/repo")
+	if !isError(err, ErrNotWriteable) || !strings.Contains(err.Error(), "not writeable by the current user") {
+		t.Error("Expected ErrNotWriteable for a read-only root, got ", err)
+	}
+
+	fs = newMemFS()
+	fs.MkdirAll("/srv/repo", 0755)
+	fs.failures["create /srv/repo"] = syscall.ENOSPC
+	err = checkWriteable(fs, "/srv/repo")
+	if !isError(err, ErrNotWriteable) || !isError(err, syscall.ENOSPC) {
+		t.Error("Expected ErrNotWriteable wrapping ENOSPC for a full disk, got ", err)
+	}
+}
@@ -1,233 +1,1815 @@
 package repo
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/OpenBazaar/openbazaar-go/ipfs"
+	"github.com/btcsuite/btcutil/base58"
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/namesys"
+	ipnspb "github.com/ipfs/go-ipfs/namesys/pb"
+	ipath "github.com/ipfs/go-ipfs/path"
+	"github.com/ipfs/go-ipfs/pin"
+	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	offroute "github.com/ipfs/go-ipfs/routing/offline"
+	ft "github.com/ipfs/go-ipfs/unixfs"
 	"github.com/op/go-logging"
 	"github.com/tyler-smith/go-bip39"
+	ds "gx/ipfs/QmRWDav6mzWseLWeYfVd5fvUKiVe9xNH29YfMF438fG364/go-datastore"
+	lock "gx/ipfs/QmWi28zbQG6B1xfaaWx5cYoLn3kBFU6pQ6GWQNRV5P6dNe/lock"
+	cid "gx/ipfs/QmYhQaCYEcaPPjxJX7YcPcVKkQfRy6sJ7B3XmGFk82XYdQ/go-cid"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
 	"time"
 )
 
 var log = logging.MustGetLogger("repo")
 var ErrRepoExists = errors.New("IPFS configuration file exists. Reinitializing would overwrite your keys. Use -f to force overwrite.")
+var ErrInvalidMnemonicEntropy = errors.New("Mnemonic entropy must be 128, 160, 192, 224 or 256 bits")
+var ErrInvalidMnemonic = errors.New("Mnemonic is not a valid BIP39 mnemonic")
+var ErrInitInProgress = errors.New("Repo is already being initialized by another process")
+var ErrInvalidIdentityKey = errors.New("Identity key must not be empty")
+var ErrInvalidPinCID = errors.New("Content to pin must be given as valid CIDs")
+var ErrInvalidKeypairBits = fmt.Errorf("Keypair size must be %d or at least %d bits", Ed25519KeypairBits, MinKeypairBits)
 
+// Init failures are returned as a *SentinelError holding one of these so
+// callers can tell the failure modes apart and still reach the cause.
+var ErrNotWriteable = errors.New("Repo root is not writeable")
+var ErrRepoRootNotDirectory = errors.New("Repo root is not a directory")
+var ErrKeyGeneration = errors.New("Could not generate the identity key")
+var ErrRepoInit = errors.New("Could not initialize the IPFS repo")
+var ErrConfigWrite = errors.New("Could not write the OpenBazaar config")
+var ErrDatabaseInit = errors.New("Could not initialize the database")
+var ErrKeyspaceInit = errors.New("Could not initialize the IPNS keyspace")
+var ErrPostInit = errors.New("Post-init step failed")
+var ErrKeyspaceUnresolved = errors.New("The node's IPNS name does not resolve to its initial keyspace")
+var ErrInitTimeout = errors.New("Init did not finish before its timeout")
+var ErrNoKeyMaterial = errors.New("A mnemonic or identity key must be supplied when mnemonic generation is disabled")
+
+// SentinelError is a failure identified by the sentinel Err, such as
+// ErrNotWriteable, with what went wrong in Detail and the underlying error,
+// if any, in Cause. With Is and Unwrap errors.Is matches both the sentinel and
+// the cause on toolchains that have it.
+type SentinelError struct {
+	Err    error
+	Detail string
+	Cause  error
+}
+
+func (e *SentinelError) Error() string {
+	msg := e.Err.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the sentinel
+func (e *SentinelError) Is(target error) bool {
+	return target == e.Err
+}
+
+// Unwrap returns the cause
+func (e *SentinelError) Unwrap() error {
+	return e.Cause
+}
+
+func wrapError(sentinel, cause error) error {
+	return &SentinelError{Err: sentinel, Cause: cause}
+}
+
+func wrapErrorf(sentinel, cause error, format string, a ...interface{}) error {
+	return &SentinelError{Err: sentinel, Detail: fmt.Sprintf(format, a...), Cause: cause}
+}
+
+// DefaultMnemonicEntropy is the number of bits of entropy used to generate a
+// new mnemonic. 128 bits yields a 12 word mnemonic, 256 bits yields 24 words.
+const DefaultMnemonicEntropy = 128
+
+// The identity key is always Ed25519, which has a fixed size, so
+// nBitsForKeypair doesn't change the generated key. Ed25519KeypairBits states
+// that explicitly. Larger values are accepted for existing callers, which
+// pass the RSA-style 4096, but values below MinKeypairBits are rejected in
+// case the key type changes.
+const (
+	Ed25519KeypairBits = 256
+	MinKeypairBits     = 2048
+)
+
+// DefaultDirectoryMode is the permission given to the OpenBazaar directories
+// created during init. Order data and logs are private to the node's owner.
+const DefaultDirectoryMode os.FileMode = 0700
+
+var ErrInvalidDirectoryPermissions = errors.New("Directory permissions can only be set for OpenBazaar directories")
+
+// DirectoryPermissions maps OpenBazaar directories, relative to the repo root,
+// to the mode their subtree is given, such as to let a local reverse proxy
+// serve root/images. A directory takes the mode of its closest listed
+// ancestor, or the init's directory mode if none is listed, so an empty policy
+// keeps every directory private.
+//
+// Others let into a directory are given search permission, but not read
+// permission, on its parents up to the repo root so they can reach it.
+type DirectoryPermissions map[string]os.FileMode
+
+// modeFor returns the mode of dir, or mode if no subtree containing it is
+// listed
+func (p DirectoryPermissions) modeFor(dir string, mode os.FileMode) os.FileMode {
+	best := -1
+	for subtree, m := range p {
+		if (dir == subtree || strings.HasPrefix(dir, subtree+"/")) && len(subtree) > best {
+			best = len(subtree)
+			mode = m
+		}
+	}
+	return mode
+}
+
+func (p DirectoryPermissions) validate() error {
+	for subtree, m := range p {
+		known := false
+		for _, dir := range obDirectories {
+			if dir == subtree {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return wrapErrorf(ErrInvalidDirectoryPermissions, nil, "%q", subtree)
+		}
+		if m&^os.ModePerm != 0 {
+			return wrapErrorf(ErrInvalidDirectoryPermissions, nil, "%s has mode %s", subtree, m)
+		}
+	}
+	return nil
+}
+
+// directoryModesKey records in the config the mode a DirectoryPermissions
+// policy gave each OpenBazaar directory, so that RepairDirectories keeps to it
+const directoryModesKey = "Directory-modes"
+
+func formatDirectoryModes(modes map[string]os.FileMode) map[string]string {
+	formatted := make(map[string]string, len(modes))
+	for dir, m := range modes {
+		formatted[dir] = fmt.Sprintf("%04o", uint32(m))
+	}
+	return formatted
+}
+
+// getDirectoryModes returns the directory modes recorded at init. Repos
+// initialized without a DirectoryPermissions policy have none.
+func getDirectoryModes(cfgBytes []byte) (map[string]os.FileMode, error) {
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return nil, MalformedConfigError
+	}
+	section, ok := cfg[directoryModesKey]
+	if !ok {
+		return nil, nil
+	}
+	var formatted map[string]string
+	if err := json.Unmarshal(section, &formatted); err != nil {
+		return nil, MalformedConfigError
+	}
+	modes := make(map[string]os.FileMode, len(formatted))
+	for dir, s := range formatted {
+		m, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || os.FileMode(m)&^os.ModePerm != 0 {
+			return nil, MalformedConfigError
+		}
+		modes[dir] = os.FileMode(m)
+	}
+	return modes, nil
+}
+
+// DefaultSeedPassphrase is the BIP39 passphrase existing nodes derived their
+// identity with. Other clients must use the same passphrase to restore it.
+const DefaultSeedPassphrase = "Secret Passphrase"
+
+// Stages reported to the progress callback during init
+const (
+	InitStageDirectories   = "Creating OpenBazaar directories"
+	InitStageMnemonic      = "Checking mnemonic"
+	InitStageKeyGeneration = "Generating Ed25519 keypair"
+	InitStageRepo          = "Initializing IPFS repo"
+	InitStageKeyspace      = "Initializing IPNS keyspace"
+)
+
+func printProgress(stage string) {
+	fmt.Printf("%s...\n", stage)
+}
+
+// SetLogBackend routes the logs of the repo package to backend instead of
+// the global go-logging backend, so embedders can capture init logs in their
+// own sink. A writer or standard library logger can be adapted with
+// logging.AddModuleLevel(logging.NewLogBackend(w, "", 0)). Passing nil
+// restores the global backend. Levels are still filtered by the global
+// backend.
+func SetLogBackend(backend logging.LeveledBackend) {
+	l := logging.MustGetLogger("repo")
+	if backend != nil {
+		l.SetBackend(backend)
+	}
+	log = l
+}
+
+// InitResult describes the identity of a newly initialized repo
+type InitResult struct {
+	PeerID      string
+	Mnemonic    string
+	IdentityKey []byte
+
+	// KeyDerivation describes how the identity key was derived
+	KeyDerivation *KeyDerivation
+
+	// PublicKey is the identity's public key in several encodings
+	PublicKey *ipfs.PublicKeyEncodings
+
+	// BackupDir holds the previous keys when an existing repo was reinitialized
+	BackupDir string
+
+	// Node is the node built by the backend's NewNode to initialize the
+	// keyspace. It is left running for the caller, who must close it.
+	Node *core.IpfsNode
+
+	// ConfigChanges are the config keys the overrides changed from the
+	// defaults, as returned by DiffConfigOverrides
+	ConfigChanges []ConfigChange
+}
+
+// InitOptions holds everything needed to initialize a repo so new settings can
+// be added without breaking callers. Zero values select the defaults.
+type InitOptions struct {
+	RepoRoot string
+
+	// NBitsForKeypair defaults to Ed25519KeypairBits
+	NBitsForKeypair int
+
+	Testnet  bool
+	Password string
+
+	// Mnemonic is generated with MnemonicEntropy bits of entropy when empty.
+	// MnemonicEntropy defaults to DefaultMnemonicEntropy.
+	Mnemonic        string
+	MnemonicEntropy int
+
+	// Entropy is read for the entropy of a generated mnemonic instead of
+	// crypto/rand, such as to use a hardware RNG
+	Entropy io.Reader
+
+	// MnemonicLanguage selects the BIP39 wordlist the mnemonic is generated
+	// in or validated against. It defaults to DefaultMnemonicLanguage and
+	// other languages must first be registered with RegisterWordlist.
+	MnemonicLanguage string
+
+	// MnemonicSource is read for the mnemonic when Mnemonic is empty
+	MnemonicSource MnemonicSource
+
+	// IdentityKey, such as one from provisioning, is used as the identity
+	// instead of deriving it from a mnemonic, and no mnemonic is generated
+	IdentityKey []byte
+
+	// DisableMnemonicGeneration makes init fail with ErrNoKeyMaterial
+	// instead of generating a mnemonic when neither Mnemonic, MnemonicSource
+	// nor IdentityKey supplies the key, so no recovery phrase is created that
+	// nobody keeps
+	DisableMnemonicGeneration bool
+
+	// Passphrase defaults to DefaultSeedPassphrase, which existing nodes
+	// derived their identity with. NoPassphrase derives the seed with an
+	// empty passphrase instead, as other BIP39 wallets do.
+	Passphrase   string
+	NoPassphrase bool
+
+	// KeystorePath places the IPFS keystore, which holds the node's IPNS
+	// keys, outside of the repo root, such as on an encrypted volume. The
+	// keystore in the repo root is a symlink to it.
+	KeystorePath string
+
+	// AccountIndex selects one of several identities, and so peer IDs, that
+	// can be derived from one mnemonic. Index 0 is the identity nodes have
+	// always derived. The index isn't stored, so restoring the node needs it.
+	AccountIndex uint32
+
+	// CreationDate is when the wallet's keys were created, which it syncs
+	// from. A zero creation date, such as when a node is restored from a
+	// mnemonic whose age isn't known, makes the wallet rescan from its oldest
+	// checkpoint so no historical transactions are missed.
+	CreationDate time.Time
+
+	// Force backs up the keys of an existing repo and reinitializes it
+	Force bool
+
+	// DirectoryPermissions sets the mode of subtrees of the OpenBazaar
+	// directories, which are otherwise given DefaultDirectoryMode
+	DirectoryPermissions DirectoryPermissions
+
+	Overrides *ConfigOverrides
+
+	// DbInit initializes the database with the mnemonic and identity key
+	DbInit func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error
+
+	// Pins are CIDs of content, such as a marketplace's featured listings,
+	// for the node to pin so it is available to peers from the start
+	Pins []string
+
+	// SkipKeyspaceInit leaves the IPNS keyspace to be initialized by
+	// CompletePendingKeyspace on the node's first start, for repos
+	// provisioned where no node can be built
+	SkipKeyspaceInit bool
+
+	// ConfirmMnemonic, when set, has the user confirm they wrote down the
+	// mnemonic before anything is written. Init aborts with
+	// ErrMnemonicConfirmation if the words don't match.
+	ConfirmMnemonic ConfirmMnemonicFunc
+
+	// PostInit, when set, is called with the repo root and peer ID once the
+	// repo is initialized, such as to register the node with a directory
+	// service. If it fails the init is rolled back.
+	PostInit PostInitFunc
+
+	// Progress is called with each stage of the init as it starts. It
+	// defaults to printing the stage to stdout.
+	Progress func(stage string)
+
+	// Events receives an InitEvent for each step instead of Progress being
+	// called, and is closed when init returns. Sends never block, so the
+	// channel should be buffered for every stage or events are lost.
+	Events chan<- InitEvent
+
+	// PlaceholderImages writes a placeholder avatar and header in every image
+	// size so the node has images to serve before the user sets their own
+	PlaceholderImages bool
+
+	// SwarmKey, when set, puts the node on the private network of the nodes
+	// sharing the pre-shared key, such as one from GenerateSwarmKey. It is
+	// written to the repo's swarm.key and the public bootstrap peers are
+	// removed from the config.
+	SwarmKey []byte
+
+	// WelcomePost, when set, is written as the first post of the feed,
+	// signed with the identity key, so a new store doesn't look empty
+	WelcomePost *WelcomePost
+
+	// WritePeerID writes the node's peer ID to the peerid file in the repo
+	// root, so tooling can read it without opening the database
+	WritePeerID bool
+
+	// Timeout, when set, bounds the whole init. An init still running when it
+	// expires is rolled back and fails with ErrInitTimeout.
+	Timeout time.Duration
+
+	// backend replaces the fsrepo backend, for DoInitWithBackend and tests
+	backend *RepoBackend
+
+	// dirMode is given to new directories, and defaults to
+	// DefaultDirectoryMode
+	dirMode os.FileMode
+
+	// rebuild backs up the IPFS datastore with the keys so that it starts
+	// from scratch
+	rebuild bool
+}
+
+// PostInitFunc runs the embedder's own steps after a successful init
+type PostInitFunc func(repoRoot, peerID string) error
+
+// DoInit initializes a new repo with the default mnemonic entropy and seed
+// passphrase. If the repo is already initialized it returns ErrRepoExists. Use
+// DoInitOpts for the other settings.
 func DoInit(repoRoot string, nBitsForKeypair int, testnet bool, password string, mnemonic string, creationDate time.Time, dbInit func(string, []byte, string, time.Time) error) error {
-	if err := maybeCreateOBDirectories(repoRoot); err != nil {
+	// A zero nBitsForKeypair is rejected rather than defaulted like in
+	// InitOptions
+	if err := validateKeypairBits(nBitsForKeypair); err != nil {
 		return err
 	}
+	return DoInitOpts(InitOptions{
+		RepoRoot:        repoRoot,
+		NBitsForKeypair: nBitsForKeypair,
+		Testnet:         testnet,
+		Password:        password,
+		Mnemonic:        mnemonic,
+		CreationDate:    creationDate,
+		DbInit:          dbInit,
+	})
+}
+
+// DoInitOpts initializes a new repo as described by opts
+func DoInitOpts(opts InitOptions) error {
+	_, err := DoInitOptsResult(context.Background(), opts)
+	return err
+}
+
+// DoInitOptsResult initializes a new repo as described by opts and returns the
+// peer ID, mnemonic and identity key of the new node. Cancelling ctx aborts
+// the init and rolls back anything that was already written.
+func DoInitOptsResult(ctx context.Context, opts InitOptions) (*InitResult, error) {
+	if opts.Mnemonic == "" && opts.MnemonicSource != nil {
+		mnemonic, err := opts.MnemonicSource.ReadMnemonic()
+		if err != nil {
+			return nil, err
+		}
+		opts.Mnemonic = mnemonic
+	}
+	if opts.NBitsForKeypair == 0 {
+		opts.NBitsForKeypair = Ed25519KeypairBits
+	}
+	if opts.MnemonicEntropy == 0 {
+		opts.MnemonicEntropy = DefaultMnemonicEntropy
+	}
+	if opts.Passphrase == "" && !opts.NoPassphrase {
+		opts.Passphrase = DefaultSeedPassphrase
+	}
+	if opts.Events != nil {
+		opts.Progress = eventProgress(opts.Events)
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	var res *InitResult
+	var err error
+	if opts.DisableMnemonicGeneration && opts.Mnemonic == "" && len(opts.IdentityKey) == 0 {
+		err = ErrNoKeyMaterial
+	} else {
+		res, err = doInit(ctx, opts)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = wrapErrorf(ErrInitTimeout, err, "after %s", opts.Timeout)
+	}
+	if opts.Events != nil {
+		message := "Initialized OpenBazaar node"
+		if err != nil {
+			message = "Initialization failed"
+		}
+		sendInitEvent(opts.Events, InitEvent{Stage: EventDone, Message: message, Err: err})
+		close(opts.Events)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DoInitWithMnemonic initializes the repo like DoInit and returns the mnemonic
+// that was used, whether it was supplied by the caller or newly generated.
+func DoInitWithMnemonic(repoRoot string, nBitsForKeypair int, testnet bool, password string, mnemonic string, creationDate time.Time, dbInit func(string, []byte, string, time.Time) error) (string, error) {
+	if err := validateKeypairBits(nBitsForKeypair); err != nil {
+		return "", err
+	}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRoot,
+		NBitsForKeypair: nBitsForKeypair,
+		Testnet:         testnet,
+		Password:        password,
+		Mnemonic:        mnemonic,
+		CreationDate:    creationDate,
+		DbInit:          dbInit,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.Mnemonic, nil
+}
+
+// DoInitWithBackend initializes the repo like DoInitOptsResult but keeps the
+// IPFS repo in backend rather than in an fsrepo under the repo root, for
+// embedders that supply their own storage. A nil backend, or any nil field of
+// it, falls back to fsrepo.
+func DoInitWithBackend(ctx context.Context, opts InitOptions, backend *RepoBackend) (*InitResult, error) {
+	opts.backend = backend
+	return DoInitOptsResult(ctx, opts)
+}
+
+// DoInitFromKey initializes the repo like DoInitOptsResult with
+// opts.IdentityKey, a key generated outside of OpenBazaar such as by an HSM,
+// skipping the mnemonic and seed entirely. Any mnemonic in opts is ignored, so
+// dbInit is called with an empty one and the result's Mnemonic is empty. The
+// key must be a marshalled libp2p private key.
+func DoInitFromKey(ctx context.Context, opts InitOptions) (*InitResult, error) {
+	if len(opts.IdentityKey) == 0 {
+		return nil, ErrInvalidIdentityKey
+	}
+	opts.Mnemonic, opts.MnemonicSource = "", nil
+	return DoInitOptsResult(ctx, opts)
+}
+
+// DoInitPreservingIdentity rebuilds a corrupted repo from scratch while
+// keeping its identity, so the peer ID and store URL stay the same. The
+// identity key, mnemonic and creation date are read from db in place of those
+// in opts, the config, keystore and IPFS datastore are moved to a backup
+// directory, and init then runs again like DoInitOptsResult with the existing
+// key, re-publishing the keyspace. It returns ErrNoIdentity if db holds no
+// identity key.
+func DoInitPreservingIdentity(ctx context.Context, opts InitOptions, db Config) (*InitResult, error) {
+	identityKey, err := db.GetIdentityKey()
+	if err != nil {
+		return nil, wrapError(ErrNoIdentity, err)
+	}
+	if len(identityKey) == 0 {
+		return nil, ErrNoIdentity
+	}
+	mnemonic, err := db.GetMnemonic()
+	if err != nil {
+		return nil, err
+	}
+	creationDate, err := db.GetCreationDate()
+	if err != nil {
+		return nil, err
+	}
+	opts.IdentityKey, opts.Mnemonic, opts.MnemonicSource, opts.CreationDate = identityKey, mnemonic, nil, creationDate
+	opts.Force, opts.rebuild = true, true
+	return DoInitOptsResult(ctx, opts)
+}
+
+// doInit runs the init described by opts without filling in the defaults of
+// its exported fields. If IdentityKey is nil it is derived from the mnemonic,
+// which is generated when empty.
+func doInit(ctx context.Context, opts InitOptions) (*InitResult, error) {
+	if err := validateKeypairBits(opts.NBitsForKeypair); err != nil {
+		return nil, err
+	}
+	wl, err := getWordlist(opts.MnemonicLanguage)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Mnemonic != "" {
+		// Stray whitespace from pasting would otherwise change the seed
+		opts.Mnemonic = normalizeMnemonic(opts.Mnemonic)
+		if err := validateMnemonicWords(opts.Mnemonic, wl); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Progress == nil {
+		opts.Progress = printProgress
+	}
+	if opts.dirMode == 0 {
+		opts.dirMode = DefaultDirectoryMode
+	}
+	if err := opts.DirectoryPermissions.validate(); err != nil {
+		return nil, err
+	}
+	if opts.SwarmKey != nil {
+		if err := validateSwarmKey(opts.SwarmKey); err != nil {
+			return nil, err
+		}
+	}
+	if opts.WelcomePost != nil && opts.WelcomePost.Title == "" && opts.WelcomePost.Content == "" {
+		return nil, ErrInvalidWelcomePost
+	}
+	pinCids, err := parsePins(opts.Pins)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SkipKeyspaceInit && len(pinCids) > 0 {
+		return nil, errors.New("Content can't be pinned when the keyspace init is skipped")
+	}
+	opts.backend = opts.backend.withDefaults()
+	repoRoot, backend := opts.RepoRoot, opts.backend
+	if err := checkFreeDiskSpace(repoRoot); err != nil {
+		return nil, err
+	}
+
+	// An existing repo is refused before anything is written to it. The
+	// config of a repo whose init is still running already exists, so that
+	// case is left to the init lock to report.
+	if !opts.Force && !opts.rebuild && backend.IsInitialized(repoRoot) {
+		if _, err := os.Stat(path.Join(repoRoot, initLockFile)); os.IsNotExist(err) {
+			return nil, ErrRepoExists
+		}
+	}
+
+	// The init lock lives in the repo root so the root has to exist first
+	fi, statErr := os.Stat(repoRoot)
+	rootExisted := statErr == nil
+	if rootExisted && !fi.IsDir() {
+		return nil, wrapErrorf(ErrRepoRootNotDirectory, nil, "%s", repoRoot)
+	}
+	if err := os.MkdirAll(repoRoot, opts.dirMode); err != nil {
+		return nil, wrapError(ErrNotWriteable, err)
+	}
+	initLock, err := lockRepoInit(repoRoot)
+	if err != nil {
+		if !rootExisted {
+			os.Remove(repoRoot)
+		}
+		return nil, err
+	}
+	defer initLock.Close()
+	// The lock file seen above may have been left behind, or its init may
+	// have finished since. The root existed, so only the lock was added and
+	// closing it removes it.
+	if !opts.Force && !opts.rebuild && backend.IsInitialized(repoRoot) {
+		return nil, ErrRepoExists
+	}
+
+	// Back up the existing keys before taking the snapshot so that a failed
+	// init never rolls back the backup. Rolling back moves them back.
+	var backupDir string
+	if opts.rebuild || opts.Force && backend.IsInitialized(repoRoot) {
+		backupDir, err = backupRepoKeys(repoRoot, time.Now(), opts.rebuild)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot := snapshotRepoRoot(repoRoot)
+	snapshot.existed[repoRoot] = rootExisted
+	createdKeystore := false
+	// rollback leaves the repo root re-initializable rather than half
+	// initialized, and as it was before a forced reinit
+	rollback := func() {
+		snapshot.rollback()
+		if createdKeystore {
+			os.RemoveAll(opts.KeystorePath)
+		}
+		if backupDir != "" {
+			if err := restoreRepoKeys(repoRoot, backupDir, opts.rebuild); err != nil {
+				log.Errorf("Could not restore the repo backed up to %s: %s", backupDir, err)
+			}
+		}
+	}
+	opts.Progress(InitStageDirectories)
+	if err := maybeCreateOBDirectories(osFS{}, repoRoot, opts.dirMode); err != nil {
+		rollback()
+		return nil, err
+	}
+
+	if err := applyDirectoryPermissions(repoRoot, opts.dirMode, opts.DirectoryPermissions); err != nil {
+		rollback()
+		return nil, err
+	}
+
+	if opts.PlaceholderImages {
+		if err := writePlaceholderImages(repoRoot); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+
+	if opts.KeystorePath != "" {
+		createdKeystore, err = linkKeystore(repoRoot, opts.KeystorePath)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+
+	res, err := initRepo(ctx, opts, wl, pinCids)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	res.BackupDir = backupDir
+	if opts.WritePeerID {
+		if err := ioutil.WriteFile(path.Join(repoRoot, peerIDFile), []byte(res.PeerID+"\n"), 0644); err != nil {
+			if res.Node != nil {
+				res.Node.Close()
+			}
+			rollback()
+			return nil, err
+		}
+	}
+	if opts.WelcomePost != nil {
+		if err := writeWelcomePost(repoRoot, opts.WelcomePost, res.IdentityKey, res.PeerID, time.Now()); err != nil {
+			if res.Node != nil {
+				res.Node.Close()
+			}
+			rollback()
+			return nil, err
+		}
+	}
+	if opts.PostInit != nil {
+		if err := opts.PostInit(repoRoot, res.PeerID); err != nil {
+			if res.Node != nil {
+				res.Node.Close()
+			}
+			rollback()
+			return nil, wrapError(ErrPostInit, err)
+		}
+	}
+	// The repo is usable without the summary so a failure isn't fatal
+	if err := writeInitSummary(repoRoot, opts.Testnet, opts.Overrides, res.PeerID); err != nil {
+		log.Warningf("Could not write the init summary: %s", err)
+	}
+	return res, nil
+}
+
+// linkKeystore creates the keystore at keystorePath, unless it exists, and
+// links the repo's keystore to it. fsrepo always opens the keystore under the
+// repo root so it can't be configured to live elsewhere. It reports whether
+// keystorePath was created.
+func linkKeystore(repoRoot, keystorePath string) (bool, error) {
+	target, err := filepath.Abs(keystorePath)
+	if err != nil {
+		return false, err
+	}
+	link := path.Join(repoRoot, "keystore")
+	if _, err := os.Lstat(link); err == nil {
+		return false, fmt.Errorf("Keystore already exists at %s", link)
+	}
+	created := false
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		if err := os.MkdirAll(target, 0700); err != nil {
+			return false, err
+		}
+		created = true
+	} else if err != nil {
+		return false, err
+	}
+	if err := os.Symlink(target, link); err != nil {
+		if created {
+			os.Remove(target)
+		}
+		return false, err
+	}
+	return created, nil
+}
+
+// initLockFile is held for the duration of an init so that concurrent inits
+// of the same repo root fail instead of corrupting it. It is separate from
+// the fsrepo lock, which the init takes itself.
+const initLockFile = "init.lock"
+
+// lockRepoInit takes the init lock of repoRoot. The returned closer releases
+// the lock and removes the lock file.
+func lockRepoInit(repoRoot string) (io.Closer, error) {
+	l, err := lock.Lock(path.Join(repoRoot, initLockFile))
+	if err != nil {
+		if strings.Contains(err.Error(), "already locked") || strings.Contains(err.Error(), "resource temporarily unavailable") {
+			return nil, ErrInitInProgress
+		}
+		return nil, wrapError(ErrNotWriteable, err)
+	}
+	return l, nil
+}
+
+// peerIDFile optionally records the peer ID of a newly initialized node
+const peerIDFile = "peerid"
+
+// backedUpRepoFiles are moved aside by a forced reinit. The keystore holds
+// any IPNS keys besides the identity.
+var backedUpRepoFiles = []string{"config", "keystore"}
+
+// backedUpDatabases hold the mnemonic and identity key. They may still be
+// open by the caller's dbInit, so they are copied rather than moved.
+var backedUpDatabases = []string{"mainnet.db", "testnet.db"}
+
+// backupRepoKeys moves the identity of an initialized repo into a new
+// timestamped directory under repoRoot/backups and returns its path. If
+// rebuild is set the IPFS datastore and blocks are moved there as well, so
+// that init starts them from scratch.
+func backupRepoKeys(repoRoot string, now time.Time, rebuild bool) (string, error) {
+	backupDir, err := newBackupDir(repoRoot, now)
+	if err != nil {
+		return "", err
+	}
+	if err := copyDatabases(repoRoot, backupDir); err != nil {
+		return "", err
+	}
+	for _, name := range backedUpRepoFiles {
+		p := path.Join(repoRoot, name)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(p, path.Join(backupDir, name)); err != nil {
+			return "", err
+		}
+	}
+	if rebuild {
+		if err := backupIPFSDatastore(repoRoot, backupDir); err != nil {
+			return "", err
+		}
+	}
+	return backupDir, nil
+}
+
+// restoreRepoKeys moves what backupRepoKeys moved to backupDir back into
+// repoRoot, once the failed init has been rolled back, and removes backupDir.
+// The databases were only copied so they are left as they are.
+func restoreRepoKeys(repoRoot, backupDir string, rebuild bool) error {
+	if rebuild {
+		if err := restoreIPFSDatastore(repoRoot, backupDir); err != nil {
+			return err
+		}
+	}
+	for _, name := range backedUpRepoFiles {
+		p := path.Join(backupDir, name)
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(p, path.Join(repoRoot, name)); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(backupDir)
+}
+
+// newBackupDir creates a new timestamped directory under repoRoot/backups
+func newBackupDir(repoRoot string, now time.Time) (string, error) {
+	backupDir := path.Join(repoRoot, "backups", now.UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(path.Dir(backupDir), 0700); err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(backupDir, 0700); err != nil {
+		return "", err
+	}
+	return backupDir, nil
+}
+
+// copyDatabases copies backedUpDatabases to backupDir
+func copyDatabases(repoRoot, backupDir string) error {
+	for _, name := range backedUpDatabases {
+		b, err := ioutil.ReadFile(path.Join(repoRoot, "datastore", name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path.Join(backupDir, name), b, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupIPFSDatastore moves the blocks and the leveldb files of the datastore
+// directory to backupDir. The databases sharing the datastore directory are
+// left in place.
+func backupIPFSDatastore(repoRoot, backupDir string) error {
+	p := path.Join(repoRoot, "blocks")
+	if _, err := os.Stat(p); err == nil {
+		if err := os.Rename(p, path.Join(backupDir, "blocks")); err != nil {
+			return err
+		}
+	}
+	dsDir := path.Join(repoRoot, "datastore")
+	entries, err := ioutil.ReadDir(dsDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.Mkdir(path.Join(backupDir, "datastore"), 0700); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if isDatabaseFile(e.Name()) {
+			continue
+		}
+		if err := os.Rename(path.Join(dsDir, e.Name()), path.Join(backupDir, "datastore", e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreIPFSDatastore moves the blocks and leveldb files backed up by
+// backupIPFSDatastore back, replacing those the failed init wrote
+func restoreIPFSDatastore(repoRoot, backupDir string) error {
+	p := path.Join(backupDir, "blocks")
+	if _, err := os.Stat(p); err == nil {
+		if err := os.RemoveAll(path.Join(repoRoot, "blocks")); err != nil {
+			return err
+		}
+		if err := os.Rename(p, path.Join(repoRoot, "blocks")); err != nil {
+			return err
+		}
+	}
+	backupDsDir := path.Join(backupDir, "datastore")
+	entries, err := ioutil.ReadDir(backupDsDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	dsDir := path.Join(repoRoot, "datastore")
+	written, err := ioutil.ReadDir(dsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range written {
+		if isDatabaseFile(e.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(dsDir, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dsDir, 0700); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.Rename(path.Join(backupDsDir, e.Name()), path.Join(dsDir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(backupDsDir)
+}
+
+// isDatabaseFile reports whether name is one of backedUpDatabases or one of
+// their journal and WAL files
+func isDatabaseFile(name string) bool {
+	for _, db := range backedUpDatabases {
+		if strings.HasPrefix(name, db) {
+			return true
+		}
+	}
+	return false
+}
+
+// initRepo writes the IPFS repo, config and database of the init described by
+// opts, whose mnemonic was validated against wl, and initializes the keyspace
+func initRepo(ctx context.Context, opts InitOptions, wl *wordlist, pins []*cid.Cid) (*InitResult, error) {
+	repoRoot, overrides, backend, progress := opts.RepoRoot, opts.Overrides, opts.backend, opts.Progress
+	mnemonic, identityKey, passphrase := opts.Mnemonic, opts.IdentityKey, opts.Passphrase
+	if err := checkWriteable(osFS{}, repoRoot); err != nil {
+		return nil, err
+	}
+
+	conf, err := InitConfig(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySwarmAddresses(conf, overrides); err != nil {
+		return nil, err
+	}
+	if err := applyRecordLifetime(conf, overrides); err != nil {
+		return nil, err
+	}
+	if overrides != nil && overrides.Wallet != nil {
+		if err := validateTrustedPeer(overrides.Wallet.TrustedPeer); err != nil {
+			return nil, err
+		}
+		// A zero Wallet.MaxFee is unset
+		if overrides.Wallet.MaxFee != 0 {
+			if err := validateMaxFee(overrides.Wallet.MaxFee); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if overrides != nil && overrides.MaxFee != nil {
+		if err := validateMaxFee(*overrides.MaxFee); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := DiffConfigOverrides(overrides)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SwarmKey != nil {
+		// The public bootstrap peers aren't on the private network. Its own
+		// can be set with IPFSConfig.
+		conf.Bootstrap = nil
+	}
+	if overrides != nil && overrides.IPFSConfig != nil {
+		if err := overrides.IPFSConfig(conf); err != nil {
+			return nil, err
+		}
+	}
+	var extensions []configExtension
+	if overrides != nil && overrides.ImportConfigFrom != "" {
+		extensions, err = readImportedConfig(overrides.ImportConfigFrom)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	derivation := KeyDerivation{Source: KeySourceImported}
+	if identityKey == nil {
+		if mnemonic == "" {
+			newEntropy := bip39.NewEntropy
+			if opts.Entropy != nil {
+				newEntropy = entropyFromReader(opts.Entropy)
+			}
+			mnemonic, err = createMnemonic(opts.MnemonicEntropy, newEntropy, wl.newMnemonic)
+			if err != nil {
+				return nil, wrapError(ErrKeyGeneration, err)
+			}
+		} else {
+			// Let users restoring a backup confirm it before funds depend on it
+			progress(InitStageMnemonic + ": " + analyzeMnemonic(mnemonic, wl).String())
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if opts.ConfirmMnemonic != nil {
+			if err := confirmMnemonic(mnemonic, opts.ConfirmMnemonic); err != nil {
+				return nil, err
+			}
+		}
+		progress(InitStageKeyGeneration)
+		identityKey, err = identityKeyFromMnemonic(mnemonic, passphrase, opts.NBitsForKeypair, opts.AccountIndex)
+		if err != nil {
+			return nil, wrapError(ErrKeyGeneration, err)
+		}
+		derivation = KeyDerivation{
+			Source:           KeySourceMnemonic,
+			Scheme:           identityKeyScheme,
+			MnemonicLanguage: wl.language,
+			MnemonicWords:    len(strings.Fields(mnemonic)),
+			CustomPassphrase: passphrase != DefaultSeedPassphrase,
+			AccountIndex:     opts.AccountIndex,
+		}
+	}
+	if derivation.KeyType, err = ipfs.KeyTypeFromKey(identityKey); err != nil {
+		return nil, wrapError(ErrKeyGeneration, err)
+	}
+	log.Debugf("Identity key derivation: %s", derivation)
+
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		return nil, wrapError(ErrKeyGeneration, err)
+	}
+	publicKey, err := ipfs.PublicKeyEncodingsFromKey(identityKey)
+	if err != nil {
+		return nil, wrapError(ErrKeyGeneration, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	log.Infof("Initializing OpenBazaar node at %s\n", repoRoot)
+	progress(InitStageRepo)
+	if err := backend.Init(repoRoot, conf); err != nil {
+		return nil, wrapError(ErrRepoInit, err)
+	}
+	conf.Identity = identity
+	if opts.SwarmKey != nil {
+		if err := writeSwarmKey(repoRoot, opts.SwarmKey); err != nil {
+			return nil, wrapError(ErrRepoInit, err)
+		}
+	}
+
+	if _, err := addConfigExtensions(backend.Open, repoRoot, opts.Testnet, opts.CreationDate, overrides); err != nil {
+		return nil, wrapError(ErrConfigWrite, err)
+	}
+	if mnemonic != "" {
+		extensions = append(extensions, configExtension{mnemonicLanguageKey, wl.language})
+	}
+	if len(opts.DirectoryPermissions) > 0 {
+		modes, _ := directoryModes(opts.dirMode, opts.DirectoryPermissions)
+		extensions = append(extensions, configExtension{directoryModesKey, formatDirectoryModes(modes)})
+	}
+	if len(extensions) > 0 {
+		if err := extendConfig(backend.Open, repoRoot, extensions); err != nil {
+			return nil, wrapError(ErrConfigWrite, err)
+		}
+	}
+	cfgBytes, err := verifyConfigSections(backend.Open, repoRoot)
+	if err != nil {
+		return nil, wrapError(ErrConfigWrite, err)
+	}
+	if err := writeRepoVersion(repoRoot, RepoVersion); err != nil {
+		return nil, wrapError(ErrConfigWrite, err)
+	}
+	if err := writeCapabilities(repoRoot, cfgBytes); err != nil {
+		return nil, wrapError(ErrConfigWrite, err)
+	}
+	if err := writeDirectoryManifests(repoRoot); err != nil {
+		return nil, wrapError(ErrConfigWrite, err)
+	}
 
-	if fsrepo.IsInitialized(repoRoot) {
-		return ErrRepoExists
+	if err := opts.DbInit(normalizeMnemonic(mnemonic), identityKey, opts.Password, opts.CreationDate); err != nil {
+		return nil, wrapError(ErrDatabaseInit, err)
 	}
 
-	if err := checkWriteable(repoRoot); err != nil {
-		return err
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var nd *core.IpfsNode
+	if opts.SkipKeyspaceInit {
+		if err := ioutil.WriteFile(path.Join(repoRoot, keyspacePendingFile), nil, 0644); err != nil {
+			return nil, wrapError(ErrConfigWrite, err)
+		}
+	} else {
+		progress(InitStageKeyspace)
+		nd, err = initializeIpnsKeyspace(ctx, backend.Open, backend.NewNode, repoRoot, identityKey, pins)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return &InitResult{
+		PeerID:        identity.PeerID,
+		Mnemonic:      mnemonic,
+		IdentityKey:   identityKey,
+		KeyDerivation: &derivation,
+		PublicKey:     &publicKey,
+		Node:          nd,
+		ConfigChanges: changes,
+	}, nil
+}
 
-	conf, err := InitConfig(repoRoot)
-	if err != nil {
-		return err
+// Sources of the identity key recorded in KeyDerivation
+const (
+	KeySourceMnemonic = "mnemonic"
+	KeySourceImported = "imported"
+)
+
+// identityKeyScheme is how identityKeyFromMnemonic derives the identity key
+const identityKeyScheme = "BIP39 seed, HMAC-SHA256 keyed with \"OpenBazaar seed\" over the seed and a big endian account index unless 0, as the Ed25519 key generator's randomness"
+
+// KeyDerivation describes how an identity key was derived, so that two
+// clients deriving different peer IDs from the same mnemonic can be compared.
+// The passphrase itself isn't kept, only whether it differs from
+// DefaultSeedPassphrase. Only Source and KeyType are set for an imported key.
+type KeyDerivation struct {
+	Source           string
+	Scheme           string
+	MnemonicLanguage string
+	MnemonicWords    int
+	CustomPassphrase bool
+	AccountIndex     uint32
+	KeyType          string
+}
+
+func (d KeyDerivation) String() string {
+	if d.Source != KeySourceMnemonic {
+		return fmt.Sprintf("source=%s keytype=%s", d.Source, d.KeyType)
 	}
+	return fmt.Sprintf("source=%s language=%s words=%d custompassphrase=%t account=%d keytype=%s scheme=%q", d.Source, d.MnemonicLanguage, d.MnemonicWords, d.CustomPassphrase, d.AccountIndex, d.KeyType, d.Scheme)
+}
 
-	if mnemonic == "" {
-		mnemonic, err = createMnemonic(bip39.NewEntropy, bip39.NewMnemonic)
-		if err != nil {
+// identityKeyFromMnemonic derives the node's identity key. The BIP39 seed is
+// PBKDF2-SHA512(mnemonic, "mnemonic"+passphrase) and the Ed25519 key is then
+// generated from HMAC-SHA256("OpenBazaar seed", seed), with the account index
+// appended to the seed for indices other than 0.
+func identityKeyFromMnemonic(mnemonic, passphrase string, nBitsForKeypair int, accountIndex uint32) ([]byte, error) {
+	seed := bip39.NewSeed(normalizeMnemonic(mnemonic), passphrase)
+	return ipfs.IdentityKeyFromSeedIndex(seed, nBitsForKeypair, accountIndex)
+}
+
+// obDirectories are the directories, relative to the repo root, that
+// OpenBazaar needs in addition to the IPFS repo. Parents precede children.
+var obDirectories = []string{
+	"root",
+	path.Join("root", "listings"),
+	path.Join("root", "ratings"),
+	path.Join("root", "images"),
+	path.Join("root", "images", "tiny"),
+	path.Join("root", "images", "small"),
+	path.Join("root", "images", "medium"),
+	path.Join("root", "images", "large"),
+	path.Join("root", "images", "original"),
+	path.Join("root", "feed"),
+	path.Join("root", "channel"),
+	path.Join("root", "files"),
+	"outbox",
+	"logs",
+}
+
+// obIndexFiles are the indices, relative to the repo root, that are written
+// empty so that readers always find a parseable file. Each holds a JSON array.
+var obIndexFiles = []string{
+	path.Join("root", "listings.json"),
+	path.Join("root", "ratings.json"),
+	path.Join("root", "feed.json"),
+}
+
+// EnsureDirectories creates any OpenBazaar directories and indices missing
+// from an already initialized repo, such as those added after the repo was
+// created. The config and database are left untouched.
+func EnsureDirectories(repoRoot string) error {
+	return maybeCreateOBDirectories(osFS{}, repoRoot, DefaultDirectoryMode)
+}
+
+// maybeCreateOBDirectories creates any missing OpenBazaar directories with
+// the given mode, and any missing indices. Existing directories keep their
+// permissions.
+func maybeCreateOBDirectories(fs initFS, repoRoot string, mode os.FileMode) error {
+	for _, dir := range obDirectories {
+		p := path.Join(repoRoot, dir)
+		if _, err := fs.Stat(p); err == nil {
+			continue
+		}
+		if err := fs.MkdirAll(p, mode); err != nil {
+			return err
+		}
+		// MkdirAll is subject to the umask, so set the mode explicitly
+		if err := fs.Chmod(p, mode); err != nil {
 			return err
 		}
 	}
-	seed := bip39.NewSeed(mnemonic, "Secret Passphrase")
-	fmt.Printf("Generating Ed25519 keypair...")
-	identityKey, err := ipfs.IdentityKeyFromSeed(seed, nBitsForKeypair)
-	if err != nil {
-		return err
+	return maybeCreateIndexFiles(fs, repoRoot)
+}
+
+// directoryModes returns the mode perms gives each of obDirectories, with
+// search permission on the parents of the directories others are let into,
+// and the search permission the repo root needs for them
+func directoryModes(mode os.FileMode, perms DirectoryPermissions) (map[string]os.FileMode, os.FileMode) {
+	modes := make(map[string]os.FileMode, len(obDirectories))
+	for _, dir := range obDirectories {
+		modes[dir] = perms.modeFor(dir, mode)
+	}
+	var rootSearch os.FileMode
+	for _, dir := range obDirectories {
+		search := modes[dir] & 0011
+		for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+			modes[p] |= search
+		}
+		rootSearch |= search
 	}
-	fmt.Printf("Done\n")
+	return modes, rootSearch
+}
 
-	identity, err := ipfs.IdentityFromKey(identityKey)
+// applyDirectoryPermissions sets the mode of each of obDirectories according
+// to perms, granting search permission on the parents of the directories
+// others are let into
+func applyDirectoryPermissions(repoRoot string, mode os.FileMode, perms DirectoryPermissions) error {
+	if len(perms) == 0 {
+		return nil
+	}
+	modes, rootSearch := directoryModes(mode, perms)
+	for _, dir := range obDirectories {
+		if err := os.Chmod(path.Join(repoRoot, dir), modes[dir]); err != nil {
+			return err
+		}
+	}
+	if rootSearch == 0 {
+		return nil
+	}
+	fi, err := os.Stat(repoRoot)
 	if err != nil {
 		return err
 	}
+	return os.Chmod(repoRoot, fi.Mode().Perm()|rootSearch)
+}
 
-	log.Infof("Initializing OpenBazaar node at %s\n", repoRoot)
-	if err := fsrepo.Init(repoRoot, conf); err != nil {
-		return err
+// maybeCreateIndexFiles writes an empty index for each of obIndexFiles that
+// doesn't exist yet
+func maybeCreateIndexFiles(fs initFS, repoRoot string) error {
+	for _, name := range obIndexFiles {
+		p := path.Join(repoRoot, name)
+		if _, err := fs.Stat(p); err == nil {
+			continue
+		}
+		if err := fs.WriteFile(p, []byte("[]"), 0644); err != nil {
+			return err
+		}
 	}
-	conf.Identity = identity
+	return nil
+}
 
-	if err := addConfigExtensions(repoRoot, testnet); err != nil {
-		return err
-	}
+// initSnapshot records which paths existed before an init started so that a
+// failed init can remove only what it created.
+type initSnapshot struct {
+	repoRoot string
+	existed  map[string]bool
+}
 
-	if err := dbInit(mnemonic, identityKey, password, creationDate); err != nil {
-		return err
+func snapshotRepoRoot(repoRoot string) *initSnapshot {
+	snapshot := &initSnapshot{repoRoot: repoRoot, existed: make(map[string]bool)}
+	if _, err := os.Stat(repoRoot); err != nil {
+		return snapshot
+	}
+	snapshot.existed[repoRoot] = true
+	entries, err := ioutil.ReadDir(repoRoot)
+	if err == nil {
+		for _, fi := range entries {
+			snapshot.existed[path.Join(repoRoot, fi.Name())] = true
+		}
+	}
+	for _, dir := range obDirectories {
+		p := path.Join(repoRoot, dir)
+		if _, err := os.Stat(p); err == nil {
+			snapshot.existed[p] = true
+		}
 	}
+	return snapshot
+}
 
-	return initializeIpnsKeyspace(repoRoot, identityKey)
+// rollback removes everything created since the snapshot was taken
+func (s *initSnapshot) rollback() {
+	if !s.existed[s.repoRoot] {
+		if err := os.RemoveAll(s.repoRoot); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	for i := len(obDirectories) - 1; i >= 0; i-- {
+		p := path.Join(s.repoRoot, obDirectories[i])
+		if !s.existed[p] {
+			if err := os.RemoveAll(p); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+	entries, err := ioutil.ReadDir(s.repoRoot)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, fi := range entries {
+		p := path.Join(s.repoRoot, fi.Name())
+		if !s.existed[p] {
+			if err := os.RemoveAll(p); err != nil {
+				log.Error(err)
+			}
+		}
+	}
 }
 
-func maybeCreateOBDirectories(repoRoot string) error {
-	if err := os.MkdirAll(path.Join(repoRoot, "root"), os.ModePerm); err != nil {
-		return err
+func checkWriteable(fs initFS, dir string) error {
+	fi, err := fs.Stat(dir)
+	if err == nil && !fi.IsDir() {
+		// A file named like the repo root is most likely a mistyped path
+		return wrapErrorf(ErrRepoRootNotDirectory, nil, "%s", dir)
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "listings"), os.ModePerm); err != nil {
-		return err
+	if os.IsNotExist(err) {
+		// Directory does not exist, check that we can create it along with any missing parents
+		if err := fs.MkdirAll(dir, 0775); err != nil {
+			if os.IsPermission(err) {
+				return wrapErrorf(ErrNotWriteable, err, "cannot create %s, incorrect permissions", dir)
+			}
+			return wrapError(ErrNotWriteable, err)
+		}
+	} else if err != nil {
+		if os.IsPermission(err) {
+			return wrapErrorf(ErrNotWriteable, err, "cannot write to %s, incorrect permissions", dir)
+		}
+		return wrapError(ErrNotWriteable, err)
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "ratings"), os.ModePerm); err != nil {
-		return err
+
+	// Directory exists, make sure we can write to it
+	return probeWriteable(fs, dir)
+}
+
+// writeCheckPrefix starts the name of the probe file created by
+// probeWriteable. The rest of the name is random so the probe never clobbers
+// a user's file or collides with another process probing the same directory.
+const writeCheckPrefix = ".ob-writecheck-"
+
+func probeWriteable(fs initFS, dir string) error {
+	name, err := fs.TempFile(dir, writeCheckPrefix)
+	if err != nil {
+		if os.IsPermission(err) {
+			return wrapErrorf(ErrNotWriteable, err, "%s is not writeable by the current user", dir)
+		}
+		return wrapErrorf(ErrNotWriteable, err, "unexpected error while checking writeablility of repo root")
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "images"), os.ModePerm); err != nil {
-		return err
+	if err := fs.Remove(name); err != nil {
+		return wrapError(ErrNotWriteable, err)
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "images", "tiny"), os.ModePerm); err != nil {
+	return nil
+}
+
+// ValidateInit checks that DoInit would succeed for the repo root and
+// mnemonic without creating any directories or files. The mnemonic is checked
+// against the wordlist of language, which defaults to English like
+// InitOptions.MnemonicLanguage.
+func ValidateInit(repoRoot string, mnemonic string, language string, mnemonicEntropy int) error {
+	if mnemonic != "" {
+		wl, err := getWordlist(language)
+		if err != nil {
+			return err
+		}
+		if err := validateMnemonicWords(mnemonic, wl); err != nil {
+			return err
+		}
+	} else if err := validateMnemonicEntropy(mnemonicEntropy); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "images", "small"), os.ModePerm); err != nil {
-		return err
+
+	if fsrepo.IsInitialized(repoRoot) {
+		return ErrRepoExists
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "images", "medium"), os.ModePerm); err != nil {
-		return err
+
+	for _, dir := range obDirectories {
+		p := path.Join(repoRoot, dir)
+		fi, err := os.Stat(p)
+		if err == nil && !fi.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", p)
+		}
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "images", "large"), os.ModePerm); err != nil {
-		return err
+
+	// DoInit creates any missing directories below the closest existing one
+	dir := repoRoot
+	for {
+		_, err := os.Stat(dir)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "images", "original"), os.ModePerm); err != nil {
-		return err
+	return probeWriteable(osFS{}, dir)
+}
+
+// ReinitializeKeyspace re-publishes the IPNS keyspace record of an existing
+// repo using the identity key stored in db, the repo's database. The database
+// and config are left untouched.
+func ReinitializeKeyspace(repoRoot string, db Config) error {
+	if !fsrepo.IsInitialized(repoRoot) {
+		return fmt.Errorf("No initialized repo found at %s", repoRoot)
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "feed"), os.ModePerm); err != nil {
+	identityKey, err := db.GetIdentityKey()
+	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "channel"), os.ModePerm); err != nil {
-		return err
+	if len(identityKey) == 0 {
+		return ErrNoIdentity
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "root", "files"), os.ModePerm); err != nil {
-		return err
+	return reinitializeKeyspace(repoRoot, identityKey)
+}
+
+func reinitializeKeyspace(repoRoot string, identityKey []byte) error {
+	_, err := initializeIpnsKeyspace(context.Background(), fsrepo.Open, nil, repoRoot, identityKey, nil)
+	return err
+}
+
+// keyspacePendingFile marks a repo whose IPNS keyspace init was skipped
+const keyspacePendingFile = "keyspace.pending"
+
+// IsKeyspacePending reports whether the repo was initialized without its IPNS
+// keyspace
+func IsKeyspacePending(repoRoot string) bool {
+	_, err := os.Stat(path.Join(repoRoot, keyspacePendingFile))
+	return err == nil
+}
+
+// CompletePendingKeyspace initializes the IPNS keyspace of a repo initialized
+// with SkipKeyspaceInit and clears the pending flag. It does nothing for
+// other repos.
+func CompletePendingKeyspace(repoRoot string, db Config) error {
+	if !IsKeyspacePending(repoRoot) {
+		return nil
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "outbox"), os.ModePerm); err != nil {
+	identityKey, err := db.GetIdentityKey()
+	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(path.Join(repoRoot, "logs"), os.ModePerm); err != nil {
+	if err := reinitializeKeyspace(repoRoot, identityKey); err != nil {
 		return err
 	}
-	return nil
+	return os.Remove(path.Join(repoRoot, keyspacePendingFile))
 }
 
-func checkWriteable(dir string) error {
-	_, err := os.Stat(dir)
-	if err == nil {
-		// Directory exists, make sure we can write to it
-		testfile := path.Join(dir, "test")
-		fi, err := os.Create(testfile)
-		if err != nil {
-			if os.IsPermission(err) {
-				return fmt.Errorf("%s is not writeable by the current user", dir)
-			}
-			return fmt.Errorf("Unexpected error while checking writeablility of repo root: %s", err)
-		}
-		fi.Close()
-		return os.Remove(testfile)
-	}
+// RetryPolicy bounds how often a transiently failing step is attempted. The
+// wait between attempts starts at Backoff and doubles after each attempt.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
 
-	if os.IsNotExist(err) {
-		// Directory does not exist, check that we can create it
-		return os.Mkdir(dir, 0775)
-	}
+// KeyspaceRetryPolicy is used to initialize the IPNS keyspace, which can fail
+// transiently on contended systems while the datastore is busy
+var KeyspaceRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond}
 
-	if os.IsPermission(err) {
-		return fmt.Errorf("Cannot write to %s, incorrect permissions", err)
+// retryWithBackoff calls fn until it succeeds or the policy's attempts run
+// out, returning the last error. It stops waiting as soon as ctx is done.
+func retryWithBackoff(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	backoff := policy.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= policy.Attempts {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warningf("Attempt %d of %d failed, retrying in %s: %s", attempt, policy.Attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
-
-	return err
 }
 
-func initializeIpnsKeyspace(repoRoot string, privKeyBytes []byte) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// initializeIpnsKeyspace wraps failures in ErrKeyspaceInit, except for a
+// cancelled ctx whose error is returned as is. If newNode is nil the keyspace
+// is initialized with a throwaway offline node and nil is returned, otherwise
+// the node built by newNode is returned still running.
+func initializeIpnsKeyspace(ctx context.Context, open openRepoFunc, newNode newNodeFunc, repoRoot string, privKeyBytes []byte, pins []*cid.Cid) (*core.IpfsNode, error) {
+	var nd *core.IpfsNode
+	err := retryWithBackoff(ctx, KeyspaceRetryPolicy, func() error {
+		var err error
+		nd, err = initializeIpnsKeyspaceOnce(ctx, open, newNode, repoRoot, privKeyBytes, pins)
+		return err
+	})
+	if err == nil || err == ctx.Err() {
+		return nd, err
+	}
+	return nil, wrapError(ErrKeyspaceInit, err)
+}
 
-	r, err := fsrepo.Open(repoRoot)
+func initializeIpnsKeyspaceOnce(ctx context.Context, open openRepoFunc, newNode newNodeFunc, repoRoot string, privKeyBytes []byte, pins []*cid.Cid) (*core.IpfsNode, error) {
+	r, err := open(repoRoot)
 	if err != nil { // NB: repo is owned by the node
-		return err
+		return nil, err
 	}
 	cfg, err := r.Config()
 	if err != nil {
 		log.Error(err)
-		return err
+		r.Close()
+		return nil, err
 	}
 	identity, err := ipfs.IdentityFromKey(privKeyBytes)
 	if err != nil {
-		return err
+		r.Close()
+		return nil, err
 	}
-
 	cfg.Identity = identity
-	nd, err := core.NewNode(ctx, &core.BuildCfg{Repo: r})
+	lifetime := recordLifetime(cfg)
+
+	if newNode != nil {
+		nd, err := newNode(ctx, r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		publisher := lifetimePublisher{nd.Namesys, lifetime}
+		if err := namesys.InitializeKeyspace(ctx, nd.DAG, publisher, nd.Pinning, nd.PrivateKey); err != nil {
+			nd.Close()
+			return nil, err
+		}
+		if err := verifyKeyspace(ctx, nd); err != nil {
+			nd.Close()
+			return nil, err
+		}
+		if err := pinContent(ctx, nd, pins); err != nil {
+			nd.Close()
+			return nil, err
+		}
+		return nd, nil
+	}
+
+	// The throwaway node doesn't own the repo so that what it leaves behind
+	// can be cleaned up once it is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	nd, err := core.NewNode(ctx, &core.BuildCfg{Repo: unownedRepo{r}})
 	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	err = initializeOfflineKeyspace(ctx, nd, lifetime, pins)
+	nd.Close()
+	if cerr := cleanupKeyspaceNode(r.Datastore()); err == nil {
+		err = cerr
+	}
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	return nil, err
+}
+
+func initializeOfflineKeyspace(ctx context.Context, nd *core.IpfsNode, lifetime time.Duration, pins []*cid.Cid) error {
+	if err := nd.SetupOfflineRouting(); err != nil {
+		return err
+	}
+	publisher := lifetimePublisher{nd.Namesys, lifetime}
+	if err := namesys.InitializeKeyspace(ctx, nd.DAG, publisher, nd.Pinning, nd.PrivateKey); err != nil {
+		return err
+	}
+	if err := verifyKeyspace(ctx, nd); err != nil {
 		return err
 	}
-	defer nd.Close()
+	return pinContent(ctx, nd, pins)
+}
 
-	err = nd.SetupOfflineRouting()
+// verifyKeyspace checks that the node's IPNS record, as read from the
+// datastore by an offline router, is valid, signed by the node and points at
+// the empty directory InitializeKeyspace publishes. The namesys resolver isn't
+// used as it resolves from the cache filled by publishing, falls back to a
+// persistent cache, and writes that cache in the background.
+func verifyKeyspace(ctx context.Context, nd *core.IpfsNode) error {
+	name := "/ipns/" + nd.Identity.Pretty()
+	_, ipnsKey := namesys.IpnsKeysForID(nd.Identity)
+	val, err := offroute.NewOfflineRouter(nd.Repo.Datastore(), nd.PrivateKey).GetValue(ctx, ipnsKey)
 	if err != nil {
-		return err
+		return wrapErrorf(ErrKeyspaceUnresolved, err, "%s", name)
+	}
+	if err := namesys.ValidateIpnsRecord(ipnsKey, val); err != nil {
+		return wrapErrorf(ErrKeyspaceUnresolved, err, "%s", name)
 	}
+	entry := new(ipnspb.IpnsEntry)
+	if err := proto.Unmarshal(val, entry); err != nil {
+		return wrapErrorf(ErrKeyspaceUnresolved, err, "%s", name)
+	}
+	// The signed data as put together by the namesys publisher
+	data := bytes.Join([][]byte{entry.Value, entry.Validity, []byte(fmt.Sprint(entry.GetValidityType()))}, nil)
+	if ok, err := nd.PrivateKey.GetPublic().Verify(data, entry.GetSignature()); err != nil || !ok {
+		return wrapErrorf(ErrKeyspaceUnresolved, nil, "%s: record is not signed by the node", name)
+	}
+	p := ipath.Path(entry.GetValue())
+	if expected := ipath.FromCid(ft.EmptyDirNode().Cid()); p != expected {
+		return wrapErrorf(ErrKeyspaceUnresolved, nil, "%s resolves to %s instead of %s", name, p, expected)
+	}
+	return nil
+}
 
-	return namesys.InitializeKeyspace(ctx, nd.DAG, nd.Namesys, nd.Pinning, nd.PrivateKey)
+// unownedRepo is a repo whose Close is left to the caller
+type unownedRepo struct {
+	repo.Repo
 }
 
-func addConfigExtensions(repoRoot string, testnet bool) error {
-	r, err := fsrepo.Open(repoRoot)
-	if err != nil { // NB: repo is owned by the node
+func (unownedRepo) Close() error { return nil }
+
+// filesRootKey is where a node keeps the root of its MFS
+var filesRootKey = ds.NewKey("/local/filesroot")
+
+// cleanupKeyspaceNode removes the state the throwaway keyspace node wrote for
+// itself rather than for the keyspace. The node's MFS root is the only such
+// entry: offline routing only keeps the IPNS and public key records, which
+// the keyspace needs, and the real node creates a new MFS root on startup.
+func cleanupKeyspaceNode(d repo.Datastore) error {
+	if err := d.Delete(filesRootKey); err != nil && err != ds.ErrNotFound {
 		return err
 	}
-	var w WalletConfig = WalletConfig{
-		Type:             "spvwallet",
-		MaxFee:           2000,
-		FeeAPI:           "https://bitcoinfees.21.co/api/v1/fees/recommended",
-		HighFeeDefault:   160,
-		MediumFeeDefault: 140,
-		LowFeeDefault:    120,
-		TrustedPeer:      "",
+	return nil
+}
+
+// pinContent pins each of pins recursively. An online node fetches the
+// content before pinning it, while an offline one records the pins for
+// content it may not have yet.
+func pinContent(ctx context.Context, nd *core.IpfsNode, pins []*cid.Cid) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	for _, c := range pins {
+		if !nd.OnlineMode() {
+			nd.Pinning.PinWithMode(c, pin.Recursive)
+			continue
+		}
+		dn, err := nd.DAG.Get(ctx, c)
+		if err != nil {
+			return fmt.Errorf("Fetching %s to pin: %s", c, err)
+		}
+		if err := nd.Pinning.Pin(ctx, dn, true); err != nil {
+			return err
+		}
+	}
+	return nd.Pinning.Flush()
+}
+
+// parsePins validates the CIDs to pin at init
+func parsePins(pins []string) ([]*cid.Cid, error) {
+	var cids []*cid.Cid
+	for _, p := range pins {
+		c, err := cid.Decode(p)
+		if err != nil {
+			return nil, wrapErrorf(ErrInvalidPinCID, err, "%q", p)
+		}
+		cids = append(cids, c)
 	}
+	return cids, nil
+}
 
-	var a APIConfig = APIConfig{
-		Enabled:     true,
-		AllowedIPs:  []string{},
-		HTTPHeaders: nil,
+// addConfigExtensions adds the OpenBazaar sections to the IPFS config. Only
+// the sections missing from the config are written, so it is also used to
+// upgrade the config of existing repos.
+func addConfigExtensions(open openRepoFunc, repoRoot string, testnet bool, creationDate time.Time, overrides *ConfigOverrides) ([]string, error) {
+	extensions, authenticated, err := obConfigExtensions(testnet, creationDate, overrides)
+	if err != nil {
+		return nil, err
 	}
+	added, err := addMissingConfig(open, repoRoot, extensions)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range added {
+		if key == "JSON-API" && authenticated {
+			return added, writeAuthCookie(repoRoot)
+		}
+	}
+	return added, nil
+}
 
-	var t TorConfig = TorConfig{}
-	if err := extendConfigFile(r, "Wallet", w); err != nil {
-		return err
+// obConfigExtensions returns the OpenBazaar config sections with overrides
+// applied to the defaults, and whether the JSON-API requires authentication
+func obConfigExtensions(testnet bool, creationDate time.Time, overrides *ConfigOverrides) ([]configExtension, bool, error) {
+	w := DefaultWalletConfig
+	if overrides != nil && overrides.Wallet != nil {
+		w = mergeWalletConfig(w, *overrides.Wallet)
 	}
-	if err := extendConfigFile(r, "Resolver", "https://resolver.onename.com/"); err != nil {
-		return err
+	if overrides != nil && overrides.MaxFee != nil {
+		w.MaxFee = *overrides.MaxFee
 	}
-	if err := extendConfigFile(r, "Crosspost-gateways", []string{"https://gateway.ob1.io/", "https://gateway.duosear.ch/"}); err != nil {
-		return err
+	if err := validateWalletType(w.Type); err != nil {
+		return nil, false, err
 	}
-	if err := extendConfigFile(r, "Dropbox-api-token", ""); err != nil {
-		return err
+	if err := validateTrustedPeer(w.TrustedPeer); err != nil {
+		return nil, false, err
 	}
-	if err := extendConfigFile(r, "JSON-API", a); err != nil {
-		return err
+
+	a := DefaultAPIConfig
+	a.AllowedIPs = []string{} // don't share the default's slice
+	if overrides != nil && overrides.API != nil {
+		a = *overrides.API
+		if a.AllowedIPs == nil {
+			a.AllowedIPs = []string{}
+		}
 	}
-	if err := extendConfigFile(r, "Tor-config", t); err != nil {
-		return err
+	if overrides != nil && overrides.APIPassword != "" {
+		a.Authenticated = true
+		a.Username = overrides.APIUsername
+		hash, err := HashAPIPassword(overrides.APIPassword)
+		if err != nil {
+			return nil, false, err
+		}
+		a.Password = hash
+	}
+
+	t := DefaultTorConfig
+	if overrides != nil && overrides.Tor != nil {
+		t = *overrides.Tor
+	}
+
+	gateways := DefaultCrosspostGateways
+	if overrides != nil && len(overrides.CrosspostGateways) > 0 {
+		gateways = normalizeGateways(overrides.CrosspostGateways)
+		if err := validateGateways(gateways, overrides.AllowInsecureGateways); err != nil {
+			return nil, false, err
+		}
+	}
+
+	resolvers := DefaultResolvers
+	if overrides != nil && len(overrides.Resolvers) > 0 {
+		resolvers = overrides.Resolvers
+	}
+
+	moderators := []string{}
+	if overrides != nil && len(overrides.TrustedModerators) > 0 {
+		moderators = overrides.TrustedModerators
+		if err := validateModerators(moderators); err != nil {
+			return nil, false, err
+		}
 	}
-	if err := r.Close(); err != nil {
+
+	return []configExtension{
+		{"Wallet", w},
+		{"Resolver", resolvers},
+		{"Crosspost-gateways", gateways},
+		{"Dropbox-api-token", ""},
+		{"Trusted-moderators", moderators},
+		{"JSON-API", a},
+		{"Tor-config", t},
+		{"CreationDate", creationDate.Format(time.RFC3339)},
+		{"Testnet", testnet},
+	}, a.Authenticated, nil
+}
+
+// UpgradeConfig adds the config sections introduced since the repo was
+// initialized, with their defaults, and leaves the existing sections as they
+// are. It is cheap enough to run on every start of the node.
+func UpgradeConfig(repoRoot string, testnet bool) error {
+	added, err := addConfigExtensions(fsrepo.Open, repoRoot, testnet, time.Time{}, nil)
+	if err != nil {
 		return err
 	}
+	for _, key := range added {
+		if capabilityConfigKeys[key] {
+			cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+			if err != nil {
+				return err
+			}
+			return writeCapabilities(repoRoot, cfgBytes)
+		}
+	}
 	return nil
 }
 
-func createMnemonic(newEntropy func(int) ([]byte, error), newMnemonic func([]byte) (string, error)) (string, error) {
-	entropy, err := newEntropy(128)
+// writeAuthCookie generates the cookie the daemon uses to authenticate API
+// requests so headless clients can read it before the first start
+func writeAuthCookie(repoRoot string) error {
+	authBytes := make([]byte, 32)
+	if _, err := rand.Read(authBytes); err != nil {
+		return err
+	}
+	cookie := AuthCookieName + "=" + base58.Encode(authBytes)
+	return ioutil.WriteFile(path.Join(repoRoot, ".cookie"), []byte(cookie), 0600)
+}
+
+func createMnemonic(entropyBits int, newEntropy func(int) ([]byte, error), newMnemonic func([]byte) (string, error)) (string, error) {
+	if err := validateMnemonicEntropy(entropyBits); err != nil {
+		return "", err
+	}
+	entropy, err := newEntropy(entropyBits)
 	if err != nil {
 		return "", err
 	}
@@ -237,3 +1819,55 @@ func createMnemonic(newEntropy func(int) ([]byte, error), newMnemonic func([]byt
 	}
 	return mnemonic, nil
 }
+
+// entropyFromReader returns a newEntropy for createMnemonic that reads the
+// entropy from r
+func entropyFromReader(r io.Reader) func(int) ([]byte, error) {
+	return func(bitSize int) ([]byte, error) {
+		entropy := make([]byte, bitSize/8)
+		if _, err := io.ReadFull(r, entropy); err != nil {
+			return nil, err
+		}
+		return entropy, nil
+	}
+}
+
+func validateKeypairBits(nBitsForKeypair int) error {
+	if nBitsForKeypair == Ed25519KeypairBits || nBitsForKeypair >= MinKeypairBits {
+		return nil
+	}
+	return ErrInvalidKeypairBits
+}
+
+func validateMnemonicEntropy(entropyBits int) error {
+	switch entropyBits {
+	case 128, 160, 192, 224, 256:
+		return nil
+	}
+	return ErrInvalidMnemonicEntropy
+}
+
+// validateMnemonicWords checks a user supplied mnemonic against the wordlist
+// w and checks its BIP39 checksum. A mistyped word would otherwise silently
+// derive a different identity.
+func validateMnemonicWords(mnemonic string, w *wordlist) error {
+	words := strings.Fields(mnemonic)
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return wrapErrorf(ErrInvalidMnemonic, nil, "it must have 12, 15, 18, 21 or 24 words, got %d", len(words))
+	}
+	var unknown []string
+	for _, word := range words {
+		if _, ok := w.reverse[word]; !ok {
+			unknown = append(unknown, word)
+		}
+	}
+	if len(unknown) > 0 {
+		return wrapErrorf(ErrInvalidMnemonic, nil, "it contains words that are not in the %s wordlist: %s", w.language, strings.Join(unknown, ", "))
+	}
+	if !mnemonicChecksumValid(words, len(words)*11*32/33, w) {
+		return wrapErrorf(ErrInvalidMnemonic, nil, "its checksum doesn't match, so a word is wrong or out of order")
+	}
+	return nil
+}
@@ -1,12 +1,33 @@
 package repo
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/namesys"
+	"github.com/ipfs/go-ipfs/pin"
+	ipfsrepo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	"github.com/op/go-logging"
+	"github.com/tyler-smith/go-bip39"
+	libp2p "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+	cid "gx/ipfs/QmYhQaCYEcaPPjxJX7YcPcVKkQfRy6sJ7B3XmGFk82XYdQ/go-cid"
 )
 
 const repoRootFolder = "testdata/repo-root"
@@ -16,6 +37,20 @@ const mnemonicFixture = "fiscal first first inside toe wedding away element resp
 func MockDbInit(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
 	return nil
 }
+
+type mockConfig struct {
+	identityKey []byte
+}
+
+func (m *mockConfig) Init(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+	m.identityKey = identityKey
+	return nil
+}
+func (m *mockConfig) GetMnemonic() (string, error)        { return mnemonicFixture, nil }
+func (m *mockConfig) GetIdentityKey() ([]byte, error)     { return m.identityKey, nil }
+func (m *mockConfig) GetCreationDate() (time.Time, error) { return time.Time{}, nil }
+func (m *mockConfig) IsEncrypted() bool                   { return false }
+
 func MockNewEntropy(int) ([]byte, error) {
 	entropy := make([]byte, 32)
 	return entropy, nil
@@ -55,76 +90,2590 @@ func TestDoInit(t *testing.T) {
 	if err != nil {
 		t.Errorf("DoInit threw an unexpected error: %s", err.Error())
 	}
+	for _, name := range obIndexFiles {
+		checkIndexCreation(t, path.Join(repoRootFolder, name))
+	}
 
 	TearDown()
 }
 
-func TestMaybeCreateOBDirectories(t *testing.T) {
-	maybeCreateOBDirectories(repoRootFolder)
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "listings"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "feed"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "channel"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "files"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "tiny"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "small"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "medium"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "large"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "original"))
-	checkDirectoryCreation(t, path.Join(repoRootFolder, "outbox"))
+func TestDoInitWithMnemonic(t *testing.T) {
+	var storedMnemonic string
+	var storedKey []byte
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		storedMnemonic = mnemonic
+		storedKey = identityKey
+		return nil
+	}
+	mnemonic, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), dbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	if mnemonic == "" || mnemonic != storedMnemonic {
+		t.Errorf("Expected the generated mnemonic %s to be returned, got %s", storedMnemonic, mnemonic)
+	}
+	identityKey, err := ipfs.IdentityKeyFromSeed(bip39.NewSeed(mnemonic, DefaultSeedPassphrase), 4096)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(identityKey, storedKey) {
+		t.Error("The returned mnemonic does not derive the identity key used during init")
+	}
 	TearDown()
 }
 
-func checkDirectoryCreation(t *testing.T, directory string) {
-	f, err := os.Open(directory)
+func TestDoInitOptsResult(t *testing.T) {
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	})
 	if err != nil {
-		t.Errorf("created directory %s could not be opened", directory)
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
 	}
-	fi, _ := f.Stat()
-	if fi.IsDir() == false {
-		t.Errorf("maybeCreateOBDirectories did not create the directory %s", directory)
+	if res.Mnemonic != mnemonicFixture {
+		t.Errorf("Expected mnemonic %s, got %s", mnemonicFixture, res.Mnemonic)
 	}
-	if fi.Mode().String()[1:3] != "rw" {
-		t.Errorf("the created directory %s is not readable and writable for the owner", directory)
+	identity, err := ipfs.IdentityFromKey(res.IdentityKey)
+	if err != nil {
+		t.Error(err)
+	}
+	if res.PeerID == "" || res.PeerID != identity.PeerID {
+		t.Errorf("Expected peer ID %s, got %s", identity.PeerID, res.PeerID)
 	}
+	if res.PublicKey == nil || res.PublicKey.PeerID != res.PeerID {
+		t.Errorf("Expected the public key encodings of peer ID %s, got %+v", res.PeerID, res.PublicKey)
+	}
+	TearDown()
 }
 
-func TestCreateMnemonic(t *testing.T) {
-	mnemonic, err := createMnemonic(MockNewEntropyFail, MockNewMnemonicFail)
-	checkCreateMnemonicError(t, mnemonic, err)
-	mnemonic, err = createMnemonic(MockNewEntropy, MockNewMnemonicFail)
-	checkCreateMnemonicError(t, mnemonic, err)
-	mnemonic, err = createMnemonic(MockNewEntropy, MockNewMnemonic)
-	if mnemonic != mnemonicFixture {
-		t.Errorf("The mnemonic should have been %s but it is %s instead", mnemonicFixture, mnemonic)
+func TestSetLogBackend(t *testing.T) {
+	backend := logging.NewMemoryBackend(16)
+	SetLogBackend(logging.AddModuleLevel(backend))
+	defer SetLogBackend(nil)
+
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	found := false
+	for n := backend.Head(); n != nil; n = n.Next() {
+		if strings.Contains(n.Record.Message(), "Initializing OpenBazaar node") {
+			found = true
+		}
 	}
+	if !found {
+		t.Error("Expected the init message to be logged to the installed backend")
+	}
+	TearDown()
+}
+
+func TestDoInitFromKey(t *testing.T) {
+	sk, _, err := libp2p.GenerateEd25519Key(rand.Reader)
 	if err != nil {
-		t.Error("createMnemonic threw an unexpected error")
+		t.Fatal(err)
+	}
+	identityKey, err := sk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var initMnemonic string
+	var initKey []byte
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		initMnemonic = mnemonic
+		initKey = identityKey
+		return nil
+	}
+	res, err := DoInitFromKey(context.Background(), InitOptions{RepoRoot: repoRootFolder, IdentityKey: identityKey, Testnet: true, Password: "password", CreationDate: time.Now(), DbInit: dbInit})
+	if err != nil {
+		t.Fatalf("DoInitFromKey threw an unexpected error: %s", err.Error())
+	}
+	if res.PeerID != identity.PeerID {
+		t.Errorf("Expected peer ID %s, got %s", identity.PeerID, res.PeerID)
+	}
+	if res.Mnemonic != "" || initMnemonic != "" {
+		t.Error("Expected no mnemonic when initializing from a key")
+	}
+	if !bytes.Equal(initKey, identityKey) {
+		t.Error("Expected dbInit to receive the supplied identity key")
 	}
+	TearDown()
+
+	if _, err := DoInitFromKey(context.Background(), InitOptions{RepoRoot: repoRootFolder, IdentityKey: nil, Testnet: true, Password: "password", CreationDate: time.Now(), DbInit: dbInit}); err != ErrInvalidIdentityKey {
+		t.Error("Expected ErrInvalidIdentityKey for an empty key, got ", err)
+	}
+	if _, err := DoInitFromKey(context.Background(), InitOptions{RepoRoot: repoRootFolder, IdentityKey: []byte("not a key"), Testnet: true, Password: "password", CreationDate: time.Now(), DbInit: dbInit}); err == nil {
+		t.Error("DoInitFromKey didn't throw an error for a malformed key")
+	}
+	if fsrepo.IsInitialized(repoRootFolder) {
+		t.Error("DoInitFromKey left a config after failing")
+	}
+	TearDown()
 }
 
-func checkCreateMnemonicError(t *testing.T, mnemonic string, err error) {
-	if mnemonic != "" {
-		t.Errorf("The mnemonic should have been an empty string but it is %s instead", mnemonic)
+func TestDoInitOptsResultPeerIDFile(t *testing.T) {
+	_, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "peerid")); !os.IsNotExist(err) {
+		t.Error("DoInitOptsResult wrote a peerid file without being asked to")
+	}
+	TearDown()
+
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+		WritePeerID:     true,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	identity, err := ipfs.IdentityFromKey(res.IdentityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path.Join(repoRootFolder, "peerid"))
+	if err != nil {
+		t.Error("Expected a peerid file", err)
+	}
+	if strings.TrimSpace(string(b)) != identity.PeerID {
+		t.Errorf("Expected the peerid file to contain %s, got %s", identity.PeerID, string(b))
+	}
+	TearDown()
+}
+
+func TestDoInitOptsResultProgress(t *testing.T) {
+	var stages []string
+	progress := func(stage string) {
+		stages = append(stages, stage)
+	}
+	_, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+		Progress:        progress,
+	})
+	if err != nil {
+		t.Errorf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	expected := []string{
+		InitStageDirectories,
+		InitStageMnemonic + ": 12 words, 128 bits of entropy, valid checksum",
+		InitStageKeyGeneration,
+		InitStageRepo,
+		InitStageKeyspace,
+	}
+	if !reflect.DeepEqual(stages, expected) {
+		t.Errorf("Expected stages %v, got %v", expected, stages)
+	}
+	TearDown()
+
+	// A generated mnemonic isn't reported
+	stages = nil
+	_, err = DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+		Progress:        progress,
+	})
+	if err != nil {
+		t.Errorf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	expected = []string{InitStageDirectories, InitStageKeyGeneration, InitStageRepo, InitStageKeyspace}
+	if !reflect.DeepEqual(stages, expected) {
+		t.Errorf("Expected stages %v, got %v", expected, stages)
+	}
+	TearDown()
+}
+
+func TestDoInitOptsResultCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancel once the database is initialized, right before the keyspace setup
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		cancel()
+		return nil
+	}
+	_, err := DoInitOptsResult(ctx, InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          dbInit,
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+		t.Error("DoInitOptsResult left a config behind after being cancelled")
+	}
+	TearDown()
+}
+
+func TestDoInitPassphrase(t *testing.T) {
+	var storedKey []byte
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		storedKey = identityKey
+		return nil
+	}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		NoPassphrase:    true,
+		CreationDate:    time.Now(),
+		DbInit:          dbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	TearDown()
+
+	emptyKey, err := identityKeyFromMnemonic(mnemonicFixture, "", 4096, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(storedKey, emptyKey) {
+		t.Error("DoInitOpts did not derive the identity key with the supplied passphrase")
+	}
+	defaultKey, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, 4096, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Equal(emptyKey, defaultKey) {
+		t.Error("Different passphrases derived the same identity key")
+	}
+}
+
+func TestDoInitDefaults(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	if walletConfig := readWalletConfig(t, repoRootFolder); !reflect.DeepEqual(*walletConfig, DefaultWalletConfig) {
+		t.Errorf("Expected the default wallet config %+v, got %+v", DefaultWalletConfig, walletConfig)
+	}
+	apiConfig := readAPIConfig(t, repoRootFolder)
+	if apiConfig.AllowedIPs == nil {
+		// GetAPIConfig returns nil for an empty list of IPs
+		apiConfig.AllowedIPs = []string{}
+	}
+	if !reflect.DeepEqual(*apiConfig, DefaultAPIConfig) {
+		t.Errorf("Expected the default API config %+v, got %+v", DefaultAPIConfig, apiConfig)
+	}
+	if torConfig := readTorConfig(t, repoRootFolder); !reflect.DeepEqual(*torConfig, DefaultTorConfig) {
+		t.Errorf("Expected the default Tor config %+v, got %+v", DefaultTorConfig, torConfig)
+	}
+	TearDown()
+}
+
+func TestDoInitWalletOverride(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	walletConfig := readWalletConfig(t, repoRootFolder)
+	if walletConfig.FeeAPI != "https://bitcoinfees.21.co/api/v1/fees/recommended" {
+		t.Error("Expected the default FeeAPI, got ", walletConfig.FeeAPI)
+	}
+	TearDown()
+
+	overrides := &ConfigOverrides{Wallet: &WalletConfig{FeeAPI: "https://fees.example.com/api"}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	walletConfig = readWalletConfig(t, repoRootFolder)
+	if walletConfig.FeeAPI != "https://fees.example.com/api" {
+		t.Error("Expected the overridden FeeAPI, got ", walletConfig.FeeAPI)
+	}
+	if walletConfig.MaxFee != 2000 {
+		t.Error("Expected the default MaxFee, got ", walletConfig.MaxFee)
+	}
+	if walletConfig.Fees[CoinTypeBitcoin] != DefaultWalletConfig.Fees[CoinTypeBitcoin] {
+		t.Error("Expected the default Bitcoin fees, got ", walletConfig.Fees[CoinTypeBitcoin])
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{Wallet: &WalletConfig{Fees: map[string]FeeTiers{"TBTC": {Low: 1, Medium: 2, High: 3}}}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	walletConfig = readWalletConfig(t, repoRootFolder)
+	if len(walletConfig.Fees) != 2 || walletConfig.Fees["TBTC"] != (FeeTiers{Low: 1, Medium: 2, High: 3}) {
+		t.Error("Expected the overridden fees to be added to the defaults, got ", walletConfig.Fees)
+	}
+	if len(DefaultWalletConfig.Fees) != 1 {
+		t.Error("Overriding the fees modified the defaults")
 	}
+	TearDown()
+}
+
+func TestDoInitWalletType(t *testing.T) {
+	overrides := &ConfigOverrides{Wallet: &WalletConfig{Type: "bitcoind"}}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	walletConfig := readWalletConfig(t, repoRootFolder)
+	if walletConfig.Type != "bitcoind" {
+		t.Error("Expected wallet type bitcoind, got ", walletConfig.Type)
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{Wallet: &WalletConfig{Type: "dogewallet"}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
 	if err == nil {
-		t.Error("createMnemonic didn't throw an error")
+		t.Error("DoInitOpts didn't throw an error for an unsupported wallet type")
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+		t.Error("DoInitOpts left a config behind for an unsupported wallet type")
 	}
+	TearDown()
 }
 
-// Removes files that are created when tests are executed
-func TearDown() {
-	os.RemoveAll(filepath.Join(testConfigFolder, "outbox"))
-	os.RemoveAll(filepath.Join(testConfigFolder, "root"))
-	os.RemoveAll(filepath.Join(testConfigFolder, "datastore"))
-	os.Remove(filepath.Join(testConfigFolder, "repo.lock"))
+func TestDoInitTrustedPeer(t *testing.T) {
+	for _, tp := range []string{"127.0.0.1:18444", "node.example.com:8333", "[::1]:8333", "/ip4/127.0.0.1/tcp/18444"} {
+		overrides := &ConfigOverrides{Wallet: &WalletConfig{TrustedPeer: tp}}
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if err != nil {
+			t.Errorf("DoInitOpts threw an unexpected error for trusted peer %s: %s", tp, err.Error())
+		}
+		walletConfig := readWalletConfig(t, repoRootFolder)
+		if walletConfig.TrustedPeer != tp {
+			t.Errorf("Expected trusted peer %s, got %s", tp, walletConfig.TrustedPeer)
+		}
+		TearDown()
+	}
 
-	os.RemoveAll(filepath.Join(repoRootFolder, "blocks"))
-	os.RemoveAll(filepath.Join(repoRootFolder, "outbox"))
-	os.RemoveAll(filepath.Join(repoRootFolder, "root"))
-	os.RemoveAll(filepath.Join(repoRootFolder, "datastore"))
-	os.Remove(filepath.Join(repoRootFolder, "repo.lock"))
-	os.Remove(filepath.Join(repoRootFolder, "config"))
-	os.Remove(filepath.Join(repoRootFolder, "version"))
+	for _, tp := range []string{"garbage", "127.0.0.1", ":8333", "127.0.0.1:port", "127.0.0.1:70000", "/ip4/127.0.0.1/udp/18444", "/ip4/garbage"} {
+		overrides := &ConfigOverrides{Wallet: &WalletConfig{TrustedPeer: tp}}
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if !isError(err, ErrInvalidTrustedPeer) {
+			t.Errorf("Expected ErrInvalidTrustedPeer for trusted peer %s, got %v", tp, err)
+		}
+		if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+			t.Errorf("DoInitOpts left a config behind for trusted peer %s", tp)
+		}
+		TearDown()
+	}
+}
+
+func TestDoInitMaxFee(t *testing.T) {
+	for _, maxFee := range []int{MinWalletMaxFee, 300, MaxWalletMaxFee} {
+		overrides := &ConfigOverrides{MaxFee: &maxFee}
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if err != nil {
+			t.Errorf("DoInitOpts threw an unexpected error for max fee %d: %s", maxFee, err.Error())
+		}
+		if walletConfig := readWalletConfig(t, repoRootFolder); walletConfig.MaxFee != maxFee {
+			t.Errorf("Expected max fee %d, got %d", maxFee, walletConfig.MaxFee)
+		}
+		TearDown()
+	}
+
+	for _, maxFee := range []int{0, -1, MaxWalletMaxFee + 1, 1000000} {
+		overrides := &ConfigOverrides{MaxFee: &maxFee}
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if !isError(err, ErrInvalidMaxFee) {
+			t.Errorf("Expected ErrInvalidMaxFee for max fee %d, got %v", maxFee, err)
+		}
+		if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+			t.Errorf("DoInitOpts left a config behind for max fee %d", maxFee)
+		}
+		TearDown()
+	}
+
+	// Wallet.MaxFee is validated too, but its zero value is unset and keeps
+	// the default
+	overrides := &ConfigOverrides{Wallet: &WalletConfig{MaxFee: -1}}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if !isError(err, ErrInvalidMaxFee) {
+		t.Error("Expected ErrInvalidMaxFee for a negative Wallet.MaxFee, got ", err)
+	}
+	TearDown()
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       &ConfigOverrides{Wallet: &WalletConfig{}},
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walletConfig := readWalletConfig(t, repoRootFolder); walletConfig.MaxFee != DefaultWalletConfig.MaxFee {
+		t.Errorf("Expected the default max fee, got %d", walletConfig.MaxFee)
+	}
+	TearDown()
+}
+
+func TestDoInitTrustedModerators(t *testing.T) {
+	moderators := []string{"QmUZRGLhcKXF1JyuaHgKm23LvqcoMYwtb9jmh8CkP4og3K", "QmcCoBtYyduyurcLHRF14QhhA88YojJJpGFuMHoMZuU8sc"}
+	overrides := &ConfigOverrides{TrustedModerators: moderators}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRootFolder, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := GetTrustedModerators(cfgBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, moderators) {
+		t.Errorf("Expected trusted moderators %v, got %v", moderators, stored)
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{TrustedModerators: []string{moderators[0], "not-a-peer-id"}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if !isError(err, ErrInvalidModerator) || !strings.Contains(err.Error(), "not-a-peer-id") {
+		t.Error("Expected ErrInvalidModerator naming the bad peer ID, got ", err)
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+		t.Error("DoInitOpts left a config behind for a bad moderator")
+	}
+	TearDown()
+}
+
+func TestTrustedPeerAddress(t *testing.T) {
+	addr, err := TrustedPeerAddress("/ip6/::1/tcp/8333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "[::1]:8333" {
+		t.Error("Expected the multiaddr as host:port, got ", addr)
+	}
+}
+
+func TestDoInitTorOverride(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	torConfig := readTorConfig(t, repoRootFolder)
+	if torConfig.Password != "" || torConfig.TorControl != "" {
+		t.Error("Expected an empty Tor-config to be written by default")
+	}
+	TearDown()
+
+	overrides := &ConfigOverrides{Tor: &TorConfig{Password: "letmein", TorControl: "127.0.0.1:9051"}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	torConfig = readTorConfig(t, repoRootFolder)
+	if torConfig.Password != "letmein" {
+		t.Error("Expected the Tor password to be letmein, got ", torConfig.Password)
+	}
+	if torConfig.TorControl != "127.0.0.1:9051" {
+		t.Error("Expected the Tor control address to be 127.0.0.1:9051, got ", torConfig.TorControl)
+	}
+	TearDown()
+}
+
+func TestDoInitResolvers(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	if resolvers := readResolvers(t, repoRootFolder); !reflect.DeepEqual(resolvers, DefaultResolvers) {
+		t.Error("Expected the default resolvers, got ", resolvers)
+	}
+	TearDown()
+
+	custom := []string{"https://resolver.example.com/", "https://resolver2.example.com/"}
+	overrides := &ConfigOverrides{Resolvers: custom}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	if resolvers := readResolvers(t, repoRootFolder); !reflect.DeepEqual(resolvers, custom) {
+		t.Error("Expected the overridden resolvers, got ", resolvers)
+	}
+	TearDown()
+}
+
+func readResolvers(t *testing.T, repoRoot string) []string {
+	configFile, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolvers, err := GetResolverUrls(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolvers
+}
+
+func TestDoInitIPFSConfig(t *testing.T) {
+	overrides := &ConfigOverrides{IPFSConfig: func(conf *config.Config) error {
+		conf.Addresses.Swarm = []string{"/ip4/0.0.0.0/tcp/5001"}
+		return nil
+	}}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	conf, err := fsrepo.ConfigAt(repoRootFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.Addresses.Swarm, []string{"/ip4/0.0.0.0/tcp/5001"}) {
+		t.Error("Expected the mutated swarm addresses, got ", conf.Addresses.Swarm)
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{IPFSConfig: func(conf *config.Config) error {
+		return errors.New("bad config")
+	}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err == nil || err.Error() != "bad config" {
+		t.Error("Expected the mutator error, got ", err)
+	}
+	if fsrepo.IsInitialized(repoRootFolder) {
+		t.Error("DoInitOpts wrote a config after the mutator failed")
+	}
+	TearDown()
+}
+
+func TestDoInitSwarmAddresses(t *testing.T) {
+	for _, test := range []struct {
+		overrides *ConfigOverrides
+		expected  []string
+	}{
+		{nil, []string{"/ip4/0.0.0.0/tcp/4001", "/ip6/::/tcp/4001", "/ip4/0.0.0.0/tcp/9005/ws", "/ip6/::/tcp/9005/ws"}},
+		{&ConfigOverrides{SwarmPort: 4101}, []string{"/ip4/0.0.0.0/tcp/4101", "/ip6/::/tcp/4101", "/ip4/0.0.0.0/tcp/9005/ws", "/ip6/::/tcp/9005/ws"}},
+		{&ConfigOverrides{SwarmAddresses: []string{"/ip4/192.168.1.10/tcp/4001", "/ip6/2001:db8::10/tcp/4002"}}, []string{"/ip4/192.168.1.10/tcp/4001", "/ip6/2001:db8::10/tcp/4002"}},
+	} {
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       test.overrides,
+			DbInit:          MockDbInit,
+		})
+		if err != nil {
+			t.Fatalf("DoInitOpts threw an unexpected error: %s", err.Error())
+		}
+		conf, err := fsrepo.ConfigAt(repoRootFolder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(conf.Addresses.Swarm, test.expected) {
+			t.Errorf("Expected swarm addresses %v, got %v", test.expected, conf.Addresses.Swarm)
+		}
+		TearDown()
+	}
+
+	for _, overrides := range []*ConfigOverrides{
+		{SwarmAddresses: []string{"/dns4/example.com/tcp/4001"}},
+		{SwarmAddresses: []string{"/ip6/not-an-ip/tcp/4001"}},
+		{SwarmPort: 70000},
+		{SwarmAddresses: []string{"/ip6/::/tcp/4001"}, SwarmPort: 4101},
+	} {
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if !isError(err, ErrInvalidSwarmAddress) {
+			t.Errorf("Expected ErrInvalidSwarmAddress for %v, got %v", overrides, err)
+		}
+		TearDown()
+	}
+}
+
+func TestDoInitCrosspostGateways(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	gateways := readCrosspostGateways(t, repoRootFolder)
+	if !reflect.DeepEqual(gateways, DefaultCrosspostGateways) {
+		t.Error("Expected the default crosspost gateways, got ", gateways)
+	}
+	TearDown()
+
+	overrides := &ConfigOverrides{CrosspostGateways: []string{"https://gateway.example.com", "https://gateway.example.com/", "https://other.example.com//"}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	gateways = readCrosspostGateways(t, repoRootFolder)
+	expected := []string{"https://gateway.example.com/", "https://other.example.com/"}
+	if !reflect.DeepEqual(gateways, expected) {
+		t.Errorf("Expected crosspost gateways %v, got %v", expected, gateways)
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{CrosspostGateways: []string{"https://gateway.example.com", "http://plain.example.com", "gateway.example.com"}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err == nil {
+		t.Error("DoInitOpts didn't throw an error for non-https gateways")
+	} else if !strings.Contains(err.Error(), "http://plain.example.com/, gateway.example.com/") {
+		t.Error("Expected the error to list the offending gateways, got ", err)
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{CrosspostGateways: []string{"http://plain.example.com"}, AllowInsecureGateways: true}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	gateways = readCrosspostGateways(t, repoRootFolder)
+	if !reflect.DeepEqual(gateways, []string{"http://plain.example.com/"}) {
+		t.Error("Expected the insecure gateway to be allowed, got ", gateways)
+	}
+	TearDown()
+}
+
+func readCrosspostGateways(t *testing.T, repoRoot string) []string {
+	configFile, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateways, err := GetCrosspostGateway(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gateways
+}
+
+func TestDoInitImportConfig(t *testing.T) {
+	src, err := ioutil.TempDir("", "ob-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	defer TearDown()
+
+	resolvers := []string{"https://resolver.example.com"}
+	gateways := []string{"https://gateway.example.com/"}
+	allowedIPs := []string{"10.0.0.1"}
+	srcOverrides := &ConfigOverrides{
+		Resolvers:         resolvers,
+		CrosspostGateways: gateways,
+		API:               &APIConfig{Enabled: true, AllowedIPs: allowedIPs},
+		APIUsername:       "admin",
+		APIPassword:       "hunter2",
+		Wallet:            &WalletConfig{MaxFee: 1234, RPCUser: "rpcuser", RPCPassword: "rpcpassword"},
+	}
+	srcRes, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        src,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       srcOverrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		Overrides:       &ConfigOverrides{ImportConfigFrom: src},
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatal("DoInitOptsResult threw an unexpected error", err)
+	}
+	if res.PeerID == srcRes.PeerID || bytes.Equal(res.IdentityKey, srcRes.IdentityKey) {
+		t.Error("Expected a fresh identity derived from the new mnemonic")
+	}
+
+	configFile, err := ioutil.ReadFile(path.Join(repoRootFolder, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urls, err := GetResolverUrls(configFile); err != nil || !reflect.DeepEqual(urls, resolvers) {
+		t.Errorf("Expected the resolvers to be imported, got %v (%v)", urls, err)
+	}
+	if urls := readCrosspostGateways(t, repoRootFolder); !reflect.DeepEqual(urls, gateways) {
+		t.Error("Expected the crosspost gateways to be imported, got ", urls)
+	}
+	api, err := GetAPIConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.AllowedIPs, allowedIPs) {
+		t.Error("Expected the API allow-list to be imported, got ", api.AllowedIPs)
+	}
+	if api.Username != "" || api.Password != "" || api.Authenticated {
+		t.Error("Expected the API credentials not to be imported")
+	}
+	wallet, err := GetWalletConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.MaxFee != 1234 {
+		t.Error("Expected the max fee to be imported, got ", wallet.MaxFee)
+	}
+	if wallet.RPCUser != DefaultWalletConfig.RPCUser || wallet.RPCPassword != DefaultWalletConfig.RPCPassword {
+		t.Error("Expected the wallet RPC credentials not to be imported")
+	}
+	TearDown()
+
+	_, err = DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		Overrides:       &ConfigOverrides{ImportConfigFrom: path.Join(src, "missing")},
+		DbInit:          MockDbInit,
+	})
+	if err == nil {
+		t.Error("Expected a missing source config to abort init")
+	}
+	if fsrepo.IsInitialized(repoRootFolder) {
+		t.Error("Expected nothing to be written when the source config can't be read")
+	}
+}
+
+func TestDoInitAPIOverride(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	apiConfig := readAPIConfig(t, repoRootFolder)
+	if !apiConfig.Enabled || len(apiConfig.AllowedIPs) != 0 {
+		t.Error("Expected the JSON-API to be enabled without an allowed IP list by default")
+	}
+	TearDown()
+
+	overrides := &ConfigOverrides{API: &APIConfig{Enabled: false}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	apiConfig = readAPIConfig(t, repoRootFolder)
+	if apiConfig.Enabled {
+		t.Error("Expected the JSON-API to be disabled")
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{API: &APIConfig{Enabled: true, AllowedIPs: []string{"127.0.0.1"}}}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	apiConfig = readAPIConfig(t, repoRootFolder)
+	if !reflect.DeepEqual(apiConfig.AllowedIPs, []string{"127.0.0.1"}) {
+		t.Error("Expected AllowedIPs = [127.0.0.1], got ", apiConfig.AllowedIPs)
+	}
+	TearDown()
+}
+
+func TestDoInitAPICredentials(t *testing.T) {
+	overrides := &ConfigOverrides{APIUsername: "admin", APIPassword: "hunter2"}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	apiConfig := readAPIConfig(t, repoRootFolder)
+	if !apiConfig.Authenticated {
+		t.Error("Expected API authentication to be enabled")
+	}
+	if apiConfig.Username != "admin" {
+		t.Error("Expected username admin, got ", apiConfig.Username)
+	}
+	if IsLegacyAPIPasswordHash(apiConfig.Password) || !CheckAPIPassword(apiConfig.Password, "hunter2") {
+		t.Error("Expected the stored password to be a salted hash of the supplied password, got ", apiConfig.Password)
+	}
+	cookie, err := ioutil.ReadFile(path.Join(repoRootFolder, ".cookie"))
+	if err != nil {
+		t.Error("Expected an auth cookie to be generated", err)
+	}
+	if !strings.HasPrefix(string(cookie), AuthCookieName+"=") || len(cookie) <= len(AuthCookieName)+1 {
+		t.Error("The generated auth cookie is malformed: ", string(cookie))
+	}
+	TearDown()
+
+	overrides = &ConfigOverrides{APIUsername: "admin"}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Errorf("DoInitOpts threw an unexpected error: %s", err.Error())
+	}
+	apiConfig = readAPIConfig(t, repoRootFolder)
+	if apiConfig.Authenticated {
+		t.Error("Expected API authentication to be disabled without a password")
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, ".cookie")); !os.IsNotExist(err) {
+		t.Error("Expected no auth cookie without a password")
+	}
+	TearDown()
+}
+
+func readAPIConfig(t *testing.T, repoRoot string) *APIConfig {
+	configFile, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiConfig, err := GetAPIConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiConfig
+}
+
+func readTorConfig(t *testing.T, repoRoot string) *TorConfig {
+	configFile, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	torConfig, err := GetTorConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return torConfig
+}
+
+func readWalletConfig(t *testing.T, repoRoot string) *WalletConfig {
+	configFile, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletConfig, err := GetWalletConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return walletConfig
+}
+
+func TestDoInitRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := path.Join(dir, "existing")
+	if err := ioutil.WriteFile(existing, []byte("keep"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	dbInitFail := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		return errors.New("dbInit failed")
+	}
+
+	// Running DoInit with a failing dbInit on an existing folder
+	err = DoInit(dir, 4096, true, "password", "", time.Now(), dbInitFail)
+	if !isError(err, ErrDatabaseInit) || !strings.HasSuffix(err.Error(), "dbInit failed") {
+		t.Errorf("Expected the dbInit error, got %v", err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "existing" {
+		t.Errorf("Expected only the pre-existing file to remain, found %d entries", len(entries))
+	}
+
+	// Running DoInit with a failing dbInit on a folder that doesn't exist yet
+	nested := path.Join(dir, "nested")
+	DoInit(nested, 4096, true, "password", "", time.Now(), dbInitFail)
+	if _, err := os.Stat(nested); !os.IsNotExist(err) {
+		t.Error("DoInit did not remove the repo root it created")
+	}
+
+	// The repo root can be initialized after a failed attempt
+	err = DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInit threw an unexpected error: %s", err.Error())
+	}
+}
+
+func TestDoInitExistingRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit); err != nil {
+		t.Fatalf("DoInit threw an unexpected error: %s", err.Error())
+	}
+	listings := path.Join(dir, "root", "listings")
+	if err := os.RemoveAll(listings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Running DoInit on an initialized repo leaves it untouched
+	err = DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists, got ", err)
+	}
+	if _, err := os.Stat(listings); !os.IsNotExist(err) {
+		t.Error("Expected DoInit not to create directories in an existing repo")
+	}
+	if _, err := os.Stat(path.Join(dir, initLockFile)); !os.IsNotExist(err) {
+		t.Error("Expected DoInit not to leave the init lock behind")
+	}
+}
+
+func TestDoInitForce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-force")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	oldConfig, err := ioutil.ReadFile(path.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MockDbInit doesn't write a database so stand one in
+	if err := ioutil.WriteFile(path.Join(dir, "datastore", "testnet.db"), []byte("identity"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit); err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists without force, got ", err)
+	}
+
+	second, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Force:           true,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error with force: %s", err.Error())
+	}
+	if second.BackupDir == "" {
+		t.Fatal("Expected the result to name the backup directory")
+	}
+	backedUp, err := ioutil.ReadFile(path.Join(second.BackupDir, "config"))
+	if err != nil {
+		t.Fatal("Expected the prior config to be backed up", err)
+	}
+	if !bytes.Equal(backedUp, oldConfig) {
+		t.Error("The backed up config does not match the prior config")
+	}
+	backedUpDB, err := ioutil.ReadFile(path.Join(second.BackupDir, "testnet.db"))
+	if err != nil || string(backedUpDB) != "identity" {
+		t.Error("Expected the prior database to be backed up", err)
+	}
+	if second.PeerID == first.PeerID {
+		t.Error("Expected the reinitialized repo to have a new identity")
+	}
+	if !fsrepo.IsInitialized(dir) {
+		t.Error("Expected the repo to be initialized after a forced reinit")
+	}
+}
+
+func TestDoInitForceRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-force")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := &mockConfig{}
+	first, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          db.Init,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	oldConfig, err := ioutil.ReadFile(path.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failingDbInit := func(string, []byte, string, time.Time) error {
+		return errors.New("database is locked")
+	}
+
+	_, err = DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		Force:           true,
+		DbInit:          failingDbInit,
+	})
+	if !isError(err, ErrDatabaseInit) {
+		t.Fatal("Expected ErrDatabaseInit, got ", err)
+	}
+	if b, err := ioutil.ReadFile(path.Join(dir, "config")); err != nil || !bytes.Equal(b, oldConfig) {
+		t.Error("Expected a failed forced reinit to restore the prior config", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "keystore")); err != nil {
+		t.Error("Expected a failed forced reinit to restore the prior keystore", err)
+	}
+
+	_, err = DoInitPreservingIdentity(context.Background(), InitOptions{RepoRoot: dir, Testnet: true, Password: "password", DbInit: failingDbInit}, db)
+	if !isError(err, ErrDatabaseInit) {
+		t.Fatal("Expected ErrDatabaseInit, got ", err)
+	}
+	if b, err := ioutil.ReadFile(path.Join(dir, "config")); err != nil || !bytes.Equal(b, oldConfig) {
+		t.Error("Expected a failed rebuild to restore the prior config", err)
+	}
+	if entries, err := ioutil.ReadDir(path.Join(dir, "backups")); err != nil || len(entries) != 0 {
+		t.Error("Expected the restored backups to be removed", err)
+	}
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal("Expected the restored datastore to open", err)
+	}
+	defer r.Close()
+	if !hasKeyspace(t, r, first.PeerID) {
+		t.Error("Expected the restored datastore to hold the prior keyspace")
+	}
+}
+
+func TestDoInitPreservingIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := DoInitPreservingIdentity(context.Background(), InitOptions{RepoRoot: dir, Testnet: true, Password: "password", DbInit: MockDbInit}, &mockConfig{}); err != ErrNoIdentity {
+		t.Error("Expected ErrNoIdentity without an identity key, got ", err)
+	}
+	if fsrepo.IsInitialized(dir) {
+		t.Error("Expected nothing to be initialized without an identity key")
+	}
+
+	db := &mockConfig{}
+	first, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          db.Init,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	// MockDbInit doesn't write a database so stand one in, and corrupt the
+	// IPFS datastore next to it
+	if err := ioutil.WriteFile(path.Join(dir, "datastore", "testnet.db"), []byte("identity"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "datastore", "CURRENT"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var storedKey []byte
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		if mnemonic != mnemonicFixture {
+			t.Error("Expected the stored mnemonic to be kept, got ", mnemonic)
+		}
+		storedKey = identityKey
+		return nil
+	}
+	second, err := DoInitPreservingIdentity(context.Background(), InitOptions{RepoRoot: dir, Testnet: true, Password: "password", DbInit: dbInit}, db)
+	if err != nil {
+		t.Fatalf("DoInitPreservingIdentity threw an unexpected error: %s", err.Error())
+	}
+	if second.PeerID != first.PeerID {
+		t.Errorf("Expected peer ID %s to be preserved, got %s", first.PeerID, second.PeerID)
+	}
+	if !bytes.Equal(storedKey, db.identityKey) {
+		t.Error("Expected the existing identity key to be stored again")
+	}
+	if b, err := ioutil.ReadFile(path.Join(dir, "datastore", "testnet.db")); err != nil || string(b) != "identity" {
+		t.Error("Expected the database to be left in place", err)
+	}
+	if b, err := ioutil.ReadFile(path.Join(second.BackupDir, "datastore", "CURRENT")); err != nil || string(b) != "garbage" {
+		t.Error("Expected the corrupted datastore to be backed up", err)
+	}
+
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal("Expected the rebuilt datastore to open", err)
+	}
+	defer r.Close()
+	if !hasKeyspace(t, r, first.PeerID) {
+		t.Error("Expected the keyspace to be initialized again")
+	}
+}
+
+func TestDoInitConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Hold the first init inside dbInit while the second one starts
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockingDbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		close(started)
+		<-release
+		return nil
+	}
+	firstErr := make(chan error)
+	go func() {
+		firstErr <- DoInit(dir, 4096, true, "password", "", time.Now(), blockingDbInit)
+	}()
+	<-started
+	secondErr := DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit)
+	close(release)
+
+	if err := <-firstErr; err != nil {
+		t.Errorf("DoInit threw an unexpected error: %s", err.Error())
+	}
+	if secondErr != ErrInitInProgress {
+		t.Error("Expected ErrInitInProgress for the concurrent init, got ", secondErr)
+	}
+	if _, err := os.Stat(path.Join(dir, "init.lock")); !os.IsNotExist(err) {
+		t.Error("DoInit did not release the init lock")
+	}
+	if err := DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit); err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists once the lock is released, got ", err)
+	}
+}
+
+func TestDoInitKeypairBits(t *testing.T) {
+	for _, bits := range []int{0, 128, 1024} {
+		err := DoInit(repoRootFolder, bits, true, "password", mnemonicFixture, time.Now(), MockDbInit)
+		if err != ErrInvalidKeypairBits {
+			t.Errorf("Expected ErrInvalidKeypairBits for %d bits, got %v", bits, err)
+		}
+		if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+			t.Errorf("DoInit created a config for %d bits", bits)
+		}
+	}
+
+	// The key is Ed25519 either way, so accepted sizes yield the same identity
+	var peerIDs []string
+	for _, bits := range []int{Ed25519KeypairBits, 4096} {
+		res, err := DoInitOptsResult(context.Background(), InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: bits,
+			Testnet:         true,
+			Password:        "password",
+			Mnemonic:        mnemonicFixture,
+			CreationDate:    time.Now(),
+			DbInit:          MockDbInit,
+		})
+		if err != nil {
+			t.Errorf("DoInitOptsResult threw an unexpected error for %d bits: %s", bits, err.Error())
+			continue
+		}
+		peerIDs = append(peerIDs, res.PeerID)
+		TearDown()
+	}
+	if len(peerIDs) == 2 && peerIDs[0] != peerIDs[1] {
+		t.Error("Expected the keypair size not to change the identity")
+	}
+}
+
+func TestDoInitInvalidMnemonic(t *testing.T) {
+	err := DoInit(repoRootFolder, 4096, true, "password", "fiscal first first inside toe wedding", time.Now(), MockDbInit)
+	if err == nil {
+		t.Error("DoInit didn't throw an error for an invalid mnemonic")
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "root")); !os.IsNotExist(err) {
+		t.Error("DoInit created directories for an invalid mnemonic")
+	}
+	TearDown()
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	if err := validateMnemonicWords(mnemonicFixture, englishWordlist); err != nil {
+		t.Errorf("validateMnemonicWords threw an unexpected error: %s", err)
+	}
+
+	err := validateMnemonicWords("fiscal first first inside toe weding away element response dry attend oxygen", englishWordlist)
+	if err == nil {
+		t.Error("validateMnemonicWords didn't throw an error for a misspelled word")
+	} else if !strings.Contains(err.Error(), "weding") {
+		t.Errorf("Expected the error to name the misspelled word, got: %s", err)
+	}
+
+	err = validateMnemonicWords("fiscal first first inside toe wedding away element response dry attend", englishWordlist)
+	if err == nil {
+		t.Error("validateMnemonicWords didn't throw an error for the wrong number of words")
+	}
+
+	// Known words in the right number, but the last word doesn't carry the
+	// checksum of the others
+	err = validateMnemonicWords("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", englishWordlist)
+	if !isError(err, ErrInvalidMnemonic) {
+		t.Error("Expected ErrInvalidMnemonic for a bad checksum, got ", err)
+	}
+}
+
+func TestDoInitNormalizesMnemonic(t *testing.T) {
+	defer TearDown()
+	var stored string
+	db := &mockConfig{}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot: repoRootFolder,
+		Mnemonic: "  " + strings.Replace(mnemonicFixture, " ", "\t \n", -1) + "\n",
+		DbInit: func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+			stored = mnemonic
+			return db.Init(mnemonic, identityKey, password, creationDate)
+		},
+	})
+	if err != nil {
+		t.Fatal("DoInitOptsResult threw an unexpected error", err)
+	}
+	if stored != mnemonicFixture || res.Mnemonic != mnemonicFixture {
+		t.Errorf("Expected the mnemonic to be stored as %q, got %q", mnemonicFixture, stored)
+	}
+	TearDown()
+
+	expected := &mockConfig{}
+	if err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: mnemonicFixture, DbInit: expected.Init}); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if !bytes.Equal(db.identityKey, expected.identityKey) {
+		t.Error("Expected the whitespace around the words not to change the identity")
+	}
+	TearDown()
+
+	if err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: " \n ", DbInit: MockDbInit}); !isError(err, ErrInvalidMnemonic) {
+		t.Error("Expected ErrInvalidMnemonic for a blank mnemonic, got ", err)
+	}
+}
+
+func TestValidateInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A valid, empty folder and a nested folder that doesn't exist yet
+	if err := ValidateInit(dir, mnemonicFixture, "", DefaultMnemonicEntropy); err != nil {
+		t.Errorf("ValidateInit threw an unexpected error: %s", err.Error())
+	}
+	if err := ValidateInit(path.Join(dir, "a", "b"), "", "", DefaultMnemonicEntropy); err != nil {
+		t.Errorf("ValidateInit threw an unexpected error: %s", err.Error())
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("ValidateInit left %d entries behind", len(entries))
+	}
+
+	// A folder that already contains a config file
+	if err := ValidateInit(testConfigFolder, "", "", DefaultMnemonicEntropy); err != ErrRepoExists {
+		t.Error("ValidateInit didn't throw ErrRepoExists")
+	}
+	// An invalid mnemonic and entropy
+	if err := ValidateInit(dir, "fiscal first", "", DefaultMnemonicEntropy); err == nil {
+		t.Error("ValidateInit didn't throw an error for an invalid mnemonic")
+	}
+	if err := ValidateInit(dir, "", "", 100); err != ErrInvalidMnemonicEntropy {
+		t.Error("ValidateInit didn't throw ErrInvalidMnemonicEntropy")
+	}
+	// A file where a directory is expected
+	if err := ioutil.WriteFile(path.Join(dir, "root"), []byte{}, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateInit(dir, "", "", DefaultMnemonicEntropy); err == nil {
+		t.Error("ValidateInit didn't throw an error for a file in place of a directory")
+	}
+	os.Remove(path.Join(dir, "root"))
+	// A folder that isn't writeable
+	if !permissionsEnforced() {
+		return
+	}
+	os.Chmod(dir, 0555)
+	defer os.Chmod(dir, 0755)
+	if err := ValidateInit(dir, "", "", DefaultMnemonicEntropy); err == nil {
+		t.Error("ValidateInit didn't throw an error for a read-only folder")
+	}
+}
+
+func TestReinitializeKeyspace(t *testing.T) {
+	repoRoot, err := ioutil.TempDir("", "reinitialize-keyspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoRoot)
+	db := &mockConfig{}
+	if err := ReinitializeKeyspace(repoRoot, db); err == nil {
+		t.Error("ReinitializeKeyspace didn't throw an error on an uninitialized repo")
+	}
+	err = DoInit(repoRoot, 4096, true, "password", mnemonicFixture, time.Now(), db.Init)
+	if err != nil {
+		t.Errorf("DoInit threw an unexpected error: %s", err.Error())
+	}
+	if err := ReinitializeKeyspace(repoRoot, &mockConfig{}); err != ErrNoIdentity {
+		t.Error("Expected ErrNoIdentity for a database without an identity key, got ", err)
+	}
+	configBefore, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := ReinitializeKeyspace(repoRoot, db); err != nil {
+			t.Errorf("ReinitializeKeyspace threw an unexpected error: %s", err.Error())
+		}
+	}
+	configAfter, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(configBefore, configAfter) {
+		t.Error("ReinitializeKeyspace modified the config")
+	}
+}
+
+func TestMaybeCreateOBDirectories(t *testing.T) {
+	maybeCreateOBDirectories(osFS{}, repoRootFolder, DefaultDirectoryMode)
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "listings"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "feed"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "channel"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "files"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "tiny"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "small"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "medium"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "large"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "root", "images", "original"))
+	checkDirectoryCreation(t, path.Join(repoRootFolder, "outbox"))
+	for _, name := range obIndexFiles {
+		checkIndexCreation(t, path.Join(repoRootFolder, name))
+	}
+	TearDown()
+}
+
+func TestMaybeCreateOBDirectoriesKeepsIndices(t *testing.T) {
+	if err := os.MkdirAll(path.Join(repoRootFolder, "root"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	index := []byte(`[{"slug":"shirt"}]`)
+	indexPath := path.Join(repoRootFolder, "root", "listings.json")
+	if err := ioutil.WriteFile(indexPath, index, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := maybeCreateOBDirectories(osFS{}, repoRootFolder, DefaultDirectoryMode); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(indexPath); err != nil || !bytes.Equal(b, index) {
+		t.Error("Expected an existing index to be left untouched")
+	}
+	TearDown()
+}
+
+func TestEnsureDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Lay out a legacy repo without the image size subdirectories
+	for _, d := range []string{"root/listings", "root/ratings", "root/images", "root/feed", "root/channel", "root/files", "outbox", "logs"} {
+		if err := os.MkdirAll(path.Join(dir, d), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configBytes := []byte(`{"Foo":"bar"}`)
+	if err := ioutil.WriteFile(path.Join(dir, "config"), configBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureDirectories(dir); err != nil {
+			t.Errorf("EnsureDirectories threw an unexpected error: %s", err.Error())
+		}
+	}
+	for _, d := range obDirectories {
+		checkDirectoryCreation(t, path.Join(dir, d))
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, "config"))
+	if err != nil || !bytes.Equal(b, configBytes) {
+		t.Error("EnsureDirectories modified the config")
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	failing := func(failures int, calls *int) func() error {
+		return func() error {
+			*calls++
+			if *calls <= failures {
+				return errors.New("datastore busy")
+			}
+			return nil
+		}
+	}
+
+	calls := 0
+	if err := retryWithBackoff(context.Background(), policy, failing(2, &calls)); err != nil {
+		t.Error("retryWithBackoff threw an unexpected error", err)
+	}
+	if calls != 3 {
+		t.Error("Expected 3 calls, got ", calls)
+	}
+
+	calls = 0
+	err := retryWithBackoff(context.Background(), policy, failing(3, &calls))
+	if err == nil || err.Error() != "datastore busy" {
+		t.Error("Expected the last error after the final attempt, got ", err)
+	}
+	if calls != 3 {
+		t.Error("Expected 3 calls, got ", calls)
+	}
+
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := retryWithBackoff(ctx, RetryPolicy{Attempts: 3, Backoff: time.Hour}, failing(3, &calls)); err != context.Canceled {
+		t.Error("Expected context.Canceled, got ", err)
+	}
+	if calls != 1 {
+		t.Error("Expected no retries after cancellation, got ", calls)
+	}
+}
+
+func TestCheckWriteable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-writeable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A deeply nested path that doesn't exist yet
+	nested := path.Join(dir, "a", "b", "c")
+	if err := checkWriteable(osFS{}, nested); err != nil {
+		t.Errorf("checkWriteable threw an unexpected error: %s", err.Error())
+	}
+	checkDirectoryCreation(t, nested)
+	if entries, _ := ioutil.ReadDir(nested); len(entries) != 0 {
+		t.Error("checkWriteable did not remove its probe file")
+	}
+
+	// A user's file named like the old probe file
+	existing := path.Join(nested, "test")
+	if err := ioutil.WriteFile(existing, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWriteable(osFS{}, nested); err != nil {
+		t.Errorf("checkWriteable threw an unexpected error: %s", err.Error())
+	}
+	if b, err := ioutil.ReadFile(existing); err != nil || string(b) != "keep" {
+		t.Error("checkWriteable modified an existing file named test")
+	}
+	if entries, _ := ioutil.ReadDir(nested); len(entries) != 1 {
+		t.Error("checkWriteable did not remove its probe file")
+	}
+
+	// A path whose parent is read-only. TestCheckWriteableMemFS covers this
+	// where permissions aren't enforced.
+	if !permissionsEnforced() {
+		return
+	}
+	readOnly := path.Join(dir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWriteable(osFS{}, path.Join(readOnly, "child")); err == nil {
+		t.Error("checkWriteable didn't throw an error for a read-only parent")
+	}
+}
+
+// permissionsEnforced reports whether the tests are denied writing to
+// read-only directories, which they aren't when running as root
+func permissionsEnforced() bool {
+	return os.Geteuid() != 0
+}
+
+func TestCheckWriteableFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-writeable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "openbazaar")
+	if err := ioutil.WriteFile(file, []byte("not a repo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkWriteable(osFS{}, file)
+	if !isError(err, ErrRepoRootNotDirectory) || !strings.Contains(err.Error(), file) {
+		t.Error("Expected ErrRepoRootNotDirectory naming the file, got ", err)
+	}
+	_, err = DoInitWithMnemonic(file, 4096, true, "password", "", time.Now(), MockDbInit)
+	if !isError(err, ErrRepoRootNotDirectory) {
+		t.Error("Expected DoInit to throw ErrRepoRootNotDirectory, got ", err)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != "not a repo" {
+		t.Error("Expected the file to be left untouched")
+	}
+}
+
+func TestDoInitOpts(t *testing.T) {
+	creationDate := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	positional := &mockConfig{}
+	err := DoInit(repoRootFolder, 4096, true, "password", mnemonicFixture, creationDate, positional.Init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedConfig, err := ioutil.ReadFile(path.Join(repoRootFolder, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	TearDown()
+
+	opts := &mockConfig{}
+	err = DoInitOpts(InitOptions{
+		RepoRoot:     repoRootFolder,
+		Testnet:      true,
+		Password:     "password",
+		Mnemonic:     mnemonicFixture,
+		CreationDate: creationDate,
+		DbInit:       opts.Init,
+	})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if !bytes.Equal(opts.identityKey, positional.identityKey) {
+		t.Error("Expected DoInitOpts to derive the same identity key as DoInit")
+	}
+	cfg, err := ioutil.ReadFile(path.Join(repoRootFolder, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cfg, expectedConfig) {
+		t.Error("Expected DoInitOpts to write the same config as DoInit")
+	}
+
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, DbInit: MockDbInit})
+	if err != ErrRepoExists {
+		t.Error("Expected ErrRepoExists, got ", err)
+	}
+	TearDown()
+}
+
+func TestDoInitOptsAccountIndex(t *testing.T) {
+	peerIDs := make(map[uint32]string)
+	for _, index := range []uint32{0, 1, 1} {
+		db := &mockConfig{}
+		err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: mnemonicFixture, AccountIndex: index, DbInit: db.Init})
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity, err := ipfs.IdentityFromKey(db.identityKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous, ok := peerIDs[index]; ok && previous != identity.PeerID {
+			t.Errorf("Expected index %d to derive %s again, got %s", index, previous, identity.PeerID)
+		}
+		peerIDs[index] = identity.PeerID
+		TearDown()
+	}
+
+	legacyKey, err := ipfs.IdentityKeyFromSeed(bip39.NewSeed(mnemonicFixture, DefaultSeedPassphrase), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := ipfs.IdentityFromKey(legacyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peerIDs[0] != legacy.PeerID {
+		t.Error("Expected index 0 to derive the legacy identity")
+	}
+	if peerIDs[1] == peerIDs[0] {
+		t.Error("Expected index 1 to derive a distinct identity")
+	}
+}
+
+func TestDoInitOptsDisableMnemonicGeneration(t *testing.T) {
+	defer TearDown()
+	db := &recordingConfig{}
+	err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Testnet: true, DisableMnemonicGeneration: true, DbInit: db.Init})
+	if err != ErrNoKeyMaterial {
+		t.Fatal("Expected ErrNoKeyMaterial without a mnemonic or identity key, got ", err)
+	}
+	if fsrepo.IsInitialized(repoRootFolder) || db.identityKey != nil {
+		t.Fatal("Expected nothing to be initialized without key material")
+	}
+
+	identityKey, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, Ed25519KeypairBits, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Testnet: true, IdentityKey: identityKey, DisableMnemonicGeneration: true, DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error with an identity key: ", err)
+	}
+	if db.mnemonic != "" || !bytes.Equal(db.identityKey, identityKey) {
+		t.Errorf("Expected the supplied identity key and no mnemonic, got mnemonic %q", db.mnemonic)
+	}
+	TearDown()
+
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Testnet: true, Mnemonic: mnemonicFixture, DisableMnemonicGeneration: true, DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error with a mnemonic: ", err)
+	}
+	if db.mnemonic != mnemonicFixture {
+		t.Errorf("Expected the supplied mnemonic, got %q", db.mnemonic)
+	}
+	TearDown()
+
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Testnet: true, DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error: ", err)
+	}
+	if db.mnemonic == "" || db.mnemonic == mnemonicFixture {
+		t.Errorf("Expected a mnemonic to be generated by default, got %q", db.mnemonic)
+	}
+}
+
+func TestDoInitOptsPins(t *testing.T) {
+	pins := []string{
+		"QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o",
+		"zb2rhe5P4gXftAwvA4eXQ5HJwsER2owDyS9sKaQRRVQPn93bA",
+	}
+	defer TearDown()
+	db := &mockConfig{}
+	err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: mnemonicFixture, Pins: pins, DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	r, err := fsrepo.Open(repoRootFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	if cfg.Identity, err = ipfs.IdentityFromKey(db.identityKey); err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	nd, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	for _, p := range pins {
+		c, err := cid.Decode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, pinned, err := nd.Pinning.IsPinnedWithType(c, pin.Recursive); err != nil || !pinned {
+			t.Errorf("Expected %s to be pinned recursively (%v)", p, err)
+		}
+	}
+	nd.Close()
+	TearDown()
+
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: mnemonicFixture, Pins: []string{pins[0], "notacid"}, DbInit: MockDbInit})
+	if !isError(err, ErrInvalidPinCID) || !strings.Contains(err.Error(), "notacid") {
+		t.Error("Expected ErrInvalidPinCID naming the bad CID, got ", err)
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "config")); !os.IsNotExist(err) {
+		t.Error("Expected a bad CID to abort init before the repo is written")
+	}
+	TearDown()
+}
+
+func TestDoInitOptsSkipKeyspaceInit(t *testing.T) {
+	defer TearDown()
+	db := &mockConfig{}
+	events := make(chan InitEvent, 10)
+	err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: mnemonicFixture, SkipKeyspaceInit: true, Events: events, DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	for e := range events {
+		if e.Stage == EventKeyspace {
+			t.Error("Expected the keyspace stage to be skipped")
+		}
+	}
+	if !IsKeyspacePending(repoRootFolder) {
+		t.Fatal("Expected the keyspace to be flagged as pending")
+	}
+	identity, err := ipfs.IdentityFromKey(db.identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeyspace := func(expected bool) {
+		r, err := fsrepo.Open(repoRootFolder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if hasKeyspace(t, r, identity.PeerID) != expected {
+			t.Errorf("Expected the keyspace initialized to be %t", expected)
+		}
+	}
+	checkKeyspace(false)
+
+	// The daemon completes the init on its first start
+	for i := 0; i < 2; i++ {
+		if err := CompletePendingKeyspace(repoRootFolder, db); err != nil {
+			t.Fatal("CompletePendingKeyspace threw an unexpected error", err)
+		}
+	}
+	if IsKeyspacePending(repoRootFolder) {
+		t.Error("Expected the pending flag to be cleared")
+	}
+	checkKeyspace(true)
+	TearDown()
+
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, SkipKeyspaceInit: true, Pins: []string{"QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"}, DbInit: MockDbInit})
+	if err == nil {
+		t.Error("Expected pinning to be refused without the keyspace init")
+	}
+}
+
+func TestDoInitOptsConfirmMnemonic(t *testing.T) {
+	defer TearDown()
+	echo := func(wrong bool) ConfirmMnemonicFunc {
+		return func(mnemonic string, positions []int) ([]string, error) {
+			words := strings.Fields(mnemonic)
+			if len(positions) != mnemonicConfirmationWords || !sort.IntsAreSorted(positions) {
+				t.Error("Expected sorted positions to confirm, got ", positions)
+			}
+			var confirmed []string
+			for _, p := range positions {
+				if p < 0 || p >= len(words) {
+					t.Fatal("Position out of range ", p)
+				}
+				confirmed = append(confirmed, words[p])
+			}
+			if wrong {
+				confirmed[0] += "x"
+			}
+			return confirmed, nil
+		}
+	}
+
+	dbInitCalled := false
+	dbInit := func(string, []byte, string, time.Time) error {
+		dbInitCalled = true
+		return nil
+	}
+	err := DoInitOpts(InitOptions{RepoRoot: repoRootFolder, ConfirmMnemonic: echo(true), DbInit: dbInit})
+	if err != ErrMnemonicConfirmation {
+		t.Error("Expected ErrMnemonicConfirmation, got ", err)
+	}
+	if dbInitCalled || fsrepo.IsInitialized(repoRootFolder) {
+		t.Error("Expected a failed confirmation to abort before anything is written")
+	}
+
+	// A failed confirmation leaves the repo root free to retry
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, ConfirmMnemonic: echo(false), DbInit: dbInit})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if !dbInitCalled {
+		t.Error("Expected the init to complete after a correct confirmation")
+	}
+}
+
+func TestDoInitOptsPostInit(t *testing.T) {
+	defer TearDown()
+	identityKey, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, Ed25519KeypairBits, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errRegister := errors.New("directory service unavailable")
+	opts := InitOptions{
+		RepoRoot: repoRootFolder,
+		Testnet:  true,
+		Mnemonic: mnemonicFixture,
+		DbInit:   MockDbInit,
+		PostInit: func(repoRoot, peerID string) error {
+			if !fsrepo.IsInitialized(repoRoot) {
+				t.Error("Expected the repo to be initialized before the post-init step")
+			}
+			return errRegister
+		},
+	}
+	err = DoInitOpts(opts)
+	if !isError(err, ErrPostInit) || !isError(err, errRegister) {
+		t.Error("Expected the post-init error to be returned, got ", err)
+	}
+	if fsrepo.IsInitialized(repoRootFolder) {
+		t.Error("Expected a failed post-init step to roll back the init")
+	}
+
+	var gotRoot, gotPeerID string
+	opts.PostInit = func(repoRoot, peerID string) error {
+		gotRoot, gotPeerID = repoRoot, peerID
+		return nil
+	}
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if gotRoot != repoRootFolder || gotPeerID != identity.PeerID {
+		t.Errorf("Expected the post-init step to get %s and %s, got %s and %s", repoRootFolder, identity.PeerID, gotRoot, gotPeerID)
+	}
+}
+
+func TestDoInitOptsKeystorePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := path.Join(dir, "root")
+	keystorePath := path.Join(dir, "encrypted", "keystore")
+
+	db := &mockConfig{}
+	err = DoInitOpts(InitOptions{RepoRoot: root, Mnemonic: mnemonicFixture, KeystorePath: keystorePath, DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if fi, err := os.Stat(keystorePath); err != nil || !fi.IsDir() {
+		t.Fatal("Expected the keystore to be created at the override path")
+	}
+
+	r, err := fsrepo.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, _, err := libp2p.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Keystore().Put("store", sk); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := os.Stat(path.Join(keystorePath, "store")); err != nil {
+		t.Error("Expected the key to be written to the override path")
+	}
+
+	inspection, err := OpenReadOnly(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, 4096, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := ipfs.IdentityFromKey(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspection.PeerID != identity.PeerID {
+		t.Error("Expected the node to derive its identity with the keystore elsewhere")
+	}
+}
+
+func TestDoInitKeystorePathRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := path.Join(dir, "root")
+	keystorePath := path.Join(dir, "encrypted", "keystore")
+	// The peer ID can't be written over a directory
+	if err := os.MkdirAll(path.Join(root, peerIDFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = doInit(context.Background(), InitOptions{
+		RepoRoot:        root,
+		NBitsForKeypair: Ed25519KeypairBits,
+		Mnemonic:        mnemonicFixture,
+		MnemonicEntropy: DefaultMnemonicEntropy,
+		Passphrase:      DefaultSeedPassphrase,
+		KeystorePath:    keystorePath,
+		DbInit:          MockDbInit,
+		WritePeerID:     true,
+	})
+	if err == nil {
+		t.Fatal("Expected writing the peer ID to fail")
+	}
+	if _, err := os.Stat(keystorePath); !os.IsNotExist(err) {
+		t.Error("Expected the keystore created by the failed init to be removed")
+	}
+	if fsrepo.IsInitialized(root) {
+		t.Error("Expected the failed init to be rolled back")
+	}
+}
+
+func TestDoInitZeroCreationDate(t *testing.T) {
+	receivedDate := time.Now()
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		receivedDate = creationDate
+		return nil
+	}
+
+	err := DoInit(repoRootFolder, 4096, true, "password", mnemonicFixture, time.Time{}, dbInit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !receivedDate.IsZero() {
+		t.Error("Expected a zero creation date to be passed on so the wallet rescans, got ", receivedDate)
+	}
+	if cd, err := GetCreationDate(repoRootFolder); err != nil || !cd.IsZero() {
+		t.Errorf("Expected a zero creation date in the config, got %s (%v)", cd, err)
+	}
+	TearDown()
+}
+
+func TestDoInitErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	readOnly := path.Join(dir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p RetryPolicy) { KeyspaceRetryPolicy = p }(KeyspaceRetryPolicy)
+	KeyspaceRetryPolicy = RetryPolicy{Attempts: 1}
+
+	cause := errors.New("cause")
+	failingInit := func(m *memRepo) *RepoBackend {
+		b := m.backend()
+		b.Init = func(string, *config.Config) error { return cause }
+		return b
+	}
+	// The repo is opened to write the config extensions, to verify them and
+	// to initialize the keyspace, in that order
+	failingOpen := func(m *memRepo, failAt int) *RepoBackend {
+		b := m.backend()
+		opens := 0
+		b.Open = func(string) (ipfsrepo.Repo, error) {
+			if opens++; opens >= failAt {
+				return nil, cause
+			}
+			return m, nil
+		}
+		return b
+	}
+	failingDbInit := func(string, []byte, string, time.Time) error { return cause }
+	ctx := context.Background()
+
+	type errorTest struct {
+		name     string
+		init     func(root string) error
+		expected error
+		wrapped  bool
+	}
+	tests := []errorTest{
+		{"invalid mnemonic", func(root string) error {
+			return DoInit(root, 4096, true, "password", "too short", time.Now(), MockDbInit)
+		}, ErrInvalidMnemonic, false},
+		{"invalid keypair bits", func(root string) error {
+			return DoInit(root, 1024, true, "password", "", time.Now(), MockDbInit)
+		}, ErrInvalidKeypairBits, false},
+		{"key generation", func(root string) error {
+			_, err := DoInitFromKey(context.Background(), InitOptions{RepoRoot: root, IdentityKey: []byte("not a key"), Testnet: true, Password: "password", CreationDate: time.Now(), DbInit: MockDbInit})
+			return err
+		}, ErrKeyGeneration, false},
+		{"repo init", func(root string) error {
+			_, err := DoInitWithBackend(ctx, InitOptions{
+				RepoRoot:        root,
+				NBitsForKeypair: 4096,
+				Testnet:         true,
+				Password:        "password",
+				CreationDate:    time.Now(),
+				DbInit:          MockDbInit,
+			}, failingInit(newMemRepo()))
+			return err
+		}, ErrRepoInit, true},
+		{"config write", func(root string) error {
+			_, err := DoInitWithBackend(ctx, InitOptions{
+				RepoRoot:        root,
+				NBitsForKeypair: 4096,
+				Testnet:         true,
+				Password:        "password",
+				CreationDate:    time.Now(),
+				DbInit:          MockDbInit,
+			}, failingOpen(newMemRepo(), 1))
+			return err
+		}, ErrConfigWrite, true},
+		{"database init", func(root string) error {
+			_, err := DoInitWithBackend(ctx, InitOptions{
+				RepoRoot:        root,
+				NBitsForKeypair: 4096,
+				Testnet:         true,
+				Password:        "password",
+				CreationDate:    time.Now(),
+				DbInit:          failingDbInit,
+			}, newMemRepo().backend())
+			return err
+		}, ErrDatabaseInit, true},
+		{"keyspace init", func(root string) error {
+			_, err := DoInitWithBackend(ctx, InitOptions{
+				RepoRoot:        root,
+				NBitsForKeypair: 4096,
+				Testnet:         true,
+				Password:        "password",
+				CreationDate:    time.Now(),
+				DbInit:          MockDbInit,
+			}, failingOpen(newMemRepo(), 4))
+			return err
+		}, ErrKeyspaceInit, true},
+	}
+	if permissionsEnforced() {
+		tests = append(tests, errorTest{"not writeable", func(root string) error {
+			return DoInit(path.Join(readOnly, "child"), 4096, true, "password", "", time.Now(), MockDbInit)
+		}, ErrNotWriteable, false})
+	}
+	for _, test := range tests {
+		root, err := ioutil.TempDir(dir, "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = test.init(root)
+		if !isError(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+		if test.wrapped && !isError(err, cause) {
+			t.Errorf("%s: expected the cause to be wrapped, got %v", test.name, err)
+		}
+	}
+}
+
+func checkIndexCreation(t *testing.T, name string) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Errorf("index %s was not created", name)
+		return
+	}
+	var index []interface{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Errorf("index %s could not be parsed: %s", name, err)
+	}
+	if index == nil || len(index) != 0 {
+		t.Errorf("Expected index %s to be an empty collection, got %s", name, b)
+	}
+}
+
+func checkDirectoryCreation(t *testing.T, directory string) {
+	f, err := os.Open(directory)
+	if err != nil {
+		t.Errorf("created directory %s could not be opened", directory)
+	}
+	fi, _ := f.Stat()
+	if fi.IsDir() == false {
+		t.Errorf("maybeCreateOBDirectories did not create the directory %s", directory)
+	}
+	if fi.Mode().String()[1:3] != "rw" {
+		t.Errorf("the created directory %s is not readable and writable for the owner", directory)
+	}
+}
+
+func TestCreateMnemonic(t *testing.T) {
+	mnemonic, err := createMnemonic(DefaultMnemonicEntropy, MockNewEntropyFail, MockNewMnemonicFail)
+	checkCreateMnemonicError(t, mnemonic, err)
+	mnemonic, err = createMnemonic(DefaultMnemonicEntropy, MockNewEntropy, MockNewMnemonicFail)
+	checkCreateMnemonicError(t, mnemonic, err)
+	mnemonic, err = createMnemonic(DefaultMnemonicEntropy, MockNewEntropy, MockNewMnemonic)
+	if mnemonic != mnemonicFixture {
+		t.Errorf("The mnemonic should have been %s but it is %s instead", mnemonicFixture, mnemonic)
+	}
+	if err != nil {
+		t.Error("createMnemonic threw an unexpected error")
+	}
+}
+
+func TestCreateMnemonicEntropy(t *testing.T) {
+	wordCounts := map[int]int{
+		128: 12,
+		160: 15,
+		192: 18,
+		224: 21,
+		256: 24,
+	}
+	for bits, words := range wordCounts {
+		mnemonic, err := createMnemonic(bits, bip39.NewEntropy, bip39.NewMnemonic)
+		if err != nil {
+			t.Errorf("createMnemonic threw an unexpected error for %d bits: %s", bits, err)
+			continue
+		}
+		if len(strings.Fields(mnemonic)) != words {
+			t.Errorf("Expected %d words for %d bits of entropy, got %d", words, bits, len(strings.Fields(mnemonic)))
+		}
+	}
+
+	mnemonic, err := createMnemonic(100, bip39.NewEntropy, bip39.NewMnemonic)
+	checkCreateMnemonicError(t, mnemonic, err)
+	if err != ErrInvalidMnemonicEntropy {
+		t.Error("createMnemonic didn't throw ErrInvalidMnemonicEntropy")
+	}
+}
+
+func TestDoInitOptsEntropy(t *testing.T) {
+	// The BIP39 test vector for all zero entropy
+	expected := map[int]string{
+		128: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		256: strings.Repeat("abandon ", 23) + "art",
+	}
+	for bits, want := range expected {
+		mnemonic, err := createMnemonic(bits, entropyFromReader(bytes.NewReader(make([]byte, 32))), bip39.NewMnemonic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != want {
+			t.Errorf("Expected %q for %d bits of zero entropy, got %q", want, bits, mnemonic)
+		}
+	}
+
+	mnemonic, err := createMnemonic(DefaultMnemonicEntropy, entropyFromReader(bytes.NewReader(make([]byte, 4))), bip39.NewMnemonic)
+	checkCreateMnemonicError(t, mnemonic, err)
+
+	var got string
+	err = DoInitOpts(InitOptions{
+		RepoRoot:        repoRootFolder,
+		MnemonicEntropy: 128,
+		Entropy:         bytes.NewReader(make([]byte, 16)),
+		DbInit: func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+			got = mnemonic
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if got != expected[128] {
+		t.Errorf("Expected the mnemonic to be generated from Entropy, got %q", got)
+	}
+	TearDown()
+}
+
+func checkCreateMnemonicError(t *testing.T, mnemonic string, err error) {
+	if mnemonic != "" {
+		t.Errorf("The mnemonic should have been an empty string but it is %s instead", mnemonic)
+	}
+	if err == nil {
+		t.Error("createMnemonic didn't throw an error")
+	}
+}
+
+// isError reports whether err is target or wraps it, like errors.Is, which the
+// Go 1.7 toolchain the tests also run on doesn't have
+func isError(err, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		switch e := err.(type) {
+		case *SentinelError:
+			if e.Err == target {
+				return true
+			}
+			err = e.Cause
+		case *os.PathError:
+			err = e.Err
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Removes files that are created when tests are executed
+func TearDown() {
+	os.RemoveAll(filepath.Join(testConfigFolder, "outbox"))
+	os.RemoveAll(filepath.Join(testConfigFolder, "root"))
+	os.RemoveAll(filepath.Join(testConfigFolder, "datastore"))
+	os.Remove(filepath.Join(testConfigFolder, "repo.lock"))
+
+	os.RemoveAll(filepath.Join(repoRootFolder, "blocks"))
+	os.RemoveAll(filepath.Join(repoRootFolder, "outbox"))
+	os.RemoveAll(filepath.Join(repoRootFolder, "logs"))
+	os.RemoveAll(filepath.Join(repoRootFolder, "root"))
+	os.RemoveAll(filepath.Join(repoRootFolder, "datastore"))
+	os.Remove(filepath.Join(repoRootFolder, "repo.lock"))
+	os.Remove(filepath.Join(repoRootFolder, "config"))
+	os.Remove(filepath.Join(repoRootFolder, "version"))
+	os.Remove(filepath.Join(repoRootFolder, ".cookie"))
+	os.Remove(filepath.Join(repoRootFolder, "repover"))
+	os.Remove(filepath.Join(repoRootFolder, "peerid"))
+	os.Remove(filepath.Join(repoRootFolder, keyspacePendingFile))
+}
+
+func TestDoInitOptsTimeout(t *testing.T) {
+	defer TearDown()
+	opts := InitOptions{
+		RepoRoot: repoRootFolder,
+		Testnet:  true,
+		Mnemonic: mnemonicFixture,
+		DbInit:   MockDbInit,
+		Timeout:  50 * time.Millisecond,
+		backend: &RepoBackend{
+			NewNode: func(ctx context.Context, r ipfsrepo.Repo) (*core.IpfsNode, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+	}
+	start := time.Now()
+	err := DoInitOpts(opts)
+	if !isError(err, ErrInitTimeout) {
+		t.Error("Expected ErrInitTimeout for a stuck keyspace step, got ", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("Expected init to give up at its timeout, took ", elapsed)
+	}
+	if fsrepo.IsInitialized(repoRootFolder) {
+		t.Error("Expected a timed out init to be rolled back")
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "root")); !os.IsNotExist(err) {
+		t.Error("Expected the OpenBazaar directories to be rolled back")
+	}
+
+	opts.Timeout = time.Minute
+	opts.backend = nil
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+}
+
+func TestDoInitKeyDerivation(t *testing.T) {
+	defer TearDown()
+	res, err := doInit(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: Ed25519KeypairBits,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		MnemonicEntropy: DefaultMnemonicEntropy,
+		Passphrase:      "my own passphrase",
+		AccountIndex:    2,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatalf("doInit threw an unexpected error: %s", err.Error())
+	}
+	d := res.KeyDerivation
+	if d == nil {
+		t.Fatal("Expected the key derivation in the result")
+	}
+	expected := KeyDerivation{
+		Source:           KeySourceMnemonic,
+		Scheme:           identityKeyScheme,
+		MnemonicLanguage: DefaultMnemonicLanguage,
+		MnemonicWords:    12,
+		CustomPassphrase: true,
+		AccountIndex:     2,
+		KeyType:          "Ed25519",
+	}
+	if *d != expected {
+		t.Errorf("Expected derivation %s, got %s", expected, d)
+	}
+	TearDown()
+
+	res, err = DoInitFromKey(context.Background(), InitOptions{RepoRoot: repoRootFolder, IdentityKey: res.IdentityKey, Testnet: true, Password: "password", CreationDate: time.Now(), DbInit: MockDbInit})
+	if err != nil {
+		t.Fatalf("DoInitFromKey threw an unexpected error: %s", err.Error())
+	}
+	if *res.KeyDerivation != (KeyDerivation{Source: KeySourceImported, KeyType: "Ed25519"}) {
+		t.Errorf("Expected an imported Ed25519 key, got %s", res.KeyDerivation)
+	}
+}
+
+func TestVerifyKeyspace(t *testing.T) {
+	defer TearDown()
+	db := &mockConfig{}
+	if _, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          db.Init,
+	}); err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	r, err := fsrepo.Open(repoRootFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	if cfg.Identity, err = ipfs.IdentityFromKey(db.identityKey); err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	nd, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer nd.Close()
+	if err := nd.SetupOfflineRouting(); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyKeyspace(context.Background(), nd); err != nil {
+		t.Error("Expected the node's IPNS name to resolve after init, got ", err)
+	}
+
+	_, ipnsKey := namesys.IpnsKeysForID(nd.Identity)
+	if err := r.Datastore().Delete(dshelp.NewKeyFromBinary([]byte(ipnsKey))); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyKeyspace(context.Background(), nd); !isError(err, ErrKeyspaceUnresolved) {
+		t.Error("Expected ErrKeyspaceUnresolved once the IPNS record is gone, got ", err)
+	}
 }
@@ -0,0 +1,192 @@
+//go:build !windows
+// +build !windows
+
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDoInitDirectoryMode(t *testing.T) {
+	for _, umask := range []int{0, 022, 077} {
+		for _, mode := range []os.FileMode{0, 0750} {
+			checkDoInitDirectoryMode(t, umask, mode)
+		}
+	}
+}
+
+func checkDoInitDirectoryMode(t *testing.T, umask int, mode os.FileMode) {
+	dir, err := ioutil.TempDir("", "ob-mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldUmask := syscall.Umask(umask)
+	_, err = DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          MockDbInit,
+		dirMode:         mode,
+	})
+	syscall.Umask(oldUmask)
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+
+	expected := mode
+	if expected == 0 {
+		expected = DefaultDirectoryMode
+	}
+	for _, d := range obDirectories {
+		fi, err := os.Stat(path.Join(dir, d))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if fi.Mode().Perm() != expected {
+			t.Errorf("Expected %s to have mode %s with umask %o, got %s", d, expected, umask, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestDoInitOptsDirectoryPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repoRoot := path.Join(dir, "repo")
+
+	opts := InitOptions{
+		RepoRoot:             repoRoot,
+		Testnet:              true,
+		Password:             "password",
+		Mnemonic:             mnemonicFixture,
+		DirectoryPermissions: DirectoryPermissions{"root/assets": 0755},
+		DbInit:               MockDbInit,
+	}
+	if err := DoInitOpts(opts); !isError(err, ErrInvalidDirectoryPermissions) {
+		t.Error("Expected ErrInvalidDirectoryPermissions for an unknown directory, got ", err)
+	}
+
+	opts.DirectoryPermissions = DirectoryPermissions{path.Join("root", "images"): 0755}
+	oldUmask := syscall.Umask(077)
+	err = DoInitOpts(opts)
+	syscall.Umask(oldUmask)
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+
+	expected := map[string]os.FileMode{
+		".":                                     0711,
+		"root":                                  0711,
+		path.Join("root", "images"):             0755,
+		path.Join("root", "images", "original"): 0755,
+		path.Join("root", "listings"):           DefaultDirectoryMode,
+		"outbox":                                DefaultDirectoryMode,
+		"logs":                                  DefaultDirectoryMode,
+	}
+	for d, mode := range expected {
+		fi, err := os.Stat(path.Join(repoRoot, d))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if fi.Mode().Perm() != mode {
+			t.Errorf("Expected %s to have mode %s, got %s", d, mode, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestRepairDirectoriesInsecurePermissions(t *testing.T) {
+	dir, _ := initVerifyRepo(t)
+	defer os.RemoveAll(dir)
+
+	listings := path.Join(dir, "root", "listings")
+	if err := ioutil.WriteFile(path.Join(listings, "listing.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(listings, 0777); err != nil {
+		t.Fatal(err)
+	}
+	repairs, err := RepairDirectories(dir)
+	if err != nil {
+		t.Fatal("RepairDirectories threw an unexpected error", err)
+	}
+	if len(repairs) != 1 || repairs[0].Path != listings {
+		t.Fatalf("Expected one permission repair, got %v", repairs)
+	}
+	fi, err := os.Stat(listings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("Expected mode 0755, got %s", fi.Mode().Perm())
+	}
+	if _, err := os.Stat(path.Join(listings, "listing.json")); err != nil {
+		t.Error("Expected the directory's content to be kept")
+	}
+}
+
+func TestRepairDirectoriesKeepsDirectoryPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repoRoot := path.Join(dir, "repo")
+
+	images := path.Join("root", "images")
+	opts := InitOptions{
+		RepoRoot:             repoRoot,
+		Testnet:              true,
+		Password:             "password",
+		Mnemonic:             mnemonicFixture,
+		DirectoryPermissions: DirectoryPermissions{images: 0775},
+		DbInit:               MockDbInit,
+	}
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if err := os.Chmod(path.Join(repoRoot, "logs"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	small := path.Join(images, "small")
+	if err := os.Remove(path.Join(repoRoot, small)); err != nil {
+		t.Fatal(err)
+	}
+
+	repairs, err := RepairDirectories(repoRoot)
+	if err != nil {
+		t.Fatal("RepairDirectories threw an unexpected error", err)
+	}
+	if len(repairs) != 2 {
+		t.Errorf("Expected the logs mode and the missing small images directory to be repaired, got %v", repairs)
+	}
+	expected := map[string]os.FileMode{
+		images: 0775,
+		small:  0775,
+		"logs": 0755,
+	}
+	for d, mode := range expected {
+		fi, err := os.Stat(path.Join(repoRoot, d))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if fi.Mode().Perm() != mode {
+			t.Errorf("Expected %s to have mode %s, got %s", d, mode, fi.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// BinaryVersion is recorded in the init summary. The daemon sets it to its
+// own version, which the repo package can't import.
+var BinaryVersion = "unknown"
+
+// initLogFile is appended a summary of each init for support and forensics
+const initLogFile = "init.log"
+
+// initSummary is everything recorded about an init. It deliberately has no
+// field for the mnemonic, passphrase or keys so that they can't be logged.
+type initSummary struct {
+	Version    string
+	Time       time.Time
+	Testnet    bool
+	WalletType string
+	PeerID     string
+}
+
+func (s initSummary) String() string {
+	return fmt.Sprintf("Initialized OpenBazaar repo\nVersion: %s\nTime: %s\nTestnet: %t\nWallet: %s\nPeer ID: %s\n\n",
+		s.Version, s.Time.UTC().Format(time.RFC3339), s.Testnet, s.WalletType, s.PeerID)
+}
+
+// writeInitSummary appends the summary of a successful init to the init log
+// in the logs directory
+func writeInitSummary(repoRoot string, testnet bool, overrides *ConfigOverrides, peerID string) error {
+	w := DefaultWalletConfig
+	if overrides != nil && overrides.Wallet != nil {
+		w = mergeWalletConfig(w, *overrides.Wallet)
+	}
+	s := initSummary{
+		Version:    BinaryVersion,
+		Time:       time.Now(),
+		Testnet:    testnet,
+		WalletType: w.Type,
+		PeerID:     peerID,
+	}
+	f, err := os.OpenFile(path.Join(repoRoot, "logs", initLogFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(s.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
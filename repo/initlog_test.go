@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoInitWritesSummary(t *testing.T) {
+	defer TearDown()
+	overrides := &ConfigOverrides{Wallet: &WalletConfig{Type: "bitcoind"}}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		Passphrase:      "secret passphrase",
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          MockDbInit,
+	})
+	if err != nil {
+		t.Fatal("DoInitOptsResult threw an unexpected error", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(repoRootFolder, "logs", initLogFile))
+	if err != nil {
+		t.Fatal("Expected the init summary to be written", err)
+	}
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if i := strings.Index(scanner.Text(), ": "); i > 0 {
+			fields[scanner.Text()[:i]] = scanner.Text()[i+2:]
+		}
+	}
+	expected := map[string]string{
+		"Version": BinaryVersion,
+		"Testnet": "true",
+		"Wallet":  "bitcoind",
+		"Peer ID": res.PeerID,
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("Expected %s to be %q, got %q", k, v, fields[k])
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, fields["Time"]); err != nil {
+		t.Error("Expected an RFC 3339 timestamp, got ", fields["Time"])
+	}
+
+	summary := string(b)
+	for _, secret := range []string{
+		hex.EncodeToString(res.IdentityKey),
+		base64.StdEncoding.EncodeToString(res.IdentityKey),
+		"secret passphrase",
+		"password",
+	} {
+		if strings.Contains(summary, secret) {
+			t.Errorf("Expected the init summary to omit %q", secret)
+		}
+	}
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(summary) {
+		words[word] = true
+	}
+	for _, word := range strings.Fields(mnemonicFixture) {
+		if words[word] {
+			t.Errorf("Expected the init summary to omit the mnemonic word %q", word)
+		}
+	}
+}
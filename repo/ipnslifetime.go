@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/namesys"
+	ipath "github.com/ipfs/go-ipfs/path"
+	"github.com/ipfs/go-ipfs/repo/config"
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+)
+
+// Bounds of ConfigOverrides.IPNSRecordLifetime. A record must outlive the
+// daily republish, and one valid for much longer than a year would keep
+// pointing at a store its owner has abandoned.
+const (
+	MinIPNSRecordLifetime = 24 * time.Hour
+	MaxIPNSRecordLifetime = 365 * 24 * time.Hour
+)
+
+var ErrInvalidRecordLifetime = fmt.Errorf("IPNS record lifetime must be from %s to %s", MinIPNSRecordLifetime, MaxIPNSRecordLifetime)
+
+// applyRecordLifetime writes overrides.IPNSRecordLifetime to the Ipns section
+// of conf, which init reads back when publishing the keyspace
+func applyRecordLifetime(conf *config.Config, overrides *ConfigOverrides) error {
+	if overrides == nil || overrides.IPNSRecordLifetime == 0 {
+		return nil
+	}
+	lifetime := overrides.IPNSRecordLifetime
+	if lifetime < MinIPNSRecordLifetime || lifetime > MaxIPNSRecordLifetime {
+		return wrapErrorf(ErrInvalidRecordLifetime, nil, "got %s", lifetime)
+	}
+	conf.Ipns.RecordLifetime = formatRecordLifetime(lifetime)
+	return nil
+}
+
+// formatRecordLifetime writes whole days the way the default "7d" is written
+func formatRecordLifetime(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return d.String()
+}
+
+// parseRecordLifetime reads an Ipns.RecordLifetime written by
+// formatRecordLifetime
+func parseRecordLifetime(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New("lifetime must be positive")
+	}
+	return d, nil
+}
+
+// recordLifetime returns the lifetime the config sets for the node's IPNS
+// record, or namesys.DefaultPublishLifetime if it sets none
+func recordLifetime(cfg *config.Config) time.Duration {
+	if cfg.Ipns.RecordLifetime == "" {
+		return namesys.DefaultPublishLifetime
+	}
+	d, err := parseRecordLifetime(cfg.Ipns.RecordLifetime)
+	if err != nil {
+		log.Warningf("Publishing with the default IPNS record lifetime, the configured %q is invalid: %s", cfg.Ipns.RecordLifetime, err)
+		return namesys.DefaultPublishLifetime
+	}
+	return d
+}
+
+// ConfigureRepublisher makes the IPNS republisher of the online node nd
+// publish records that stay valid for the Ipns.RecordLifetime of its config.
+// The vendored go-ipfs sets the lifetime from Ipns.RepublishPeriod instead, so
+// without this the republished record would expire as the next republish is
+// due. The republisher first reads the lifetime a republish period after the
+// node is built, so this must be called right after it.
+func ConfigureRepublisher(nd *core.IpfsNode) error {
+	if nd.IpnsRepub == nil {
+		return nil
+	}
+	cfg, err := nd.Repo.Config()
+	if err != nil {
+		return err
+	}
+	nd.IpnsRepub.RecordLifetime = recordLifetime(cfg)
+	return nil
+}
+
+// lifetimePublisher publishes records that stay valid for lifetime instead of
+// namesys.DefaultPublishLifetime
+type lifetimePublisher struct {
+	namesys.Publisher
+	lifetime time.Duration
+}
+
+func (p lifetimePublisher) Publish(ctx context.Context, k ci.PrivKey, value ipath.Path) error {
+	return p.PublishWithEOL(ctx, k, value, time.Now().Add(p.lifetime))
+}
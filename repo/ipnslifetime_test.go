@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/namesys"
+	ipnspb "github.com/ipfs/go-ipfs/namesys/pb"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	offroute "github.com/ipfs/go-ipfs/routing/offline"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+)
+
+// readIpnsEOL returns when the IPNS record published at init stops being valid
+func readIpnsEOL(t *testing.T, identityKey []byte) time.Time {
+	r, err := fsrepo.Open(repoRootFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	if cfg.Identity, err = ipfs.IdentityFromKey(identityKey); err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	nd, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer nd.Close()
+	_, ipnsKey := namesys.IpnsKeysForID(nd.Identity)
+	val, err := offroute.NewOfflineRouter(r.Datastore(), nd.PrivateKey).GetValue(context.Background(), ipnsKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := new(ipnspb.IpnsEntry)
+	if err := proto.Unmarshal(val, entry); err != nil {
+		t.Fatal(err)
+	}
+	eol, err := time.Parse(time.RFC3339Nano, string(entry.GetValidity()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eol
+}
+
+func TestDoInitIPNSRecordLifetime(t *testing.T) {
+	for _, lifetime := range []time.Duration{0, 30 * 24 * time.Hour, 36 * time.Hour} {
+		db := &mockConfig{}
+		start := time.Now()
+		overrides := &ConfigOverrides{IPNSRecordLifetime: lifetime}
+		if _, err := DoInitOptsResult(context.Background(), InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			Mnemonic:        mnemonicFixture,
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          db.Init,
+		}); err != nil {
+			t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+		}
+		end := time.Now()
+		expected := lifetime
+		if expected == 0 {
+			expected = namesys.DefaultPublishLifetime
+		}
+		eol := readIpnsEOL(t, db.identityKey)
+		if eol.Before(start.Add(expected).Add(-time.Second)) || eol.After(end.Add(expected)) {
+			t.Errorf("Expected the record to be valid for %s, it expires at %s", expected, eol)
+		}
+		if lifetime != 0 {
+			conf, err := fsrepo.ConfigAt(repoRootFolder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d, err := parseRecordLifetime(conf.Ipns.RecordLifetime); err != nil || d != lifetime {
+				t.Errorf("Expected Ipns.RecordLifetime to record %s, got %q", lifetime, conf.Ipns.RecordLifetime)
+			}
+		}
+		TearDown()
+	}
+
+	for _, lifetime := range []time.Duration{-time.Hour, time.Hour, MaxIPNSRecordLifetime + time.Hour} {
+		overrides := &ConfigOverrides{IPNSRecordLifetime: lifetime}
+		err := DoInitOpts(InitOptions{
+			RepoRoot:        repoRootFolder,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			CreationDate:    time.Now(),
+			Overrides:       overrides,
+			DbInit:          MockDbInit,
+		})
+		if !isError(err, ErrInvalidRecordLifetime) {
+			t.Errorf("Expected ErrInvalidRecordLifetime for %s, got %v", lifetime, err)
+		}
+		if fsrepo.IsInitialized(repoRootFolder) {
+			t.Errorf("Expected nothing to be initialized with a lifetime of %s", lifetime)
+		}
+		TearDown()
+	}
+}
+
+func TestConfigureRepublisher(t *testing.T) {
+	defer TearDown()
+	db := &mockConfig{}
+	lifetime := 30 * 24 * time.Hour
+	overrides := &ConfigOverrides{IPNSRecordLifetime: lifetime}
+	if _, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        repoRootFolder,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		Overrides:       overrides,
+		DbInit:          db.Init,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fsrepo.Open(repoRootFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	if cfg.Identity, err = ipfs.IdentityFromKey(db.identityKey); err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	// Start the republisher as the daemon does, without reaching the network
+	cfg.Addresses.Swarm = []string{"/ip4/127.0.0.1/tcp/0"}
+	cfg.Bootstrap = nil
+	nd, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r, Online: true})
+	if err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	defer nd.Close()
+	if nd.IpnsRepub == nil {
+		t.Fatal("Expected the online node to run an IPNS republisher")
+	}
+
+	if err := ConfigureRepublisher(nd); err != nil {
+		t.Fatal("ConfigureRepublisher threw an unexpected error", err)
+	}
+	if nd.IpnsRepub.RecordLifetime != lifetime {
+		t.Errorf("Expected the republisher to publish records valid for %s, got %s", lifetime, nd.IpnsRepub.RecordLifetime)
+	}
+}
@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+// outboxManifestFile and logRotationFile describe the outbox and logs
+// directories. They are written at init so that the rest of the code starts
+// from a consistent state.
+const (
+	outboxManifestFile = "manifest.json"
+	logRotationFile    = "rotation.json"
+)
+
+// DefaultOutboxMaxSize is the number of bytes EnforceOutboxMaxSize keeps in
+// the outbox
+const DefaultOutboxMaxSize = 100 << 20
+
+// OutboxManifest describes the outbox, where self hosted files wait to be
+// pushed to peers
+type OutboxManifest struct {
+	Version int
+
+	// MaxSize is the number of bytes kept by EnforceOutboxMaxSize. Zero
+	// keeps everything.
+	MaxSize int64
+}
+
+// LogRotation holds the rotation settings of the log files
+type LogRotation struct {
+	MaxSize    int // Megabytes
+	MaxBackups int
+	MaxAge     int // Days
+}
+
+// DefaultLogRotation is written to the logs directory at init
+var DefaultLogRotation = LogRotation{MaxSize: 10, MaxBackups: 3, MaxAge: 30}
+
+// writeDirectoryManifests writes the initial outbox manifest and log rotation
+// settings. Existing files are left alone.
+func writeDirectoryManifests(repoRoot string) error {
+	if err := writeJSONIfMissing(path.Join(repoRoot, "outbox", outboxManifestFile), OutboxManifest{Version: 1, MaxSize: DefaultOutboxMaxSize}); err != nil {
+		return err
+	}
+	return writeJSONIfMissing(path.Join(repoRoot, "logs", logRotationFile), DefaultLogRotation)
+}
+
+func writeJSONIfMissing(name string, v interface{}) error {
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b, 0600)
+}
+
+// GetOutboxManifest reads the outbox manifest of the repo
+func GetOutboxManifest(repoRoot string) (*OutboxManifest, error) {
+	m := new(OutboxManifest)
+	if err := readJSON(path.Join(repoRoot, "outbox", outboxManifestFile), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetLogRotation reads the log rotation settings of the repo
+func GetLogRotation(repoRoot string) (*LogRotation, error) {
+	r := new(LogRotation)
+	if err := readJSON(path.Join(repoRoot, "logs", logRotationFile), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func readJSON(name string, v interface{}) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return MalformedConfigError
+	}
+	return nil
+}
+
+// EnforceOutboxMaxSize removes the oldest files from the outbox until it
+// holds at most the manifest's MaxSize bytes
+func EnforceOutboxMaxSize(repoRoot string) error {
+	m, err := GetOutboxManifest(repoRoot)
+	if err != nil {
+		return err
+	}
+	if m.MaxSize == 0 {
+		return nil
+	}
+	return enforceMaxSize(path.Join(repoRoot, "outbox"), m.MaxSize, outboxManifestFile)
+}
+
+type filesByModTime []os.FileInfo
+
+func (f filesByModTime) Len() int           { return len(f) }
+func (f filesByModTime) Less(i, j int) bool { return f[i].ModTime().Before(f[j].ModTime()) }
+func (f filesByModTime) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// enforceMaxSize removes the oldest regular files directly in dir, except
+// the kept ones, until the remaining files total at most maxSize bytes
+func enforceMaxSize(dir string, maxSize int64, keep ...string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool)
+	for _, name := range keep {
+		kept[name] = true
+	}
+	var files []os.FileInfo
+	var total int64
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || kept[fi.Name()] {
+			continue
+		}
+		files = append(files, fi)
+		total += fi.Size()
+	}
+	sort.Sort(filesByModTime(files))
+	for _, fi := range files {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(path.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+		total -= fi.Size()
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDirectoryManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = DoInit(dir, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := GetOutboxManifest(dir)
+	if err != nil {
+		t.Error("GetOutboxManifest threw an unexpected error", err)
+	} else if m.Version != 1 || m.MaxSize != DefaultOutboxMaxSize {
+		t.Errorf("Unexpected outbox manifest %+v", m)
+	}
+	r, err := GetLogRotation(dir)
+	if err != nil {
+		t.Error("GetLogRotation threw an unexpected error", err)
+	} else if *r != DefaultLogRotation {
+		t.Errorf("Expected the default log rotation, got %+v", r)
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, "logs", "rotation.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetLogRotation(dir); err != MalformedConfigError {
+		t.Error("Expected MalformedConfigError, got ", err)
+	}
+}
+
+func TestEnforceMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"oldest", "older", "newest", "manifest.json"} {
+		p := path.Join(dir, name)
+		if err := ioutil.WriteFile(p, make([]byte, 10), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := enforceMaxSize(dir, 15, "manifest.json"); err != nil {
+		t.Error("enforceMaxSize threw an unexpected error", err)
+	}
+	for name, exists := range map[string]bool{"oldest": false, "older": false, "newest": true, "manifest.json": true} {
+		if _, err := os.Stat(path.Join(dir, name)); (err == nil) != exists {
+			t.Errorf("Expected %s to exist: %t", name, exists)
+		}
+	}
+}
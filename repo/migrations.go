@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"errors"
+)
+
+// Migration upgrades a repo from version From to version To
+type Migration struct {
+	From  int
+	To    int
+	Apply func(repoRoot string) error
+}
+
+// Migrations are run in order by RunMigrations. Each step should leave the
+// repo usable by its From version if it fails part way through.
+var Migrations = []Migration{
+	{From: 0, To: 1, Apply: migrateVersion0},
+}
+
+// ErrMigration wraps the failure of a single migration step
+var ErrMigration = errors.New("Repo migration failed")
+
+// migrateVersion0 creates the directories and manifests that version 0 repos
+// may be missing
+func migrateVersion0(repoRoot string) error {
+	if err := EnsureDirectories(repoRoot); err != nil {
+		return err
+	}
+	return writeDirectoryManifests(repoRoot)
+}
+
+// RunMigrations applies Migrations to bring the repo from the version
+// recorded on disk up to RepoVersion. The version is bumped after each step,
+// and anything a failed step added to the repo root is removed, so that an
+// interrupted migration resumes from the last completed step.
+func RunMigrations(repoRoot string) error {
+	return runMigrations(repoRoot, Migrations, RepoVersion)
+}
+
+func runMigrations(repoRoot string, migrations []Migration, target int) error {
+	// Keep an init from running on the repo while it is migrated
+	l, err := lockRepoInit(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	version, err := GetRepoVersion(repoRoot)
+	if err != nil {
+		return err
+	}
+	if version > target {
+		return ErrRepoTooNew
+	}
+	for version < target {
+		m, ok := findMigration(migrations, version)
+		if !ok {
+			return wrapErrorf(ErrMigration, nil, "no migration from version %d", version)
+		}
+		snapshot := snapshotRepoRoot(repoRoot)
+		if err := m.Apply(repoRoot); err != nil {
+			snapshot.rollback()
+			return wrapErrorf(ErrMigration, err, "version %d to %d", m.From, m.To)
+		}
+		if err := writeRepoVersion(repoRoot, m.To); err != nil {
+			return err
+		}
+		log.Infof("Migrated repo from version %d to %d", m.From, m.To)
+		version = m.To
+	}
+	return nil
+}
+
+func findMigration(migrations []Migration, from int) (Migration, bool) {
+	for _, m := range migrations {
+		if m.From == from && m.To > from {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestRunMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeRepoVersion(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied []int
+	record := func(to int) func(string) error {
+		return func(repoRoot string) error {
+			version, err := GetRepoVersion(repoRoot)
+			if err != nil {
+				return err
+			}
+			if version != to-1 {
+				t.Errorf("Expected migration to %d to see version %d, got %d", to, to-1, version)
+			}
+			applied = append(applied, to)
+			return nil
+		}
+	}
+	// Listed out of order to check they are applied by version
+	migrations := []Migration{
+		{From: 2, To: 3, Apply: record(3)},
+		{From: 1, To: 2, Apply: record(2)},
+	}
+	if err := runMigrations(dir, migrations, 3); err != nil {
+		t.Fatal("runMigrations threw an unexpected error", err)
+	}
+	if !reflect.DeepEqual(applied, []int{2, 3}) {
+		t.Error("Expected the migrations to be applied in order, got ", applied)
+	}
+	if version, err := GetRepoVersion(dir); err != nil || version != 3 {
+		t.Errorf("Expected the repo version to be bumped to 3, got %d (%v)", version, err)
+	}
+	if _, err := os.Stat(path.Join(dir, initLockFile)); !os.IsNotExist(err) {
+		t.Error("Expected the lock to be released")
+	}
+
+	// Already migrated
+	applied = nil
+	if err := runMigrations(dir, migrations, 3); err != nil || len(applied) != 0 {
+		t.Errorf("Expected no migrations to run again, ran %v (%v)", applied, err)
+	}
+	if err := runMigrations(dir, migrations, 2); err != ErrRepoTooNew {
+		t.Error("Expected ErrRepoTooNew, got ", err)
+	}
+	if err := runMigrations(dir, migrations, 4); !isError(err, ErrMigration) {
+		t.Error("Expected ErrMigration for a missing migration, got ", err)
+	}
+}
+
+func TestRunMigrationsFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeRepoVersion(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	migrations := []Migration{
+		{From: 1, To: 2, Apply: func(string) error { return nil }},
+		{From: 2, To: 3, Apply: func(repoRoot string) error {
+			if err := ioutil.WriteFile(path.Join(repoRoot, "partial"), []byte("x"), 0644); err != nil {
+				return err
+			}
+			return errFailed
+		}},
+	}
+	err = runMigrations(dir, migrations, 3)
+	if !isError(err, ErrMigration) || !isError(err, errFailed) {
+		t.Error("Expected the failed step to be wrapped in ErrMigration, got ", err)
+	}
+	if version, err := GetRepoVersion(dir); err != nil || version != 2 {
+		t.Errorf("Expected the repo to stay at the last completed version 2, got %d (%v)", version, err)
+	}
+	if _, err := os.Stat(path.Join(dir, "partial")); !os.IsNotExist(err) {
+		t.Error("Expected the failed step to be rolled back")
+	}
+}
@@ -0,0 +1,312 @@
+package repo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var ErrMnemonicBackupPassword = errors.New("A password is required to encrypt the mnemonic backup")
+var ErrInvalidMnemonicBackup = errors.New("Mnemonic backup could not be decrypted. Check the password.")
+var ErrEmptyMnemonicSource = errors.New("Mnemonic source is empty")
+
+// MnemonicSource supplies the mnemonic to restore from without it being
+// passed on the command line, where it would show up in process listings and
+// shell history
+type MnemonicSource interface {
+	ReadMnemonic() (string, error)
+}
+
+// EnvMnemonic reads the mnemonic from the environment variable it names. The
+// variable is unset once read so child processes don't inherit it.
+type EnvMnemonic string
+
+func (e EnvMnemonic) ReadMnemonic() (string, error) {
+	mnemonic := strings.TrimSpace(os.Getenv(string(e)))
+	os.Unsetenv(string(e))
+	if mnemonic == "" {
+		return "", ErrEmptyMnemonicSource
+	}
+	return mnemonic, nil
+}
+
+// FileMnemonic reads the mnemonic from the file at the path it holds, which
+// may be a file descriptor such as /dev/fd/3
+type FileMnemonic string
+
+func (f FileMnemonic) ReadMnemonic() (string, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return "", err
+	}
+	mnemonic := strings.TrimSpace(string(b))
+	if mnemonic == "" {
+		return "", ErrEmptyMnemonicSource
+	}
+	return mnemonic, nil
+}
+
+// A mnemonic backup is a version byte, the PBKDF2 salt, the AES-GCM nonce and
+// the sealed mnemonic. The version byte is authenticated as additional data.
+const (
+	mnemonicBackupVersion    byte = 1
+	mnemonicBackupSaltSize        = 16
+	mnemonicBackupIterations      = 100000
+)
+
+// DoInitFromMnemonicBackup initializes the repo like DoInit using the mnemonic
+// stored in an encrypted backup file. The backup is decrypted with password,
+// which is also used to encrypt the database. An empty passphrase derives the
+// seed with DefaultSeedPassphrase like DoInit.
+func DoInitFromMnemonicBackup(repoRoot string, nBitsForKeypair int, testnet bool, password string, backupFile string, passphrase string, creationDate time.Time, dbInit func(string, []byte, string, time.Time) error) error {
+	mnemonic, err := ReadMnemonicBackup(backupFile, password)
+	if err != nil {
+		return err
+	}
+	if err := validateKeypairBits(nBitsForKeypair); err != nil {
+		return err
+	}
+	return DoInitOpts(InitOptions{
+		RepoRoot:        repoRoot,
+		NBitsForKeypair: nBitsForKeypair,
+		Testnet:         testnet,
+		Password:        password,
+		Mnemonic:        mnemonic,
+		Passphrase:      passphrase,
+		CreationDate:    creationDate,
+		DbInit:          dbInit,
+	})
+}
+
+// ExportMnemonic writes the node's mnemonic to backupFile encrypted with
+// password. The file is only readable by its owner.
+func ExportMnemonic(db Config, backupFile string, password string) error {
+	mnemonic, err := db.GetMnemonic()
+	if err != nil {
+		return err
+	}
+	b, err := encryptMnemonic(mnemonic, password)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(backupFile, b, 0600)
+}
+
+// ReadMnemonicBackup returns the mnemonic stored in an encrypted backup file
+func ReadMnemonicBackup(backupFile string, password string) (string, error) {
+	b, err := ioutil.ReadFile(backupFile)
+	if err != nil {
+		return "", err
+	}
+	return decryptMnemonic(b, password)
+}
+
+func encryptMnemonic(mnemonic string, password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrMnemonicBackupPassword
+	}
+	return encryptBackup(mnemonicBackupVersion, []byte(mnemonic), password)
+}
+
+func decryptMnemonic(b []byte, password string) (string, error) {
+	plaintext, err := decryptBackup(mnemonicBackupVersion, b, password)
+	if err != nil {
+		return "", ErrInvalidMnemonicBackup
+	}
+	return string(plaintext), nil
+}
+
+// encryptBackup seals plaintext in the mnemonic backup format, with version
+// telling apart the kinds of backup
+func encryptBackup(version byte, plaintext []byte, password string) ([]byte, error) {
+	salt := make([]byte, mnemonicBackupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := mnemonicBackupCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append([]byte{version}, salt...)
+	header = append(header, nonce...)
+	return gcm.Seal(header, nonce, plaintext, []byte{version}), nil
+}
+
+var errBackupDecrypt = errors.New("backup could not be decrypted")
+
+// decryptBackup opens a backup sealed by encryptBackup with the same version
+func decryptBackup(version byte, b []byte, password string) ([]byte, error) {
+	if len(b) < 1+mnemonicBackupSaltSize || b[0] != version {
+		return nil, errBackupDecrypt
+	}
+	salt := b[1 : 1+mnemonicBackupSaltSize]
+	gcm, err := mnemonicBackupCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	rest := b[1+mnemonicBackupSaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errBackupDecrypt
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], []byte{version})
+	if err != nil {
+		return nil, errBackupDecrypt
+	}
+	return plaintext, nil
+}
+
+func mnemonicBackupCipher(password string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(password), salt, mnemonicBackupIterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MnemonicStrength describes a mnemonic so users restoring from a backup can
+// confirm it is complete before relying on it
+type MnemonicStrength struct {
+	Words int
+
+	// EntropyBits is zero if Words is not a standard BIP39 length
+	EntropyBits int
+
+	// UnknownWords are not in the BIP39 wordlist
+	UnknownWords []string
+
+	ChecksumValid bool
+}
+
+func (m MnemonicStrength) String() string {
+	checksum := "valid checksum"
+	if !m.ChecksumValid {
+		checksum = "invalid checksum"
+	}
+	if m.EntropyBits == 0 {
+		return fmt.Sprintf("%d words, non-standard length, %s", m.Words, checksum)
+	}
+	return fmt.Sprintf("%d words, %d bits of entropy, %s", m.Words, m.EntropyBits, checksum)
+}
+
+// AnalyzeMnemonic reports the word count, entropy and checksum validity of a
+// mnemonic. A phrase with a dropped word has a non-standard length and an
+// invalid checksum.
+func AnalyzeMnemonic(mnemonic string) MnemonicStrength {
+	return analyzeMnemonic(mnemonic, englishWordlist)
+}
+
+func analyzeMnemonic(mnemonic string, w *wordlist) MnemonicStrength {
+	words := strings.Fields(mnemonic)
+	strength := MnemonicStrength{Words: len(words)}
+	// Every word carries 11 bits, one in 33 of which is checksum
+	if len(words) > 0 && len(words)%3 == 0 {
+		entropyBits := len(words) * 11 * 32 / 33
+		if validateMnemonicEntropy(entropyBits) == nil {
+			strength.EntropyBits = entropyBits
+		}
+	}
+	for _, word := range words {
+		if _, ok := w.reverse[word]; !ok {
+			strength.UnknownWords = append(strength.UnknownWords, word)
+		}
+	}
+	if strength.EntropyBits != 0 && len(strength.UnknownWords) == 0 {
+		strength.ChecksumValid = mnemonicChecksumValid(words, strength.EntropyBits, w)
+	}
+	return strength
+}
+
+// mnemonicChecksumValid checks the BIP39 checksum, the first entropyBits/32
+// bits of the SHA-256 of the entropy, that follows the entropy in the words.
+// bip39.IsMnemonicValid only checks the wordlist.
+func mnemonicChecksumValid(words []string, entropyBits int, w *wordlist) bool {
+	entropy, checksum := mnemonicToEntropy(words, entropyBits, w)
+	h := sha256.Sum256(entropy)
+	return checksum == int64(h[0]>>(8-uint(entropyBits/32)))
+}
+
+// mnemonicToEntropy splits the bits carried by the words of a mnemonic into
+// its entropy and checksum
+func mnemonicToEntropy(words []string, entropyBits int, w *wordlist) ([]byte, int64) {
+	b := new(big.Int)
+	for _, word := range words {
+		b.Lsh(b, 11)
+		b.Or(b, big.NewInt(int64(w.reverse[word])))
+	}
+	checksumBits := uint(entropyBits / 32)
+	checksum := new(big.Int).And(b, big.NewInt(1<<checksumBits-1))
+	entropy := new(big.Int).Rsh(b, checksumBits).Bytes()
+	padded := make([]byte, entropyBits/8)
+	copy(padded[len(padded)-len(entropy):], entropy)
+	return padded, checksum.Int64()
+}
+
+var ErrMnemonicConfirmation = errors.New("The confirmed words do not match the mnemonic")
+
+// mnemonicConfirmationWords is how many words of the mnemonic the user is
+// asked to confirm
+const mnemonicConfirmationWords = 3
+
+// ConfirmMnemonicFunc shows the mnemonic to the user and returns the words
+// they wrote down at each of positions, which count from 0
+type ConfirmMnemonicFunc func(mnemonic string, positions []int) ([]string, error)
+
+// confirmMnemonic asks confirm for randomly picked words of the mnemonic
+func confirmMnemonic(mnemonic string, confirm ConfirmMnemonicFunc) error {
+	words := strings.Fields(mnemonic)
+	positions, err := pickWordPositions(len(words), mnemonicConfirmationWords)
+	if err != nil {
+		return err
+	}
+	confirmed, err := confirm(mnemonic, positions)
+	if err != nil {
+		return err
+	}
+	if len(confirmed) != len(positions) {
+		return ErrMnemonicConfirmation
+	}
+	for i, p := range positions {
+		if strings.ToLower(strings.TrimSpace(confirmed[i])) != words[p] {
+			return ErrMnemonicConfirmation
+		}
+	}
+	return nil
+}
+
+// pickWordPositions returns n distinct positions below count in ascending
+// order
+func pickWordPositions(count, n int) ([]int, error) {
+	if n > count {
+		n = count
+	}
+	picked := make(map[int]bool)
+	for len(picked) < n {
+		p, err := rand.Int(rand.Reader, big.NewInt(int64(count)))
+		if err != nil {
+			return nil, err
+		}
+		picked[int(p.Int64())] = true
+	}
+	positions := make([]int, 0, n)
+	for p := range picked {
+		positions = append(positions, p)
+	}
+	sort.Ints(positions)
+	return positions, nil
+}
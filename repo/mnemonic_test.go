@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
+)
+
+func TestMnemonicBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-mnemonic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backupFile := path.Join(dir, "mnemonic.bak")
+
+	if err := ExportMnemonic(&mockConfig{}, backupFile, "password"); err != nil {
+		t.Error("ExportMnemonic threw an unexpected error", err)
+	}
+	mnemonic, err := ReadMnemonicBackup(backupFile, "password")
+	if err != nil {
+		t.Error("ReadMnemonicBackup threw an unexpected error", err)
+	}
+	if mnemonic != mnemonicFixture {
+		t.Error("Expected the exported mnemonic, got ", mnemonic)
+	}
+
+	if _, err := ReadMnemonicBackup(backupFile, "wrong password"); err != ErrInvalidMnemonicBackup {
+		t.Error("Expected ErrInvalidMnemonicBackup for a wrong password, got ", err)
+	}
+	if _, err := decryptMnemonic([]byte{mnemonicBackupVersion}, "password"); err != ErrInvalidMnemonicBackup {
+		t.Error("Expected ErrInvalidMnemonicBackup for a truncated backup, got ", err)
+	}
+	if err := ExportMnemonic(&mockConfig{}, backupFile, ""); err != ErrMnemonicBackupPassword {
+		t.Error("Expected ErrMnemonicBackupPassword for an empty password, got ", err)
+	}
+}
+
+func TestDoInitFromMnemonicBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-mnemonic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backupFile := path.Join(dir, "mnemonic.bak")
+	if err := ExportMnemonic(&mockConfig{}, backupFile, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	var initMnemonic string
+	dbInit := func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+		initMnemonic = mnemonic
+		return nil
+	}
+	if err := DoInitFromMnemonicBackup(repoRootFolder, 4096, true, "wrong password", backupFile, DefaultSeedPassphrase, time.Now(), dbInit); err != ErrInvalidMnemonicBackup {
+		t.Error("Expected ErrInvalidMnemonicBackup, got ", err)
+	}
+	if err := DoInitFromMnemonicBackup(repoRootFolder, 4096, true, "password", backupFile, DefaultSeedPassphrase, time.Now(), dbInit); err != nil {
+		t.Error("DoInitFromMnemonicBackup threw an unexpected error", err)
+	}
+	if initMnemonic != mnemonicFixture {
+		t.Error("Expected the repo to be initialized with the backed up mnemonic, got ", initMnemonic)
+	}
+	TearDown()
+}
+
+func TestMnemonicBackupRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-mnemonic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backupFile := path.Join(dir, "mnemonic.bak")
+
+	db := &mockConfig{}
+	if err := DoInit(path.Join(dir, "original"), 4096, true, "password", mnemonicFixture, time.Now(), db.Init); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportMnemonic(db, backupFile, "password"); err != nil {
+		t.Fatal(err)
+	}
+	restored := &mockConfig{}
+	if err := DoInitFromMnemonicBackup(path.Join(dir, "restored"), 4096, true, "password", backupFile, "", time.Now(), restored.Init); err != nil {
+		t.Fatal("DoInitFromMnemonicBackup threw an unexpected error", err)
+	}
+
+	original, err := ipfs.IdentityFromKey(db.identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := ipfs.IdentityFromKey(restored.identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.PeerID != original.PeerID {
+		t.Errorf("Expected the restored node to have peer ID %s, got %s", original.PeerID, identity.PeerID)
+	}
+}
+
+func TestAnalyzeMnemonic(t *testing.T) {
+	words24 := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"
+	tests := []struct {
+		mnemonic string
+		expected MnemonicStrength
+	}{
+		{mnemonicFixture, MnemonicStrength{Words: 12, EntropyBits: 128, ChecksumValid: true}},
+		{words24, MnemonicStrength{Words: 24, EntropyBits: 256, ChecksumValid: true}},
+		// Bad checksum
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", MnemonicStrength{Words: 12, EntropyBits: 128}},
+		// A dropped word
+		{strings.TrimSuffix(words24, " art"), MnemonicStrength{Words: 23}},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandonn", MnemonicStrength{Words: 12, EntropyBits: 128, UnknownWords: []string{"abandonn"}}},
+	}
+	for _, test := range tests {
+		strength := AnalyzeMnemonic(test.mnemonic)
+		if !reflect.DeepEqual(strength, test.expected) {
+			t.Errorf("Expected %+v for %q, got %+v", test.expected, test.mnemonic, strength)
+		}
+	}
+}
+
+func TestMnemonicSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-mnemonic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "mnemonic")
+	if err := ioutil.WriteFile(file, []byte(mnemonicFixture+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if mnemonic, err := FileMnemonic(file).ReadMnemonic(); err != nil || mnemonic != mnemonicFixture {
+		t.Errorf("Expected the mnemonic from the file, got %q, %v", mnemonic, err)
+	}
+
+	os.Setenv("OB_TEST_MNEMONIC", mnemonicFixture)
+	if mnemonic, err := EnvMnemonic("OB_TEST_MNEMONIC").ReadMnemonic(); err != nil || mnemonic != mnemonicFixture {
+		t.Errorf("Expected the mnemonic from the environment, got %q, %v", mnemonic, err)
+	}
+	if _, ok := os.LookupEnv("OB_TEST_MNEMONIC"); ok {
+		t.Error("Expected the environment variable to be unset once read")
+	}
+
+	empty := path.Join(dir, "empty")
+	if err := ioutil.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileMnemonic(empty).ReadMnemonic(); err != ErrEmptyMnemonicSource {
+		t.Error("Expected ErrEmptyMnemonicSource for an empty file, got ", err)
+	}
+	if _, err := EnvMnemonic("OB_TEST_MNEMONIC").ReadMnemonic(); err != ErrEmptyMnemonicSource {
+		t.Error("Expected ErrEmptyMnemonicSource for an unset variable, got ", err)
+	}
+
+	db := &mockConfig{}
+	err = DoInitOpts(InitOptions{RepoRoot: path.Join(dir, "root"), MnemonicSource: FileMnemonic(file), DbInit: db.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	expected, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, 4096, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(db.identityKey, expected) {
+		t.Error("Expected the identity to be derived from the mnemonic source")
+	}
+}
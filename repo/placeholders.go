@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path"
+)
+
+// placeholderImages are the profile images the node serves, with their size
+// at the tiny scale
+var placeholderImages = []struct {
+	name          string
+	width, height int
+}{
+	{"avatar", 60, 60},
+	{"header", 315, 90},
+}
+
+// imageScales are the image size directories and how many times the tiny size
+// their images are, as resized by the node. The original is kept at the large
+// size.
+var imageScales = []struct {
+	dir   string
+	scale int
+}{
+	{"tiny", 1},
+	{"small", 2},
+	{"medium", 4},
+	{"large", 8},
+	{"original", 8},
+}
+
+var placeholderColor = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+
+// writePlaceholderImages writes a plain JPEG for each placeholder image in
+// each size directory. Images already there are left alone.
+func writePlaceholderImages(repoRoot string) error {
+	for _, s := range imageScales {
+		for _, p := range placeholderImages {
+			name := path.Join(repoRoot, "root", "images", s.dir, p.name)
+			if _, err := os.Stat(name); err == nil {
+				continue
+			}
+			if err := writePlaceholderImage(name, p.width*s.scale, p.height*s.scale); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writePlaceholderImage(name string, width, height int) error {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{placeholderColor}, image.ZP, draw.Src)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"image/jpeg"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDoInitOptsPlaceholderImages(t *testing.T) {
+	defer TearDown()
+	opts := InitOptions{
+		RepoRoot:          repoRootFolder,
+		Testnet:           true,
+		Mnemonic:          mnemonicFixture,
+		DbInit:            MockDbInit,
+		PlaceholderImages: true,
+	}
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	for _, s := range imageScales {
+		for _, p := range placeholderImages {
+			name := path.Join(repoRootFolder, "root", "images", s.dir, p.name)
+			f, err := os.Open(name)
+			if err != nil {
+				t.Errorf("Expected a placeholder %s in %s: %s", p.name, s.dir, err)
+				continue
+			}
+			cfg, err := jpeg.DecodeConfig(f)
+			f.Close()
+			if err != nil {
+				t.Errorf("Expected the placeholder %s in %s to be a valid JPEG: %s", p.name, s.dir, err)
+				continue
+			}
+			if cfg.Width != p.width*s.scale || cfg.Height != p.height*s.scale {
+				t.Errorf("Expected the %s %s to be %dx%d, got %dx%d", s.dir, p.name, p.width*s.scale, p.height*s.scale, cfg.Width, cfg.Height)
+			}
+		}
+	}
+	TearDown()
+
+	opts.PlaceholderImages = false
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if _, err := os.Stat(path.Join(repoRootFolder, "root", "images", "tiny", "avatar")); !os.IsNotExist(err) {
+		t.Error("Expected no placeholders unless asked for")
+	}
+}
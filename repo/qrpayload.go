@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+var ErrInvalidMnemonicPayload = errors.New("Mnemonic payload is malformed")
+var ErrUnknownMnemonicPayloadVersion = errors.New("Mnemonic payload version is not supported")
+
+// A mnemonic payload is a version byte, a flags byte, the mnemonic's entropy
+// and, if mnemonicPayloadFingerprint is set, the fingerprint of the seed the
+// mnemonic and passphrase derive. The entropy is 16 to 32 bytes so version 1
+// payloads are at most 38 bytes, small enough for a low density QR code.
+const (
+	mnemonicPayloadVersion     byte = 1
+	mnemonicPayloadFingerprint byte = 1 << 0
+	seedFingerprintSize             = 4
+)
+
+// MnemonicPayload is a decoded mnemonic payload
+type MnemonicPayload struct {
+	Mnemonic string
+
+	// Fingerprint is the seed fingerprint, or empty if the payload has none
+	Fingerprint string
+}
+
+// CheckPassphrase reports whether passphrase derives the seed the payload's
+// fingerprint was made from. It is always true for payloads without one.
+func (p *MnemonicPayload) CheckPassphrase(passphrase string) bool {
+	if p.Fingerprint == "" {
+		return true
+	}
+	return seedFingerprint(bip39.NewSeed(normalizeMnemonic(p.Mnemonic), passphrase)) == p.Fingerprint
+}
+
+// seedFingerprint identifies a seed without revealing it, like a BIP32 key
+// fingerprint
+func seedFingerprint(seed []byte) string {
+	h := sha256.Sum256(seed)
+	return hex.EncodeToString(h[:4])
+}
+
+// EncodeMnemonicPayload encodes the mnemonic into a compact payload for a
+// companion app to scan as a QR code rather than have the user type it. If
+// withFingerprint is set the payload includes the fingerprint of the seed
+// derived with passphrase, so that the app can check the passphrase it is
+// given. The passphrase itself is never included.
+func EncodeMnemonicPayload(mnemonic string, passphrase string, withFingerprint bool) ([]byte, error) {
+	strength := AnalyzeMnemonic(mnemonic)
+	if strength.EntropyBits == 0 || !strength.ChecksumValid {
+		return nil, ErrInvalidMnemonic
+	}
+	words := strings.Fields(mnemonic)
+	entropy, _ := mnemonicToEntropy(words, strength.EntropyBits, englishWordlist)
+
+	b := []byte{mnemonicPayloadVersion, 0}
+	b = append(b, entropy...)
+	if withFingerprint {
+		b[1] |= mnemonicPayloadFingerprint
+		fingerprint, err := hex.DecodeString(seedFingerprint(bip39.NewSeed(normalizeMnemonic(mnemonic), passphrase)))
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, fingerprint...)
+	}
+	return b, nil
+}
+
+// DecodeMnemonicPayload decodes a payload made by EncodeMnemonicPayload
+func DecodeMnemonicPayload(b []byte) (*MnemonicPayload, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidMnemonicPayload
+	}
+	if b[0] != mnemonicPayloadVersion {
+		return nil, ErrUnknownMnemonicPayloadVersion
+	}
+	if len(b) < 2 || b[1]&^mnemonicPayloadFingerprint != 0 {
+		return nil, ErrInvalidMnemonicPayload
+	}
+	entropy := b[2:]
+	var fingerprint []byte
+	if b[1]&mnemonicPayloadFingerprint != 0 {
+		if len(entropy) < seedFingerprintSize {
+			return nil, ErrInvalidMnemonicPayload
+		}
+		fingerprint = entropy[len(entropy)-seedFingerprintSize:]
+		entropy = entropy[:len(entropy)-seedFingerprintSize]
+	}
+	if validateMnemonicEntropy(len(entropy)*8) != nil {
+		return nil, ErrInvalidMnemonicPayload
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return nil, ErrInvalidMnemonicPayload
+	}
+	return &MnemonicPayload{Mnemonic: mnemonic, Fingerprint: hex.EncodeToString(fingerprint)}, nil
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMnemonicPayload(t *testing.T) {
+	b, err := EncodeMnemonicPayload(mnemonicFixture, "", false)
+	if err != nil {
+		t.Fatal("EncodeMnemonicPayload threw an unexpected error", err)
+	}
+	if len(b) != 2+DefaultMnemonicEntropy/8 {
+		t.Errorf("Expected a %d byte payload, got %d", 2+DefaultMnemonicEntropy/8, len(b))
+	}
+	p, err := DecodeMnemonicPayload(b)
+	if err != nil {
+		t.Fatal("DecodeMnemonicPayload threw an unexpected error", err)
+	}
+	if p.Mnemonic != mnemonicFixture {
+		t.Errorf("Expected %q, got %q", mnemonicFixture, p.Mnemonic)
+	}
+	if p.Fingerprint != "" || !p.CheckPassphrase("anything") {
+		t.Error("Expected a payload without a fingerprint to accept any passphrase")
+	}
+
+	b, err = EncodeMnemonicPayload(mnemonicFixture, "secret", true)
+	if err != nil {
+		t.Fatal("EncodeMnemonicPayload threw an unexpected error", err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Error("Expected the passphrase not to be in the payload")
+	}
+	p, err = DecodeMnemonicPayload(b)
+	if err != nil {
+		t.Fatal("DecodeMnemonicPayload threw an unexpected error", err)
+	}
+	if p.Mnemonic != mnemonicFixture || p.Fingerprint == "" {
+		t.Errorf("Expected the mnemonic and a fingerprint, got %+v", p)
+	}
+	if !p.CheckPassphrase("secret") || p.CheckPassphrase("wrong") {
+		t.Error("Expected the fingerprint to only match the encoded passphrase")
+	}
+
+	if _, err := EncodeMnemonicPayload("abandon abandon abandon", "", false); err != ErrInvalidMnemonic {
+		t.Error("Expected ErrInvalidMnemonic, got ", err)
+	}
+}
+
+func TestDecodeMnemonicPayloadErrors(t *testing.T) {
+	b, err := EncodeMnemonicPayload(mnemonicFixture, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := append([]byte{}, b...)
+	unknown[0] = mnemonicPayloadVersion + 1
+	if _, err := DecodeMnemonicPayload(unknown); err != ErrUnknownMnemonicPayloadVersion {
+		t.Error("Expected ErrUnknownMnemonicPayloadVersion, got ", err)
+	}
+
+	for _, b := range [][]byte{nil, b[:1], b[:len(b)-1], {mnemonicPayloadVersion, 0x80}} {
+		if _, err := DecodeMnemonicPayload(b); err != ErrInvalidMnemonicPayload {
+			t.Errorf("Expected ErrInvalidMnemonicPayload for %x, got %v", b, err)
+		}
+	}
+}
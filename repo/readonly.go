@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
+	"github.com/ipfs/go-ipfs/namesys"
+	"github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+)
+
+var ErrPeerIDMismatch = errors.New("Identity key does not match the peer ID recorded in the repo")
+var ErrNoIdentity = errors.New("No identity key found for the repo")
+
+// RepoInspection describes a repo as loaded by OpenReadOnly
+type RepoInspection struct {
+	// PeerID is derived from the identity key
+	PeerID string
+
+	// ClaimedPeerIDs are the peer IDs recorded in the config and the peerid
+	// file, keyed by the path they were read from
+	ClaimedPeerIDs map[string]string
+
+	// ConfigDigest is the hex encoded SHA-256 of the config file as stored
+	ConfigDigest string
+}
+
+// OpenReadOnly loads the config and identity of a repo purely for inspection,
+// such as by an auditor confirming which node a repo belongs to. Nothing is
+// created or written and neither the IPFS repo nor its datastore is opened,
+// so it is safe to run against a repo in use by a node.
+//
+// The identity key is read from db, which the caller opens however it sees
+// fit, or from the config if db is nil. ErrPeerIDMismatch is returned along
+// with the inspection if the key doesn't match a recorded peer ID.
+func OpenReadOnly(repoRoot string, db Config) (*RepoInspection, error) {
+	configPath := path.Join(repoRoot, "config")
+	cfgBytes, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No initialized repo found at %s", repoRoot)
+	} else if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(cfgBytes)
+	conf := new(config.Config)
+	if err := json.Unmarshal(cfgBytes, conf); err != nil {
+		return nil, MalformedConfigError
+	}
+
+	inspection := &RepoInspection{
+		ClaimedPeerIDs: make(map[string]string),
+		ConfigDigest:   hex.EncodeToString(digest[:]),
+	}
+	if conf.Identity.PeerID != "" {
+		inspection.ClaimedPeerIDs[configPath] = conf.Identity.PeerID
+	}
+	peerIDPath := path.Join(repoRoot, peerIDFile)
+	if b, err := ioutil.ReadFile(peerIDPath); err == nil {
+		inspection.ClaimedPeerIDs[peerIDPath] = strings.TrimSpace(string(b))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var identityKey []byte
+	if db != nil {
+		identityKey, err = db.GetIdentityKey()
+		if err != nil {
+			return nil, err
+		}
+	} else if conf.Identity.PrivKey != "" {
+		identityKey, err = base64.StdEncoding.DecodeString(conf.Identity.PrivKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(identityKey) == 0 {
+		return inspection, ErrNoIdentity
+	}
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		return nil, err
+	}
+	inspection.PeerID = identity.PeerID
+	for _, claimed := range inspection.ClaimedPeerIDs {
+		if claimed != identity.PeerID {
+			return inspection, ErrPeerIDMismatch
+		}
+	}
+	return inspection, nil
+}
+
+// VerifyMnemonicMatchesRepo reports whether mnemonic and passphrase derive the
+// identity of the repo at repoRoot, so a recovery phrase can be confirmed
+// before a destructive reinit. The mnemonic is checked against the wordlist
+// recorded in the config. The identity key is kept in the database, which
+// may be encrypted, so the derived peer ID is compared to the peer IDs
+// recorded in the config and the peerid file or, if there are none, looked up
+// in the IPNS record that init publishes to the datastore. The latter needs
+// the node to be stopped.
+func VerifyMnemonicMatchesRepo(repoRoot, mnemonic, passphrase string) (bool, error) {
+	wl, err := repoWordlist(repoRoot)
+	if err != nil {
+		return false, err
+	}
+	if err := validateMnemonicWords(mnemonic, wl); err != nil {
+		return false, err
+	}
+	identityKey, err := identityKeyFromMnemonic(mnemonic, passphrase, Ed25519KeypairBits, 0)
+	if err != nil {
+		return false, err
+	}
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		return false, err
+	}
+	return peerIDMatchesRepo(repoRoot, identity.PeerID)
+}
+
+// peerIDMatchesRepo reports whether peerID is the identity of the repo at
+// repoRoot, as VerifyMnemonicMatchesRepo looks it up
+func peerIDMatchesRepo(repoRoot, peerID string) (bool, error) {
+	inspection, err := OpenReadOnly(repoRoot, nil)
+	if err != nil && err != ErrNoIdentity && err != ErrPeerIDMismatch {
+		return false, err
+	}
+	if len(inspection.ClaimedPeerIDs) > 0 {
+		for _, claimed := range inspection.ClaimedPeerIDs {
+			if claimed != peerID {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	return hasIPNSRecord(repoRoot, peerID)
+}
+
+// hasIPNSRecord reports whether the datastore of the repo at repoRoot holds an
+// IPNS record for peerID. The repo is opened, so the node must be stopped.
+func hasIPNSRecord(repoRoot, peerID string) (bool, error) {
+	id, err := peer.IDB58Decode(peerID)
+	if err != nil {
+		return false, err
+	}
+	_, ipnsKey := namesys.IpnsKeysForID(id)
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return r.Datastore().Has(dshelp.NewKeyFromBinary([]byte(ipnsKey)))
+}
@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// snapshotTree records the name, size, mode and modification time of every
+// file under root
+func snapshotTree(t *testing.T, root string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		files[p] = fmt.Sprintf("%s %d %s", fi.Mode(), fi.Size(), fi.ModTime())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := &mockConfig{}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		CreationDate:    time.Now(),
+		DbInit:          db.Init,
+		Progress:        func(string) {},
+		WritePeerID:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := snapshotTree(t, dir)
+
+	inspection, err := OpenReadOnly(dir, db)
+	if err != nil {
+		t.Fatal("OpenReadOnly threw an unexpected error", err)
+	}
+	if inspection.PeerID != res.PeerID {
+		t.Errorf("Expected peer ID %s, got %s", res.PeerID, inspection.PeerID)
+	}
+	cfgBytes, err := ioutil.ReadFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(cfgBytes)
+	if inspection.ConfigDigest != hex.EncodeToString(digest[:]) {
+		t.Error("Config digest does not match the config file")
+	}
+	if claimed := inspection.ClaimedPeerIDs[filepath.Join(dir, peerIDFile)]; claimed != res.PeerID {
+		t.Errorf("Expected the peerid file to claim %s, got %s", res.PeerID, claimed)
+	}
+	if after := snapshotTree(t, dir); !reflect.DeepEqual(before, after) {
+		t.Error("OpenReadOnly modified the repo")
+	}
+
+	// A key belonging to another node
+	other := &mockConfig{}
+	if err := other.Init("", identityKeyFixture(t), "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenReadOnly(dir, other); err != ErrPeerIDMismatch {
+		t.Error("Expected ErrPeerIDMismatch, got ", err)
+	}
+
+	if _, err := OpenReadOnly(filepath.Join(dir, "missing"), db); err == nil {
+		t.Error("OpenReadOnly didn't throw an error for a missing repo")
+	}
+	if after := snapshotTree(t, dir); !reflect.DeepEqual(before, after) {
+		t.Error("OpenReadOnly modified the repo")
+	}
+}
+
+func identityKeyFixture(t *testing.T) []byte {
+	key, err := identityKeyFromMnemonic(mnemonicFixture, DefaultSeedPassphrase, 4096, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyMnemonicMatchesRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	otherMnemonic, err := bip39.NewMnemonic(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, writePeerID := range []bool{false, true} {
+		root := filepath.Join(dir, fmt.Sprint(writePeerID))
+		_, err := DoInitOptsResult(context.Background(), InitOptions{
+			RepoRoot:        root,
+			NBitsForKeypair: 4096,
+			Testnet:         true,
+			Password:        "password",
+			Mnemonic:        mnemonicFixture,
+			CreationDate:    time.Now(),
+			DbInit:          MockDbInit,
+			Progress:        func(string) {},
+			WritePeerID:     writePeerID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match, err := VerifyMnemonicMatchesRepo(root, mnemonicFixture, DefaultSeedPassphrase); err != nil || !match {
+			t.Errorf("Expected the mnemonic to match with the peerid file written %t, got %t, %v", writePeerID, match, err)
+		}
+		if match, err := VerifyMnemonicMatchesRepo(root, otherMnemonic, DefaultSeedPassphrase); err != nil || match {
+			t.Errorf("Expected another mnemonic not to match with the peerid file written %t, got %t, %v", writePeerID, match, err)
+		}
+		if match, err := VerifyMnemonicMatchesRepo(root, mnemonicFixture, "other passphrase"); err != nil || match {
+			t.Errorf("Expected another passphrase not to match with the peerid file written %t, got %t, %v", writePeerID, match, err)
+		}
+	}
+}
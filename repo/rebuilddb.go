@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+var ErrDatabaseExists = errors.New("Database exists. Force the rebuild to replace it.")
+var ErrNetworkMismatch = errors.New("The repo was initialized for the other network")
+
+// RebuildDatabase re-runs only the database step of init, for a repo whose
+// IPFS repo is intact but whose database was lost. The database held the only
+// copy of the mnemonic so it has to be supplied, and with passphrase and
+// accountIndex it must derive the repo's identity or ErrPeerIDMismatch is
+// returned. The account index isn't stored, so it is the one the node was
+// initialized with. testnet selects the database to rebuild and must agree
+// with the config if the config records the network. The creation date and
+// mnemonic language are read back from the config. Configs written before the
+// creation date was recorded get a zero creation date, so the wallet rescans
+// from the oldest checkpoint. The node must be stopped.
+//
+// A database that exists and isn't empty is left alone with ErrDatabaseExists
+// unless force is set, in which case it is copied to a new backup directory
+// under repoRoot/backups first. The backup directory is returned.
+func RebuildDatabase(repoRoot string, mnemonic string, passphrase string, password string, testnet bool, accountIndex uint32, force bool, dbInit func(string, []byte, string, time.Time) error) (string, error) {
+	if !fsrepo.IsInitialized(repoRoot) {
+		return "", fmt.Errorf("No initialized repo found at %s", repoRoot)
+	}
+	wl, err := repoWordlist(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	mnemonic = normalizeMnemonic(mnemonic)
+	if err := validateMnemonicWords(mnemonic, wl); err != nil {
+		return "", err
+	}
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		return "", err
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return "", MalformedConfigError
+	}
+	var creationDate time.Time
+	if _, ok := cfg["CreationDate"]; ok {
+		if creationDate, err = GetCreationDate(repoRoot); err != nil {
+			return "", err
+		}
+	}
+	if _, ok := cfg["Testnet"]; ok {
+		recorded, err := IsTestnet(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		if recorded != testnet {
+			return "", ErrNetworkMismatch
+		}
+	}
+
+	identityKey, err := identityKeyFromMnemonic(mnemonic, passphrase, Ed25519KeypairBits, accountIndex)
+	if err != nil {
+		return "", wrapError(ErrKeyGeneration, err)
+	}
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		return "", wrapError(ErrKeyGeneration, err)
+	}
+	match, err := peerIDMatchesRepo(repoRoot, identity.PeerID)
+	if err != nil {
+		return "", err
+	}
+	if !match {
+		return "", ErrPeerIDMismatch
+	}
+
+	dbName := "mainnet.db"
+	if testnet {
+		dbName = "testnet.db"
+	}
+	backupDir := ""
+	if fi, err := os.Stat(path.Join(repoRoot, "datastore", dbName)); err == nil && fi.Size() > 0 {
+		if !force {
+			return "", ErrDatabaseExists
+		}
+		if backupDir, err = newBackupDir(repoRoot, time.Now()); err != nil {
+			return "", err
+		}
+		if err := copyDatabases(repoRoot, backupDir); err != nil {
+			return "", err
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if err := dbInit(mnemonic, identityKey, password, creationDate); err != nil {
+		return backupDir, wrapError(ErrDatabaseInit, err)
+	}
+	return backupDir, nil
+}
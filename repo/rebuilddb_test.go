@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRebuildDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-rebuild-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	creationDate := time.Date(2019, 3, 14, 15, 9, 26, 0, time.UTC)
+	first := &recordingConfig{}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    creationDate,
+		DbInit:          first.Init,
+		WritePeerID:     true,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+
+	if _, err := RebuildDatabase(dir, "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", DefaultSeedPassphrase, "password", true, 0, false, MockDbInit); err != ErrPeerIDMismatch {
+		t.Error("Expected ErrPeerIDMismatch for another identity's mnemonic, got ", err)
+	}
+
+	// The database is missing since MockDbInit doesn't write one
+	rebuilt := &recordingConfig{}
+	backupDir, err := RebuildDatabase(dir, mnemonicFixture, DefaultSeedPassphrase, "password", true, 0, false, rebuilt.Init)
+	if err != nil {
+		t.Fatal("RebuildDatabase threw an unexpected error", err)
+	}
+	if backupDir != "" {
+		t.Error("Expected no backup without a database")
+	}
+	if rebuilt.mnemonic != mnemonicFixture || string(rebuilt.identityKey) != string(res.IdentityKey) {
+		t.Error("Expected the database to be rebuilt with the repo's identity")
+	}
+	if !rebuilt.creationDate.Equal(creationDate) {
+		t.Errorf("Expected the creation date %s from the config, got %s", creationDate, rebuilt.creationDate)
+	}
+
+	dbPath := path.Join(dir, "datastore", "testnet.db")
+	if err := ioutil.WriteFile(dbPath, []byte("healthy"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	untouched := &recordingConfig{}
+	if _, err := RebuildDatabase(dir, mnemonicFixture, DefaultSeedPassphrase, "password", true, 0, false, untouched.Init); err != ErrDatabaseExists {
+		t.Error("Expected ErrDatabaseExists for an existing database, got ", err)
+	}
+	if untouched.identityKey != nil {
+		t.Error("Expected an existing database to be left alone")
+	}
+
+	forced := &recordingConfig{}
+	backupDir, err = RebuildDatabase(dir, mnemonicFixture, DefaultSeedPassphrase, "password", true, 0, true, forced.Init)
+	if err != nil {
+		t.Fatal("RebuildDatabase threw an unexpected error", err)
+	}
+	if forced.identityKey == nil {
+		t.Error("Expected a forced rebuild to replace the database")
+	}
+	if b, err := ioutil.ReadFile(path.Join(backupDir, "testnet.db")); err != nil || string(b) != "healthy" {
+		t.Error("Expected the replaced database to be backed up")
+	}
+}
+
+func TestRebuildDatabaseLegacyConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-rebuild-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	first := &recordingConfig{}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:     dir,
+		Testnet:      true,
+		Password:     "password",
+		Mnemonic:     mnemonicFixture,
+		AccountIndex: 1,
+		CreationDate: time.Now(),
+		DbInit:       first.Init,
+		WritePeerID:  true,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	// Configs written before the creation date and network were recorded
+	configPath := path.Join(dir, "config")
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	delete(cfg, "CreationDate")
+	delete(cfg, "Testnet")
+	if b, err = json.MarshalIndent(cfg, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RebuildDatabase(dir, mnemonicFixture, DefaultSeedPassphrase, "password", true, 0, false, MockDbInit); err != ErrPeerIDMismatch {
+		t.Error("Expected ErrPeerIDMismatch for another account index, got ", err)
+	}
+	rebuilt := &recordingConfig{}
+	if _, err := RebuildDatabase(dir, mnemonicFixture, DefaultSeedPassphrase, "password", true, 1, false, rebuilt.Init); err != nil {
+		t.Fatal("RebuildDatabase threw an unexpected error", err)
+	}
+	if string(rebuilt.identityKey) != string(res.IdentityKey) {
+		t.Error("Expected the database to be rebuilt with the account's identity")
+	}
+	if !rebuilt.creationDate.IsZero() {
+		t.Error("Expected a zero creation date without one in the config, got ", rebuilt.creationDate)
+	}
+}
+
+func TestRebuildDatabaseNetworkMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-rebuild-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := DoInit(dir, 4096, true, "password", mnemonicFixture, time.Now(), MockDbInit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RebuildDatabase(dir, mnemonicFixture, DefaultSeedPassphrase, "password", false, 0, false, MockDbInit); err != ErrNetworkMismatch {
+		t.Error("Expected ErrNetworkMismatch, got ", err)
+	}
+}
@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"time"
+)
+
+var ErrInvalidRecoveryKit = errors.New("Recovery kit could not be decrypted. Check the password.")
+
+// recoveryKitVersion is the version byte of a recovery kit, which otherwise
+// uses the mnemonic backup format
+const recoveryKitVersion byte = 2
+
+// RecoveryKit bundles what restoring a node takes besides its mnemonic. The
+// identity key covers the keypair size, seed passphrase and account index the
+// node was derived with, and the creation date bounds the wallet rescan.
+type RecoveryKit struct {
+	Mnemonic         string
+	MnemonicLanguage string
+	IdentityKey      []byte
+	CreationDate     time.Time
+	Testnet          bool
+	WalletType       string
+}
+
+// ExportRecoveryKit writes the recovery kit of the repo at repoRoot, whose
+// database is db, to kitFile encrypted with password. The file is only
+// readable by its owner.
+func ExportRecoveryKit(repoRoot string, db Config, kitFile string, password string) error {
+	if password == "" {
+		return ErrMnemonicBackupPassword
+	}
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		return err
+	}
+	kit := RecoveryKit{}
+	if kit.Mnemonic, err = db.GetMnemonic(); err != nil {
+		return err
+	}
+	if kit.IdentityKey, err = db.GetIdentityKey(); err != nil {
+		return err
+	}
+	if len(kit.IdentityKey) == 0 {
+		return ErrNoIdentity
+	}
+	if kit.CreationDate, err = db.GetCreationDate(); err != nil {
+		return err
+	}
+	if kit.MnemonicLanguage, err = GetMnemonicLanguage(cfgBytes); err != nil {
+		return err
+	}
+	if kit.Testnet, err = detectTestnet(repoRoot); err != nil {
+		return err
+	}
+	wallet, err := GetWalletConfig(cfgBytes)
+	if err != nil {
+		return err
+	}
+	kit.WalletType = wallet.Type
+
+	plaintext, err := json.Marshal(kit)
+	if err != nil {
+		return err
+	}
+	b, err := encryptBackup(recoveryKitVersion, plaintext, password)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(kitFile, b, 0600)
+}
+
+// ReadRecoveryKit returns the recovery kit stored in kitFile
+func ReadRecoveryKit(kitFile string, password string) (*RecoveryKit, error) {
+	b, err := ioutil.ReadFile(kitFile)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decryptBackup(recoveryKitVersion, b, password)
+	if err != nil {
+		return nil, ErrInvalidRecoveryKit
+	}
+	kit := new(RecoveryKit)
+	if err := json.Unmarshal(plaintext, kit); err != nil {
+		return nil, ErrInvalidRecoveryKit
+	}
+	return kit, nil
+}
+
+// DoInitFromRecoveryKit initializes the repo with the identity, creation date,
+// network and wallet type stored in a recovery kit. The kit is decrypted with
+// password, which is also used to encrypt the database. A wallet type set in
+// overrides takes precedence over the kit's.
+func DoInitFromRecoveryKit(repoRoot string, kitFile string, password string, overrides *ConfigOverrides, dbInit func(string, []byte, string, time.Time) error) (*InitResult, error) {
+	kit, err := ReadRecoveryKit(kitFile, password)
+	if err != nil {
+		return nil, err
+	}
+	if len(kit.IdentityKey) == 0 {
+		return nil, ErrInvalidIdentityKey
+	}
+	o := ConfigOverrides{}
+	if overrides != nil {
+		o = *overrides
+	}
+	w := WalletConfig{}
+	if o.Wallet != nil {
+		w = *o.Wallet
+	}
+	if w.Type == "" {
+		w.Type = kit.WalletType
+	}
+	o.Wallet = &w
+	return doInit(context.Background(), InitOptions{
+		RepoRoot:         repoRoot,
+		NBitsForKeypair:  Ed25519KeypairBits,
+		Testnet:          kit.Testnet,
+		Password:         password,
+		Mnemonic:         kit.Mnemonic,
+		MnemonicEntropy:  DefaultMnemonicEntropy,
+		MnemonicLanguage: kit.MnemonicLanguage,
+		Passphrase:       DefaultSeedPassphrase,
+		IdentityKey:      kit.IdentityKey,
+		CreationDate:     kit.CreationDate,
+		Overrides:        &o,
+		DbInit:           dbInit,
+	})
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// recordingConfig is a database that keeps what init stored in it
+type recordingConfig struct {
+	mnemonic     string
+	identityKey  []byte
+	creationDate time.Time
+}
+
+func (r *recordingConfig) Init(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+	r.mnemonic, r.identityKey, r.creationDate = mnemonic, identityKey, creationDate
+	return nil
+}
+func (r *recordingConfig) GetMnemonic() (string, error)        { return r.mnemonic, nil }
+func (r *recordingConfig) GetIdentityKey() ([]byte, error)     { return r.identityKey, nil }
+func (r *recordingConfig) GetCreationDate() (time.Time, error) { return r.creationDate, nil }
+func (r *recordingConfig) IsEncrypted() bool                   { return false }
+
+func TestRecoveryKitRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-recovery-kit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	original, restored := path.Join(dir, "original"), path.Join(dir, "restored")
+	kitFile := path.Join(dir, "kit")
+
+	db := &recordingConfig{}
+	creationDate := time.Date(2019, 3, 14, 15, 9, 26, 0, time.UTC)
+	overrides := &ConfigOverrides{Wallet: &WalletConfig{Type: "bitcoind"}}
+	first, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        original,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Passphrase:      "Secret Passphrase",
+		CreationDate:    creationDate,
+		Overrides:       overrides,
+		DbInit:          db.Init,
+	})
+	if err != nil {
+		t.Fatalf("DoInitOptsResult threw an unexpected error: %s", err.Error())
+	}
+	if err := ExportRecoveryKit(original, db, kitFile, "password"); err != nil {
+		t.Fatal("ExportRecoveryKit threw an unexpected error", err)
+	}
+	fi, err := os.Stat(kitFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected the kit to only be readable by its owner, got %s", fi.Mode())
+	}
+
+	if _, err := DoInitFromRecoveryKit(restored, kitFile, "wrong", nil, MockDbInit); err != ErrInvalidRecoveryKit {
+		t.Error("Expected ErrInvalidRecoveryKit for the wrong password, got ", err)
+	}
+	restoredDB := &recordingConfig{}
+	second, err := DoInitFromRecoveryKit(restored, kitFile, "password", nil, restoredDB.Init)
+	if err != nil {
+		t.Fatal("DoInitFromRecoveryKit threw an unexpected error", err)
+	}
+	// The identity was derived with a passphrase the mnemonic alone doesn't
+	// carry, so the same peer ID shows the kit's key was used
+	if second.PeerID != first.PeerID {
+		t.Errorf("Expected peer ID %s, got %s", first.PeerID, second.PeerID)
+	}
+	if restoredDB.mnemonic != db.mnemonic {
+		t.Error("Expected the mnemonic to be restored")
+	}
+	if !restoredDB.creationDate.Equal(creationDate) {
+		t.Errorf("Expected creation date %s, got %s", creationDate, restoredDB.creationDate)
+	}
+	testnet, err := IsTestnet(restored)
+	if err != nil || !testnet {
+		t.Error("Expected the restored repo to be on testnet", err)
+	}
+	cfgBytes, err := ioutil.ReadFile(path.Join(restored, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := GetWalletConfig(cfgBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Type != "bitcoind" {
+		t.Error("Expected the wallet type to be restored, got ", wallet.Type)
+	}
+}
+
+func TestExportRecoveryKitRequiresPassword(t *testing.T) {
+	if err := ExportRecoveryKit(repoRootFolder, &recordingConfig{}, path.Join(os.TempDir(), "kit"), ""); err != ErrMnemonicBackupPassword {
+		t.Error("Expected ErrMnemonicBackupPassword, got ", err)
+	}
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// RepoPathEnv names the environment variable that overrides the default repo
+// location on every platform
+const RepoPathEnv = "OPENBAZAAR_REPO_PATH"
+
+// DefaultRepoPath returns the conventional location of the mainnet repo on
+// this platform. See defaultRepoPath for how it is chosen.
+func DefaultRepoPath() (string, error) {
+	return defaultRepoPathFor(false)
+}
+
+// DefaultTestnetRepoPath returns the conventional location of the testnet repo
+// on this platform
+func DefaultTestnetRepoPath() (string, error) {
+	return defaultRepoPathFor(true)
+}
+
+func defaultRepoPathFor(testnet bool) (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return defaultRepoPath(runtime.GOOS, home, os.Getenv, testnet), nil
+}
+
+// defaultRepoPath returns the path in RepoPathEnv if it is set. Otherwise it
+// is the location the daemon has always used: ~/.openbazaar2.0 on Linux,
+// ~/Library/Application Support/OpenBazaar2.0 on macOS and ~/OpenBazaar2.0
+// elsewhere. Data directories such as $XDG_DATA_HOME or %APPDATA% are only
+// used when set through RepoPathEnv, so existing installs keep finding their
+// repo.
+//
+// A -testnet suffix is added for the testnet repo, also to the path in
+// RepoPathEnv so that the mainnet and testnet repos never share a directory.
+func defaultRepoPath(goos, home string, getenv func(string) string, testnet bool) string {
+	suffix := ""
+	if testnet {
+		suffix = "-testnet"
+	}
+	if p := getenv(RepoPathEnv); p != "" {
+		return filepath.Clean(p) + suffix
+	}
+	switch goos {
+	case "linux":
+		return filepath.Join(home, ".openbazaar2.0"+suffix)
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "OpenBazaar2.0"+suffix)
+	default:
+		return filepath.Join(home, "OpenBazaar2.0"+suffix)
+	}
+}
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fakeEnv(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestDefaultRepoPath(t *testing.T) {
+	home, err := ioutil.TempDir("", "ob-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	tests := []struct {
+		name    string
+		goos    string
+		env     map[string]string
+		testnet bool
+		want    string
+	}{
+		{"linux", "linux", nil, false, filepath.Join(home, ".openbazaar2.0")},
+		{"linux testnet", "linux", nil, true, filepath.Join(home, ".openbazaar2.0-testnet")},
+		{"linux ignores XDG", "linux", map[string]string{"XDG_DATA_HOME": "/data"}, false, filepath.Join(home, ".openbazaar2.0")},
+		{"freebsd", "freebsd", nil, true, filepath.Join(home, "OpenBazaar2.0-testnet")},
+		{"windows", "windows", nil, false, filepath.Join(home, "OpenBazaar2.0")},
+		{"windows ignores AppData", "windows", map[string]string{"APPDATA": "/AppData/Roaming"}, false, filepath.Join(home, "OpenBazaar2.0")},
+		{"macOS", "darwin", nil, false, filepath.Join(home, "Library", "Application Support", "OpenBazaar2.0")},
+		{"macOS testnet", "darwin", nil, true, filepath.Join(home, "Library", "Application Support", "OpenBazaar2.0-testnet")},
+		{"override", "linux", map[string]string{RepoPathEnv: "/srv/ob/"}, false, "/srv/ob"},
+		{"override testnet", "linux", map[string]string{RepoPathEnv: "/srv/ob/"}, true, "/srv/ob-testnet"},
+		{"override XDG", "linux", map[string]string{RepoPathEnv: "/data/openbazaar2.0", "XDG_DATA_HOME": "/data"}, false, "/data/openbazaar2.0"},
+		{"override windows", "windows", map[string]string{RepoPathEnv: "/AppData/OpenBazaar2.0", "APPDATA": "/AppData"}, false, "/AppData/OpenBazaar2.0"},
+	}
+	for _, test := range tests {
+		if got := defaultRepoPath(test.goos, home, fakeEnv(test.env), test.testnet); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestDefaultRepoPathEnv(t *testing.T) {
+	defer os.Setenv(RepoPathEnv, os.Getenv(RepoPathEnv))
+	os.Setenv(RepoPathEnv, "/srv/openbazaar")
+	p, err := DefaultRepoPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/srv/openbazaar" {
+		t.Error("Expected the environment override, got ", p)
+	}
+	p, err = DefaultTestnetRepoPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/srv/openbazaar-testnet" {
+		t.Error("Expected the environment override with the testnet suffix, got ", p)
+	}
+}
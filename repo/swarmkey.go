@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path"
+
+	pnet "gx/ipfs/QmTJoXQ24GqDf9MqAUwf3vW38HG6ahE9S7GzZoRMEeE8Kc/go-libp2p-pnet"
+)
+
+var ErrInvalidSwarmKey = errors.New("Swarm key must be a /key/swarm/psk/1.0.0/ pre-shared key")
+
+// swarmKeyFile is read by the IPFS repo for the pre-shared key of a private
+// network. A node with one only connects to peers with the same key.
+const swarmKeyFile = "swarm.key"
+
+// GenerateSwarmKey returns a new random pre-shared key for a private network
+// in the format of a swarm.key file. Every node of the network is initialized
+// with the same key.
+func GenerateSwarmKey() ([]byte, error) {
+	psk := make([]byte, 32)
+	if _, err := rand.Read(psk); err != nil {
+		return nil, err
+	}
+	return []byte("/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(psk) + "\n"), nil
+}
+
+// validateSwarmKey checks that key decodes the way the node will decode it
+// when it starts
+func validateSwarmKey(key []byte) error {
+	if _, err := pnet.NewProtector(bytes.NewReader(key)); err != nil {
+		return wrapError(ErrInvalidSwarmKey, err)
+	}
+	return nil
+}
+
+// writeSwarmKey writes the pre-shared key to the repo, readable only by its
+// owner as anyone holding it can join the network
+func writeSwarmKey(repoRoot string, key []byte) error {
+	return ioutil.WriteFile(path.Join(repoRoot, swarmKeyFile), key, 0600)
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+var swarmKeyFormat = regexp.MustCompile(`^/key/swarm/psk/1\.0\.0/\n/base16/\n[0-9a-f]{64}\n$`)
+
+func TestDoInitOptsSwarmKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-swarmkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := GenerateSwarmKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := InitOptions{
+		RepoRoot: dir,
+		Testnet:  true,
+		Mnemonic: mnemonicFixture,
+		DbInit:   MockDbInit,
+		SwarmKey: key,
+	}
+	if err := DoInitOpts(opts); err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	p := path.Join(dir, swarmKeyFile)
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal("Expected a swarm.key to be written: ", err)
+	}
+	if !swarmKeyFormat.Match(b) {
+		t.Errorf("Expected a base16 pre-shared key, got %q", b)
+	}
+	if fi, err := os.Stat(p); err == nil && fi.Mode().Perm()&0077 != 0 {
+		t.Errorf("Expected the swarm key to be readable by its owner only, got %s", fi.Mode())
+	}
+
+	cfgBytes, err := ioutil.ReadFile(path.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct{ Bootstrap []string }
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Bootstrap) != 0 {
+		t.Error("Expected no public bootstrap peers on a private network, got ", cfg.Bootstrap)
+	}
+}
+
+func TestDoInitOptsMalformedSwarmKey(t *testing.T) {
+	defer TearDown()
+	for _, key := range []string{
+		"not a swarm key",
+		"/key/swarm/psk/1.0.0/\n/base16/\nabcdef\n",
+	} {
+		opts := InitOptions{
+			RepoRoot: repoRootFolder,
+			Testnet:  true,
+			Mnemonic: mnemonicFixture,
+			DbInit:   MockDbInit,
+			SwarmKey: []byte(key),
+		}
+		if err := DoInitOpts(opts); !isError(err, ErrInvalidSwarmKey) {
+			t.Errorf("Expected ErrInvalidSwarmKey for %q, got %v", key, err)
+		}
+		if fsrepo.IsInitialized(repoRootFolder) {
+			t.Fatal("Expected a malformed swarm key to be rejected before the repo is initialized")
+		}
+	}
+}
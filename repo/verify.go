@@ -0,0 +1,205 @@
+package repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+)
+
+// Checks run by VerifyRepo
+const (
+	CheckInitialized = "initialized"
+	CheckDirectories = "directories"
+	CheckConfig      = "config"
+	CheckIdentity    = "identity"
+	CheckKeyspace    = "keyspace"
+)
+
+// Problem is an inconsistency found by VerifyRepo
+type Problem struct {
+	Check   string
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s (%s)", p.Check, p.Message, p.Path)
+}
+
+// VerifyRepo checks that a repo is consistent enough for the node to start
+// without starting it or modifying anything. All problems found are returned
+// rather than only the first. The error is only set if the checks themselves
+// could not run.
+//
+// The identity key is read from db, which the caller opens however it sees
+// fit, and its peer ID is checked against the peer IDs recorded in the repo
+// and the IPNS record init publishes to the datastore. If db is nil the
+// record is looked up for the peer ID in the peerid file. The datastore can
+// only be read while the node is stopped.
+func VerifyRepo(repoRoot string, db Config) ([]Problem, error) {
+	var problems []Problem
+	configPath := path.Join(repoRoot, "config")
+	if !fsrepo.IsInitialized(repoRoot) {
+		problems = append(problems, Problem{CheckInitialized, configPath, "Repo is not initialized"})
+		return problems, nil
+	}
+
+	for _, dir := range obDirectories {
+		p := path.Join(repoRoot, dir)
+		fi, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			problems = append(problems, Problem{CheckDirectories, p, "Directory is missing"})
+		} else if err != nil {
+			return nil, err
+		} else if !fi.IsDir() {
+			problems = append(problems, Problem{CheckDirectories, p, "Path is not a directory"})
+		}
+	}
+
+	cfgBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := fsrepo.ConfigAt(repoRoot)
+	if err != nil {
+		problems = append(problems, Problem{CheckConfig, configPath, "IPFS config can't be parsed: " + err.Error()})
+	}
+	for _, section := range configSections {
+		if err := section.parse(cfgBytes); err != nil {
+			problems = append(problems, Problem{CheckConfig, configPath, section.name + " section is malformed"})
+		}
+	}
+
+	peerID := ""
+	if db != nil {
+		peerID, problems = verifyDatabaseIdentity(repoRoot, db, problems)
+	}
+	if conf != nil && peerID != "" && conf.Identity.PeerID != "" && conf.Identity.PeerID != peerID {
+		problems = append(problems, Problem{CheckIdentity, configPath, "Peer ID does not match the identity key"})
+	}
+	peerIDPath := path.Join(repoRoot, peerIDFile)
+	if b, err := ioutil.ReadFile(peerIDPath); err == nil {
+		recorded := strings.TrimSpace(string(b))
+		if _, err := peer.IDB58Decode(recorded); err != nil {
+			problems = append(problems, Problem{CheckIdentity, peerIDPath, "Peer ID is malformed"})
+		} else if peerID == "" && db == nil {
+			peerID = recorded
+		} else if peerID != "" && recorded != peerID {
+			problems = append(problems, Problem{CheckIdentity, peerIDPath, "Peer ID does not match the identity key"})
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// The IPNS record written at init lives in the datastore
+	datastorePath := path.Join(repoRoot, "datastore")
+	entries, err := ioutil.ReadDir(datastorePath)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		problems = append(problems, Problem{CheckKeyspace, datastorePath, "Datastore holding the IPNS keyspace is missing"})
+		return problems, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// The repo can't be opened to read the record if its IPFS config is broken
+	if peerID != "" && conf != nil {
+		found, err := hasIPNSRecord(repoRoot, peerID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			problems = append(problems, Problem{CheckKeyspace, datastorePath, "Datastore holds no IPNS record for " + peerID})
+		}
+	}
+	return problems, nil
+}
+
+// verifyDatabaseIdentity derives the peer ID of the identity key in db
+func verifyDatabaseIdentity(repoRoot string, db Config, problems []Problem) (string, []Problem) {
+	identityKey, err := db.GetIdentityKey()
+	if err != nil {
+		return "", append(problems, Problem{CheckIdentity, repoRoot, "Identity key can't be read from the database: " + err.Error()})
+	}
+	if len(identityKey) == 0 {
+		return "", append(problems, Problem{CheckIdentity, repoRoot, "Database holds no identity key"})
+	}
+	identity, err := ipfs.IdentityFromKey(identityKey)
+	if err != nil {
+		return "", append(problems, Problem{CheckIdentity, repoRoot, "Identity can't be derived from the key: " + err.Error()})
+	}
+	return identity.PeerID, problems
+}
+
+// Repair is an action taken by RepairDirectories
+type Repair struct {
+	Path   string
+	Action string
+}
+
+func (r Repair) String() string {
+	return fmt.Sprintf("%s (%s)", r.Action, r.Path)
+}
+
+// RepairDirectories fixes OpenBazaar directories that were damaged outside of
+// the node, such as by restoring a backup, and returns each repair made. A
+// file where a directory belongs is moved aside rather than deleted, and a
+// directory others can write to has their write permission removed unless the
+// DirectoryPermissions policy the repo was initialized with grants it. Missing
+// directories are created with the mode that policy gives them.
+func RepairDirectories(repoRoot string) ([]Repair, error) {
+	var repairs []Repair
+	var modes map[string]os.FileMode
+	if cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config")); err == nil {
+		if modes, err = getDirectoryModes(cfgBytes); err != nil {
+			return repairs, err
+		}
+	} else if !os.IsNotExist(err) {
+		return repairs, err
+	}
+	for _, dir := range obDirectories {
+		expected, ok := modes[dir]
+		if !ok {
+			expected = DefaultDirectoryMode
+		}
+		p := path.Join(repoRoot, dir)
+		fi, err := os.Stat(p)
+		if err != nil && !os.IsNotExist(err) {
+			return repairs, err
+		}
+		if err == nil && !fi.IsDir() {
+			aside := fmt.Sprintf("%s.%d.bak", p, time.Now().Unix())
+			if err := os.Rename(p, aside); err != nil {
+				return repairs, err
+			}
+			repairs = append(repairs, Repair{p, "Moved file in the way of the directory to " + aside})
+			err = os.ErrNotExist
+		}
+		if err != nil {
+			if err := os.Mkdir(p, expected); err != nil {
+				return repairs, err
+			}
+			// Mkdir is subject to the umask, so set the mode explicitly
+			if err := os.Chmod(p, expected); err != nil {
+				return repairs, err
+			}
+			repairs = append(repairs, Repair{p, "Created missing directory"})
+			continue
+		}
+		// Windows has no permission bits to repair
+		if writable := fi.Mode().Perm() & 0022 &^ expected; runtime.GOOS != "windows" && writable != 0 {
+			mode := fi.Mode().Perm() &^ writable
+			if err := os.Chmod(p, mode); err != nil {
+				return repairs, err
+			}
+			repairs = append(repairs, Repair{p, fmt.Sprintf("Removed write permission for others, mode %s is now %s", fi.Mode().Perm(), mode)})
+		}
+	}
+	return repairs, nil
+}
@@ -0,0 +1,220 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func initVerifyRepo(t *testing.T) (string, *mockConfig) {
+	dir, err := ioutil.TempDir("", "ob-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := new(mockConfig)
+	_, err = DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:        dir,
+		NBitsForKeypair: 4096,
+		Testnet:         true,
+		Password:        "password",
+		Mnemonic:        mnemonicFixture,
+		CreationDate:    time.Now(),
+		DbInit:          db.Init,
+		WritePeerID:     true,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, db
+}
+
+func hasProblem(problems []Problem, check, p string) bool {
+	for _, problem := range problems {
+		if problem.Check == check && (p == "" || problem.Path == p) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerifyRepo(t *testing.T) {
+	dir, db := initVerifyRepo(t)
+	defer os.RemoveAll(dir)
+
+	configBefore, err := ioutil.ReadFile(path.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := VerifyRepo(dir, db)
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if len(problems) != 0 {
+		t.Error("Expected no problems for a new repo, got ", problems)
+	}
+	configAfter, err := ioutil.ReadFile(path.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(configBefore) != string(configAfter) {
+		t.Error("VerifyRepo modified the config")
+	}
+
+	problems, err = VerifyRepo(path.Join(dir, "missing"), db)
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if !hasProblem(problems, CheckInitialized, "") {
+		t.Error("Expected an uninitialized repo to be reported, got ", problems)
+	}
+}
+
+func TestVerifyRepoMissingDirectory(t *testing.T) {
+	dir, db := initVerifyRepo(t)
+	defer os.RemoveAll(dir)
+
+	tiny := path.Join(dir, "root", "images", "tiny")
+	if err := os.Remove(tiny); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(path.Join(dir, "outbox")); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := VerifyRepo(dir, db)
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if !hasProblem(problems, CheckDirectories, tiny) || !hasProblem(problems, CheckDirectories, path.Join(dir, "outbox")) {
+		t.Error("Expected both missing directories to be reported, got ", problems)
+	}
+	if len(problems) != 2 {
+		t.Error("Expected only the missing directories to be reported, got ", problems)
+	}
+}
+
+func TestVerifyRepoIdentity(t *testing.T) {
+	dir, db := initVerifyRepo(t)
+	defer os.RemoveAll(dir)
+
+	if problems, err := VerifyRepo(dir, nil); err != nil || len(problems) != 0 {
+		t.Errorf("Expected the keyspace of the peerid file's peer ID to be found, got %v, %v", problems, err)
+	}
+
+	other, err := identityKeyFromMnemonic(mnemonicFixture, "other passphrase", Ed25519KeypairBits, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := VerifyRepo(dir, &mockConfig{identityKey: other})
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if !hasProblem(problems, CheckIdentity, path.Join(dir, "peerid")) {
+		t.Error("Expected a database identity that doesn't match the peerid file to be reported, got ", problems)
+	}
+	if !hasProblem(problems, CheckKeyspace, path.Join(dir, "datastore")) {
+		t.Error("Expected the missing IPNS record of the database identity to be reported, got ", problems)
+	}
+
+	problems, err = VerifyRepo(dir, new(mockConfig))
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if !hasProblem(problems, CheckIdentity, dir) {
+		t.Error("Expected a database without an identity key to be reported, got ", problems)
+	}
+	if problems, err := VerifyRepo(dir, db); err != nil || len(problems) != 0 {
+		t.Errorf("Expected no problems with the repo's own database, got %v, %v", problems, err)
+	}
+}
+
+func TestVerifyRepoMalformedConfig(t *testing.T) {
+	dir, db := initVerifyRepo(t)
+	defer os.RemoveAll(dir)
+
+	configPath := path.Join(dir, "config")
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg["Wallet"] = "broken"
+	b, err = json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "peerid"), []byte("not a peer ID"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := VerifyRepo(dir, db)
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if !hasProblem(problems, CheckConfig, configPath) {
+		t.Error("Expected the malformed wallet section to be reported, got ", problems)
+	}
+	if !hasProblem(problems, CheckIdentity, path.Join(dir, "peerid")) {
+		t.Error("Expected the malformed peer ID to be reported, got ", problems)
+	}
+
+	if err := ioutil.WriteFile(configPath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = VerifyRepo(dir, db)
+	if err != nil {
+		t.Error("VerifyRepo threw an unexpected error", err)
+	}
+	if !hasProblem(problems, CheckConfig, configPath) {
+		t.Error("Expected the unparseable config to be reported, got ", problems)
+	}
+}
+
+func TestRepairDirectoriesPathIsFile(t *testing.T) {
+	dir, db := initVerifyRepo(t)
+	defer os.RemoveAll(dir)
+
+	ratings := path.Join(dir, "root", "ratings")
+	if err := os.RemoveAll(ratings); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(ratings, []byte("user content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repairs, err := RepairDirectories(dir)
+	if err != nil {
+		t.Fatal("RepairDirectories threw an unexpected error", err)
+	}
+	if len(repairs) != 2 || repairs[0].Path != ratings || repairs[1].Path != ratings {
+		t.Fatalf("Expected the file to be moved aside and the directory created, got %v", repairs)
+	}
+	if fi, err := os.Stat(ratings); err != nil || !fi.IsDir() {
+		t.Error("Expected the path to be a directory again")
+	}
+	matches, err := filepath.Glob(ratings + ".*.bak")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("Expected the file to be kept next to the directory, got %v", matches)
+	}
+	if b, err := ioutil.ReadFile(matches[0]); err != nil || string(b) != "user content" {
+		t.Error("Expected the file's content to be kept")
+	}
+	if problems, err := VerifyRepo(dir, db); err != nil || hasProblem(problems, CheckDirectories, "") {
+		t.Errorf("Expected no directory problems after the repair, got %v", problems)
+	}
+
+	repairs, err = RepairDirectories(dir)
+	if err != nil || len(repairs) != 0 {
+		t.Errorf("Expected nothing to repair on a healthy repo, got %v", repairs)
+	}
+}
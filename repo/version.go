@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RepoVersion is the version of the OpenBazaar repo layout this binary
+// expects. Bump it whenever the directories or config extensions change in
+// a way that requires a migration.
+const RepoVersion = 1
+
+// repoVersionFile records the RepoVersion a repo was created or last
+// migrated with. It is separate from the IPFS "version" file.
+const repoVersionFile = "repover"
+
+var ErrRepoTooNew = errors.New("Repo was created by a newer version of OpenBazaar")
+var ErrRepoTooOld = errors.New("Repo was created by an older version of OpenBazaar and must be migrated")
+
+// GetRepoVersion returns the version recorded in the repo. Repos created
+// before the version was recorded are version 0.
+func GetRepoVersion(repoRoot string) (int, error) {
+	b, err := ioutil.ReadFile(path.Join(repoRoot, repoVersionFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// CheckRepoVersion compares the version recorded in the repo against
+// RepoVersion. It returns ErrRepoTooNew if the repo can't be used by this
+// binary and ErrRepoTooOld if it must be migrated first.
+func CheckRepoVersion(repoRoot string) error {
+	version, err := GetRepoVersion(repoRoot)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > RepoVersion:
+		return ErrRepoTooNew
+	case version < RepoVersion:
+		return ErrRepoTooOld
+	}
+	return nil
+}
+
+// MigrateRepo brings a repo created by an older version up to RepoVersion
+// by running Migrations
+func MigrateRepo(repoRoot string) error {
+	return RunMigrations(repoRoot)
+}
+
+func writeRepoVersion(repoRoot string, version int) error {
+	return ioutil.WriteFile(path.Join(repoRoot, repoVersionFile), []byte(strconv.Itoa(version)+"\n"), 0644)
+}
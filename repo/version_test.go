@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestGetRepoVersion(t *testing.T) {
+	_, err := DoInitWithMnemonic(repoRootFolder, 4096, true, "password", "", time.Now(), MockDbInit)
+	if err != nil {
+		t.Errorf("DoInitWithMnemonic threw an unexpected error: %s", err.Error())
+	}
+	version, err := GetRepoVersion(repoRootFolder)
+	if err != nil {
+		t.Error("GetRepoVersion threw an unexpected error", err)
+	}
+	if version != RepoVersion {
+		t.Errorf("Expected repo version %d, got %d", RepoVersion, version)
+	}
+	if err := CheckRepoVersion(repoRootFolder); err != nil {
+		t.Error("CheckRepoVersion threw an unexpected error", err)
+	}
+	TearDown()
+}
+
+func TestGetRepoVersionMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ob-repover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	version, err := GetRepoVersion(dir)
+	if err != nil {
+		t.Error("GetRepoVersion threw an unexpected error", err)
+	}
+	if version != 0 {
+		t.Error("Expected a missing version file to default to 0, got ", version)
+	}
+	if err := CheckRepoVersion(dir); err != ErrRepoTooOld {
+		t.Error("Expected ErrRepoTooOld, got ", err)
+	}
+
+	if err := MigrateRepo(dir); err != nil {
+		t.Error("MigrateRepo threw an unexpected error", err)
+	}
+	if err := CheckRepoVersion(dir); err != nil {
+		t.Error("CheckRepoVersion threw an unexpected error after migrating", err)
+	}
+
+	if err := writeRepoVersion(dir, RepoVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRepoVersion(dir); err != ErrRepoTooNew {
+		t.Error("Expected ErrRepoTooNew, got ", err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, "repover"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetRepoVersion(dir); err == nil {
+		t.Error("GetRepoVersion didn't throw an error for a malformed version")
+	}
+}
@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// DefaultMnemonicLanguage is the wordlist mnemonics have always used
+const DefaultMnemonicLanguage = "english"
+
+// mnemonicLanguageKey records the wordlist of the node's mnemonic in the
+// config so that a restore can use the same one
+const mnemonicLanguageKey = "Mnemonic-language"
+
+var ErrUnknownMnemonicLanguage = errors.New("No wordlist is registered for the mnemonic language")
+var ErrInvalidWordlist = errors.New("A BIP39 wordlist must have 2048 distinct words")
+
+// wordlist is a BIP39 wordlist, the index of each of its words and the
+// separator generated mnemonics are written with
+type wordlist struct {
+	language  string
+	words     []string
+	reverse   map[string]int
+	separator string
+}
+
+var englishWordlist = &wordlist{DefaultMnemonicLanguage, bip39.EnglishWordList, bip39.ReverseWordMap, " "}
+
+// mnemonicSeparators are the languages whose mnemonics BIP39 writes with a
+// separator other than a space
+var mnemonicSeparators = map[string]string{
+	"japanese": "\u3000", // ideographic space
+}
+
+var wordlistsLock sync.RWMutex
+var wordlists = map[string]*wordlist{DefaultMnemonicLanguage: englishWordlist}
+
+// RegisterWordlist makes the BIP39 wordlist of a language, such as
+// "japanese" or "spanish", available to init. Only English is built in as
+// go-bip39 doesn't ship the others. Words should be NFKD normalized, as the
+// seed is derived from the words of the mnemonic joined by spaces. Japanese
+// mnemonics are generated with ideographic spaces between the words.
+func RegisterWordlist(language string, words []string) error {
+	if len(words) != 2048 {
+		return ErrInvalidWordlist
+	}
+	reverse := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := reverse[word]; ok || strings.TrimSpace(word) == "" {
+			return ErrInvalidWordlist
+		}
+		reverse[word] = i
+	}
+	language = strings.ToLower(language)
+	separator, ok := mnemonicSeparators[language]
+	if !ok {
+		separator = " "
+	}
+	wordlistsLock.Lock()
+	defer wordlistsLock.Unlock()
+	wordlists[language] = &wordlist{language, words, reverse, separator}
+	return nil
+}
+
+// getWordlist returns the wordlist of language, or the English one if
+// language is empty
+func getWordlist(language string) (*wordlist, error) {
+	if language == "" {
+		return englishWordlist, nil
+	}
+	wordlistsLock.RLock()
+	defer wordlistsLock.RUnlock()
+	w, ok := wordlists[strings.ToLower(language)]
+	if !ok {
+		return nil, wrapErrorf(ErrUnknownMnemonicLanguage, nil, "%s", language)
+	}
+	return w, nil
+}
+
+// newMnemonic encodes entropy in the words of w. The words are picked by the
+// same indices as in English, so the English mnemonic is translated.
+func (w *wordlist) newMnemonic(entropy []byte) (string, error) {
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil || w == englishWordlist {
+		return mnemonic, err
+	}
+	words := strings.Fields(mnemonic)
+	for i, word := range words {
+		words[i] = w.words[bip39.ReverseWordMap[word]]
+	}
+	return strings.Join(words, w.separator), nil
+}
+
+// normalizeMnemonic returns the words of mnemonic joined by single spaces.
+// This is the NFKD form BIP39 derives the seed from, which also turns the
+// ideographic spaces of Japanese mnemonics into spaces.
+func normalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(mnemonic), " ")
+}
+
+// GetMnemonicLanguage returns the wordlist language recorded in the repo's
+// config. Repos created before the language was recorded are English.
+func GetMnemonicLanguage(cfgBytes []byte) (string, error) {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return "", MalformedConfigError
+	}
+	language, ok := cfg[mnemonicLanguageKey]
+	if !ok {
+		return DefaultMnemonicLanguage, nil
+	}
+	s, ok := language.(string)
+	if !ok {
+		return "", MalformedConfigError
+	}
+	return s, nil
+}
+
+// repoWordlist returns the wordlist of the mnemonic recorded in the config of
+// the repo at repoRoot
+func repoWordlist(repoRoot string) (*wordlist, error) {
+	cfgBytes, err := ioutil.ReadFile(path.Join(repoRoot, "config"))
+	if err != nil {
+		return nil, err
+	}
+	language, err := GetMnemonicLanguage(cfgBytes)
+	if err != nil {
+		return nil, err
+	}
+	return getWordlist(language)
+}
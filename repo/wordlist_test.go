@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWordlist stands in for an official wordlist, which go-bip39 doesn't
+// ship
+func testWordlist() []string {
+	words := make([]string, 2048)
+	for i := range words {
+		words[i] = fmt.Sprintf("palabra%04d", i)
+	}
+	return words
+}
+
+func TestRegisterWordlist(t *testing.T) {
+	if err := RegisterWordlist("short", testWordlist()[:2047]); err != ErrInvalidWordlist {
+		t.Error("Expected ErrInvalidWordlist for a short list, got ", err)
+	}
+	duplicated := testWordlist()
+	duplicated[1] = duplicated[0]
+	if err := RegisterWordlist("duplicated", duplicated); err != ErrInvalidWordlist {
+		t.Error("Expected ErrInvalidWordlist for a duplicated word, got ", err)
+	}
+	if _, err := getWordlist("duplicated"); !isError(err, ErrUnknownMnemonicLanguage) {
+		t.Error("Expected an invalid wordlist not to be registered, got ", err)
+	}
+}
+
+func TestDoInitOptsMnemonicLanguage(t *testing.T) {
+	defer TearDown()
+	words := testWordlist()
+	if err := RegisterWordlist("Test", words); err != nil {
+		t.Fatal(err)
+	}
+
+	var generated string
+	db := &mockConfig{}
+	err := DoInitOpts(InitOptions{
+		RepoRoot:         repoRootFolder,
+		MnemonicEntropy:  128,
+		MnemonicLanguage: "test",
+		Entropy:          bytes.NewReader(make([]byte, 16)),
+		DbInit: func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+			generated = mnemonic
+			return db.Init(mnemonic, identityKey, password, creationDate)
+		},
+	})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	// Zero entropy is "abandon" eleven times then "about", words 0 and 3
+	expected := strings.Repeat(words[0]+" ", 11) + words[3]
+	if generated != expected {
+		t.Errorf("Expected %q, got %q", expected, generated)
+	}
+	configFile, err := ioutil.ReadFile(path.Join(repoRootFolder, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if language, err := GetMnemonicLanguage(configFile); err != nil || language != "test" {
+		t.Errorf("Expected the language to be recorded, got %q (%v)", language, err)
+	}
+	// Checking the phrase against the repo uses the recorded wordlist
+	if match, err := VerifyMnemonicMatchesRepo(repoRootFolder, generated, DefaultSeedPassphrase); err != nil || !match {
+		t.Errorf("Expected the mnemonic to match the repo, got %t, %v", match, err)
+	}
+	if _, err := VerifyMnemonicMatchesRepo(repoRootFolder, mnemonicFixture, DefaultSeedPassphrase); !isError(err, ErrInvalidMnemonic) {
+		t.Error("Expected an English mnemonic to be rejected for the repo, got ", err)
+	}
+	TearDown()
+
+	if err := ValidateInit(repoRootFolder, generated, "test", DefaultMnemonicEntropy); err != nil {
+		t.Error("ValidateInit threw an unexpected error", err)
+	}
+	if err := ValidateInit(repoRootFolder, generated, "", DefaultMnemonicEntropy); !isError(err, ErrInvalidMnemonic) {
+		t.Error("Expected ValidateInit to check the mnemonic against English by default, got ", err)
+	}
+
+	// Restoring with the same wordlist derives the same identity
+	restored := &mockConfig{}
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: generated, MnemonicLanguage: "test", DbInit: restored.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if !bytes.Equal(restored.identityKey, db.identityKey) {
+		t.Error("Expected the restored identity to match")
+	}
+	TearDown()
+
+	for _, opts := range []InitOptions{
+		{RepoRoot: repoRootFolder, Mnemonic: generated, DbInit: MockDbInit},
+		{RepoRoot: repoRootFolder, Mnemonic: mnemonicFixture, MnemonicLanguage: "test", DbInit: MockDbInit},
+	} {
+		if err := DoInitOpts(opts); !isError(err, ErrInvalidMnemonic) {
+			t.Errorf("Expected a mnemonic in another language to be rejected, got %v", err)
+		}
+	}
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, MnemonicLanguage: "klingon", DbInit: MockDbInit})
+	if !isError(err, ErrUnknownMnemonicLanguage) {
+		t.Error("Expected ErrUnknownMnemonicLanguage, got ", err)
+	}
+}
+
+func TestDoInitOptsJapaneseMnemonic(t *testing.T) {
+	defer TearDown()
+	words := testWordlist()
+	if err := RegisterWordlist("Japanese", words); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	db := &mockConfig{}
+	res, err := DoInitOptsResult(context.Background(), InitOptions{
+		RepoRoot:         repoRootFolder,
+		MnemonicEntropy:  128,
+		MnemonicLanguage: "japanese",
+		Entropy:          bytes.NewReader(make([]byte, 16)),
+		DbInit: func(mnemonic string, identityKey []byte, password string, creationDate time.Time) error {
+			stored = mnemonic
+			return db.Init(mnemonic, identityKey, password, creationDate)
+		},
+	})
+	if err != nil {
+		t.Fatal("DoInitOptsResult threw an unexpected error", err)
+	}
+	expected := strings.Repeat(words[0]+"\u3000", 11) + words[3]
+	if res.Mnemonic != expected {
+		t.Errorf("Expected the words to be separated by ideographic spaces, got %q", res.Mnemonic)
+	}
+	// The seed is derived from the words joined by spaces, as in BIP39
+	if normalized := strings.Join(strings.Fields(expected), " "); stored != normalized {
+		t.Errorf("Expected %q to be stored, got %q", normalized, stored)
+	}
+	TearDown()
+
+	restored := &mockConfig{}
+	err = DoInitOpts(InitOptions{RepoRoot: repoRootFolder, Mnemonic: stored, MnemonicLanguage: "japanese", DbInit: restored.Init})
+	if err != nil {
+		t.Fatal("DoInitOpts threw an unexpected error", err)
+	}
+	if !bytes.Equal(restored.identityKey, db.identityKey) {
+		t.Error("Expected the identity restored from the spaced mnemonic to match")
+	}
+}
+
+func TestGetMnemonicLanguage(t *testing.T) {
+	if language, err := GetMnemonicLanguage([]byte(`{}`)); err != nil || language != DefaultMnemonicLanguage {
+		t.Errorf("Expected repos without a language to be English, got %q (%v)", language, err)
+	}
+	if _, err := GetMnemonicLanguage([]byte(`{"Mnemonic-language": 1}`)); err != MalformedConfigError {
+		t.Error("Expected MalformedConfigError, got ", err)
+	}
+}
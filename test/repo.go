@@ -1,11 +1,14 @@
 package test
 
 import (
+	"context"
 	"os"
 	"path"
 
+	"github.com/OpenBazaar/openbazaar-go/ipfs"
 	"github.com/OpenBazaar/openbazaar-go/repo"
 	"github.com/OpenBazaar/openbazaar-go/repo/db"
+	"github.com/tyler-smith/go-bip39"
 	"time"
 )
 
@@ -63,8 +66,22 @@ func (r *Repository) Reset() error {
 		return err
 	}
 
-	// Rebuild any neccessary structure
-	err = repo.DoInit(r.Path, 4096, true, "", r.Password, time.Now(), r.DB.Config().Init)
+	// Rebuild any neccessary structure. The test mnemonic isn't a BIP39
+	// mnemonic, which DoInit rejects, so the identity is derived from it
+	// here as the test node derives it.
+	identityKey, err := ipfs.IdentityKeyFromSeed(bip39.NewSeed(r.Password, repo.DefaultSeedPassphrase), 256)
+	if err != nil {
+		return err
+	}
+	_, err = repo.DoInitFromKey(context.Background(), repo.InitOptions{
+		RepoRoot:     r.Path,
+		Testnet:      true,
+		IdentityKey:  identityKey,
+		CreationDate: time.Now(),
+		DbInit: func(_ string, identityKey []byte, password string, creationDate time.Time) error {
+			return r.DB.Config().Init(r.Password, identityKey, password, creationDate)
+		},
+	})
 	if err != nil && err != repo.ErrRepoExists {
 		return err
 	}